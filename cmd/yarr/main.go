@@ -8,7 +8,9 @@ import (
 	"log"
 	"os"
 	"path/filepath"
+	"strconv"
 	"strings"
+	"time"
 
 	"github.com/nkanaev/yarr/src/platform"
 	"github.com/nkanaev/yarr/src/server"
@@ -49,6 +51,11 @@ func main() {
 	platform.FixConsoleIfNeeded()
 
 	var addr, db, authfile, auth, certfile, keyfile, basepath, logfile string
+	var backupdir, backupinterval, backupkeep string
+	var publicurl string
+	var smtpaddr, smtpauth, smtpfrom string
+	var mediadir string
+	var fetchconcurrency, fetchhostconcurrency, fetchhostdelay string
 	var ver, open bool
 
 	flag.CommandLine.SetOutput(os.Stdout)
@@ -57,6 +64,8 @@ func main() {
 		out := flag.CommandLine.Output()
 		fmt.Fprintf(out, "Usage of %s:\n", os.Args[0])
 		flag.PrintDefaults()
+		fmt.Fprintln(out, "\nCommands:")
+		fmt.Fprintln(out, "  restore <path>\n    \treplace the storage file with the backup and exit")
 		fmt.Fprintln(out, "\nThe environmental variables, if present, will be used to provide\nthe default values for the params above:")
 		fmt.Fprintln(out, " ", strings.Join(OptList, ", "))
 	}
@@ -69,6 +78,17 @@ func main() {
 	flag.StringVar(&keyfile, "key-file", opt("YARR_KEYFILE", ""), "`path` to key file for https")
 	flag.StringVar(&db, "db", opt("YARR_DB", ""), "storage file `path`")
 	flag.StringVar(&logfile, "log-file", opt("YARR_LOGFILE", ""), "`path` to log file to use instead of stdout")
+	flag.StringVar(&backupdir, "backup-dir", opt("YARR_BACKUP_DIR", ""), "`path` to the directory for scheduled backups (disabled if empty)")
+	flag.StringVar(&backupinterval, "backup-interval", opt("YARR_BACKUP_INTERVAL", "24h"), "`duration` between scheduled backups")
+	flag.StringVar(&backupkeep, "backup-keep", opt("YARR_BACKUP_KEEP", "7"), "`number` of scheduled backups to keep (0 to keep all)")
+	flag.StringVar(&publicurl, "public-url", opt("YARR_PUBLIC_URL", ""), "externally reachable `url` of the service (including the base path), enables websub push subscriptions")
+	flag.StringVar(&fetchconcurrency, "fetch-concurrency", opt("YARR_FETCH_CONCURRENCY", "8"), "`number` of feeds fetched at the same time")
+	flag.StringVar(&fetchhostconcurrency, "fetch-host-concurrency", opt("YARR_FETCH_HOST_CONCURRENCY", "2"), "`number` of feeds fetched at the same time from a single host")
+	flag.StringVar(&fetchhostdelay, "fetch-host-delay", opt("YARR_FETCH_HOST_DELAY", "1s"), "minimum `duration` between the requests to the same host")
+	flag.StringVar(&smtpaddr, "smtp-addr", opt("YARR_SMTP_ADDR", ""), "`host:port` of the smtp server sending the email digests (disabled if empty)")
+	flag.StringVar(&smtpauth, "smtp-auth", opt("YARR_SMTP_AUTH", ""), "smtp credentials in the format `username:password`")
+	flag.StringVar(&smtpfrom, "smtp-from", opt("YARR_SMTP_FROM", ""), "sender `address` of the email digests")
+	flag.StringVar(&mediadir, "media-dir", opt("YARR_MEDIA_DIR", ""), "`path` to the directory for the downloaded podcast episodes & videos (disabled if empty)")
 	flag.BoolVar(&ver, "version", false, "print application version")
 	flag.BoolVar(&open, "open", false, "open the server in browser")
 	flag.Parse()
@@ -109,6 +129,22 @@ func main() {
 
 	log.Printf("using db file %s", db)
 
+	if flag.Arg(0) == "restore" {
+		backup := flag.Arg(1)
+		if backup == "" {
+			log.Fatal("Backup file path missing")
+		}
+		if err := storage.Restore(backup, db); err != nil {
+			log.Fatal("Failed to restore backup: ", err)
+		}
+		// upgrade the schema of the backup, if needed
+		if _, err := storage.New(db); err != nil {
+			log.Fatal("Failed to initialise database: ", err)
+		}
+		log.Printf("restored %s (previous db file moved to %s.old)", backup, db)
+		return
+	}
+
 	var username, password string
 	var err error
 	if authfile != "" {
@@ -132,6 +168,27 @@ func main() {
 		log.Fatalf("Both cert & key files are required")
 	}
 
+	backupInterval, err := time.ParseDuration(backupinterval)
+	if err != nil {
+		log.Fatal("Failed to parse backup interval: ", err)
+	}
+	backupKeep, err := strconv.Atoi(backupkeep)
+	if err != nil {
+		log.Fatal("Failed to parse number of backups to keep: ", err)
+	}
+	fetchConcurrency, err := strconv.Atoi(fetchconcurrency)
+	if err != nil {
+		log.Fatal("Failed to parse fetch concurrency: ", err)
+	}
+	fetchHostConcurrency, err := strconv.Atoi(fetchhostconcurrency)
+	if err != nil {
+		log.Fatal("Failed to parse fetch host concurrency: ", err)
+	}
+	fetchHostDelay, err := time.ParseDuration(fetchhostdelay)
+	if err != nil {
+		log.Fatal("Failed to parse fetch host delay: ", err)
+	}
+
 	store, err := storage.New(db)
 	if err != nil {
 		log.Fatal("Failed to initialise database: ", err)
@@ -154,6 +211,37 @@ func main() {
 		srv.Password = password
 	}
 
+	if backupdir != "" {
+		srv.BackupDir = backupdir
+		srv.BackupInterval = backupInterval
+		srv.BackupKeep = backupKeep
+	}
+
+	if publicurl != "" {
+		srv.PublicURL = publicurl
+	}
+
+	if mediadir != "" {
+		srv.MediaDir = mediadir
+	}
+
+	if smtpaddr != "" {
+		if smtpfrom == "" {
+			log.Fatal("Sender address of the email digests missing")
+		}
+		smtpUsername, smtpPassword, _ := strings.Cut(smtpauth, ":")
+		srv.SMTP = worker.SMTPConfig{
+			Addr:     smtpaddr,
+			Username: smtpUsername,
+			Password: smtpPassword,
+			From:     smtpfrom,
+		}
+	}
+
+	srv.FetchConcurrency = fetchConcurrency
+	srv.FetchHostConcurrency = fetchHostConcurrency
+	srv.FetchHostDelay = fetchHostDelay
+
 	log.Printf("starting server at %s", srv.GetAddr())
 	if open {
 		platform.Open(srv.GetAddr())
@@ -37,6 +37,9 @@
       create: function(data) {
         return api('post', './api/feeds', data).then(json)
       },
+      get: function(id) {
+        return api('get', './api/feeds/' + id).then(json)
+      },
       update: function(id, data) {
         return api('put', './api/feeds/' + id, data)
       },
@@ -52,9 +55,19 @@
       refresh: function() {
         return api('post', './api/feeds/refresh')
       },
+      refresh_one: function(id) {
+        return api('post', './api/feeds/' + id + '/refresh').then(json)
+      },
       list_errors: function() {
         return api('get', './api/feeds/errors').then(json)
       },
+      list_dead: function(days) {
+        var query = days !== undefined ? '?days=' + days : ''
+        return api('get', './api/feeds/dead' + query).then(json)
+      },
+      history: function(id) {
+        return api('get', './api/feeds/' + id + '/history').then(json)
+      },
     },
     folders: {
       list: function() {
@@ -66,19 +79,29 @@
       update: function(id, data) {
         return api('put', './api/folders/' + id, data)
       },
-      delete: function(id) {
-        return api('delete', './api/folders/' + id)
+      delete: function(id, mode) {
+        return api('delete', './api/folders/' + id + param(mode && {mode: mode}))
+      },
+      move: function(id, parentId) {
+        return api('post', './api/folders/' + id + '/move', {parent_id: parentId})
+      },
+      merge: function(id, targetId) {
+        return api('post', './api/folders/' + id + '/merge', {folder_id: targetId})
       },
       reorder: function(ids) {
         return api('post', './api/folders/reorder', ids)
       },
       list_items: function(id) {
         return api('get', './api/folders/' + id + '/items').then(json)
+      },
+      refresh: function(id) {
+        return api('post', './api/folders/' + id + '/refresh').then(json)
       }
     },
     items: {
-      get: function(id) {
-        return api('get', './api/items/' + id).then(json)
+      get: function(id, content) {
+        var query = content ? '?content=' + content : ''
+        return api('get', './api/items/' + id + query).then(json)
       },
       list: function(query) {
         return api('get', './api/items' + param(query)).then(json)
@@ -89,6 +112,18 @@
       mark_read: function(query) {
         return api('put', './api/items' + param(query))
       },
+      revisions: function(id) {
+        return api('get', './api/items/' + id + '/revisions').then(json)
+      },
+      playback: function(id) {
+        return api('get', './api/items/' + id + '/playback').then(json)
+      },
+      update_playback: function(id, data) {
+        return api('put', './api/items/' + id + '/playback', data).then(json)
+      },
+      continue_listening: function(limit) {
+        return api('get', './api/playback' + param(limit ? {limit: limit} : null)).then(json)
+      },
       summarize: function(id, regenerate) {
         return api('post', './api/items/' + id + '/summarize?regenerate=' + (regenerate ? 'true' : 'false')).then(json)
       },
@@ -100,6 +135,85 @@
         return api('post', url).then(json)
       },
     },
+    smartfeeds: {
+      list: function() {
+        return api('get', './api/smartfeeds').then(json)
+      },
+      create: function(data) {
+        return api('post', './api/smartfeeds', data).then(json)
+      },
+      update: function(id, data) {
+        return api('put', './api/smartfeeds/' + id, data)
+      },
+      delete: function(id) {
+        return api('delete', './api/smartfeeds/' + id)
+      },
+    },
+    rules: {
+      list: function() {
+        return api('get', './api/rules').then(json)
+      },
+      create: function(data) {
+        return api('post', './api/rules', data).then(json)
+      },
+      update: function(id, data) {
+        return api('put', './api/rules/' + id, data).then(json)
+      },
+      delete: function(id) {
+        return api('delete', './api/rules/' + id)
+      },
+      test: function(data) {
+        return api('post', './api/rules/test', data).then(json)
+      },
+    },
+    webhooks: {
+      list: function() {
+        return api('get', './api/webhooks').then(json)
+      },
+      create: function(data) {
+        return api('post', './api/webhooks', data).then(json)
+      },
+      update: function(id, data) {
+        return api('put', './api/webhooks/' + id, data).then(json)
+      },
+      delete: function(id) {
+        return api('delete', './api/webhooks/' + id)
+      },
+      deliveries: function(id) {
+        return api('get', './api/webhooks/' + id + '/deliveries').then(json)
+      },
+    },
+    digests: {
+      list: function() {
+        return api('get', './api/digests').then(json)
+      },
+      create: function(data) {
+        return api('post', './api/digests', data).then(json)
+      },
+      update: function(id, data) {
+        return api('put', './api/digests/' + id, data).then(json)
+      },
+      delete: function(id) {
+        return api('delete', './api/digests/' + id)
+      },
+      send: function(id) {
+        return api('post', './api/digests/' + id + '/send').then(json)
+      },
+    },
+    tags: {
+      list: function() {
+        return api('get', './api/tags').then(json)
+      },
+      create: function(data) {
+        return api('post', './api/tags', data).then(json)
+      },
+      update: function(id, data) {
+        return api('put', './api/tags/' + id, data)
+      },
+      delete: function(id) {
+        return api('delete', './api/tags/' + id)
+      },
+    },
     settings: {
       get: function() {
         return api('get', './api/settings').then(json)
@@ -120,8 +234,10 @@
     logout: function() {
       return api('post', './logout')
     },
-    crawl: function(url) {
-      return api('get', './page?url=' + encodeURIComponent(url)).then(json)
+    crawl: function(url, feedId) {
+      var query = '?url=' + encodeURIComponent(url)
+      if (feedId) query += '&feed_id=' + feedId
+      return api('get', './page' + query).then(json)
     }
   }
 })()
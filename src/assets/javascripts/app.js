@@ -228,6 +228,7 @@ var vm = new Vue({
       'feedListWidth': s.feed_list_width || 300,
       'feedNewChoice': [],
       'feedNewChoiceSelected': '',
+      'feedNewScrape': false,
       'items': [],
       'itemsHasMore': true,
       'itemSelected': null,
@@ -372,11 +373,11 @@ var vm = new Vue({
     },
     contentAudios: function() {
       if (!this.itemSelectedDetails) return []
-      return (this.itemSelectedDetails.media_links || []).filter(l => l.type === 'audio')
+      return (this.itemSelectedDetails.media_links || []).filter(l => l.type === 'audio').map(this.localMedia)
     },
     contentVideos: function() {
       if (!this.itemSelectedDetails) return []
-      return (this.itemSelectedDetails.media_links || []).filter(l => l.type === 'video')
+      return (this.itemSelectedDetails.media_links || []).filter(l => l.type === 'video').map(this.localMedia)
     },
     refreshRateTitle: function () {
       const entry = this.refreshRateOptions.find(o => o.value === this.refreshRate)
@@ -474,6 +475,41 @@ var vm = new Vue({
     },
   },
   methods: {
+    localMedia: function(link) {
+      var media = (this.itemSelectedDetails.media || []).find(m => m.url === link.url && m.status === 'done')
+      if (!media) return link
+      return Object.assign({}, link, {url: './api/media/' + media.id, source: link.url})
+    },
+    restorePlayback: function(event, media) {
+      var playback = this.itemSelectedDetails.playback
+      if (!playback || playback.completed || playback.url !== (media.source || media.url)) return
+      event.target.currentTime = playback.position
+    },
+    reportPlayback: function(event, media, force) {
+      var player = event.target
+      var now = Date.now()
+      // the progress is reported every 15 seconds while playing
+      if (!force && player._reportedAt && now - player._reportedAt < 15000) return
+      player._reportedAt = now
+      var item = this.itemSelectedDetails
+      api.items.update_playback(item.id, {
+        url: media.source || media.url,
+        position: player.currentTime,
+        duration: isFinite(player.duration) ? player.duration : 0,
+        completed: event.type === 'ended',
+        updated_at: new Date(now).toISOString(),
+      }).then(function(playback) {
+        item.playback = playback
+        // the server marks the item read once the completed playback is saved,
+        // the progress is not saved if outdated (i.e. a more recent one is from another device)
+        if (playback.completed && Date.parse(playback.updated_at) === now && item.status === 'unread') {
+          vm.feedStats[item.feed_id].unread -= 1
+          var itemInList = vm.items.find(function(i) { return i.id == item.id })
+          if (itemInList) itemInList.status = 'read'
+          item.status = 'read'
+        }
+      })
+    },
     updateMetaTheme: function(theme) {
       document.querySelector("meta[name='theme-color']").content = this.themeColors[theme]
     },
@@ -684,6 +720,28 @@ var vm = new Vue({
         })
       }
     },
+    toggleFeedFullContent: function(feed) {
+      var enabled = !feed.fetch_full_content
+      api.feeds.update(feed.id, {fetch_full_content: enabled}).then(function() {
+        feed.fetch_full_content = enabled
+      })
+    },
+    toggleFeedMediaDownload: function(feed) {
+      var policy = null
+      if (!feed.media_download) {
+        var count = prompt('Number of the latest episodes to keep (0 for all)', '10')
+        if (count === null) return
+        policy = {max_count: Math.max(parseInt(count, 10) || 0, 0)}
+      }
+      api.feeds.update(feed.id, {media_download: policy}).then(function() {
+        feed.media_download = policy
+      })
+    },
+    resumeFeed: function(feed) {
+      api.feeds.update(feed.id, {paused: false}).then(function() {
+        feed.paused_at = null
+      })
+    },
     renameFeed: function(feed) {
       var newTitle = prompt('Enter new title', feed.title)
       if (newTitle) {
@@ -709,6 +767,11 @@ var vm = new Vue({
       }
       if (this.feedNewChoiceSelected) {
         data.url = this.feedNewChoiceSelected
+      } else if (this.feedNewScrape) {
+        data.selectors = {}
+        ;['item', 'title', 'link', 'date', 'content'].forEach(function(name) {
+          data.selectors[name] = form.querySelector('input[name=selector_' + name + ']').value.trim()
+        })
       }
       this.loading.newfeed = true
       api.feeds.create(data).then(function(result) {
@@ -720,6 +783,8 @@ var vm = new Vue({
         } else if (result.status === 'multiple') {
           vm.feedNewChoice = result.choice
           vm.feedNewChoiceSelected = result.choice[0].url
+        } else if (result.error) {
+          alert(result.error)
         } else {
           alert('No feeds found at the given url.')
         }
@@ -773,9 +838,19 @@ var vm = new Vue({
       }
       var item = this.itemSelectedDetails
       if (!item) return
+      // the article extracted at ingestion: switch to the other version instead of crawling
+      if (item.has_full_content) {
+        this.loading.readability = true
+        var other = item.content_source == 'full' ? 'feed' : 'full'
+        api.items.get(item.id, other).then(function(data) {
+          vm.itemSelectedReadability = data && data.content
+          vm.loading.readability = false
+        })
+        return
+      }
       if (item.link) {
         this.loading.readability = true
-        api.crawl(item.link).then(function(data) {
+        api.crawl(item.link, item.feed_id).then(function(data) {
           vm.itemSelectedReadability = data && data.content
           vm.loading.readability = false
         })
@@ -787,6 +862,7 @@ var vm = new Vue({
       if (settings === 'create') {
         vm.feedNewChoice = []
         vm.feedNewChoiceSelected = ''
+        vm.feedNewScrape = false
       } else if (settings === 'ai') {
         // Load current AI settings from app.settings
         var s = app.settings
@@ -944,6 +1020,16 @@ var vm = new Vue({
         vm.refreshStats()
       })
     },
+    refreshFeedNow: function(feed) {
+      api.feeds.refresh_one(feed.id).then(function() {
+        vm.refreshStats(true)
+      })
+    },
+    refreshFolderNow: function(folder) {
+      api.folders.refresh(folder.id).then(function() {
+        vm.refreshStats(true)
+      })
+    },
     computeStats: function() {
       var filter = this.filterSelected
       if (!filter) {
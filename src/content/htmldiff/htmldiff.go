@@ -0,0 +1,192 @@
+// Word-level diff of the text content of two html documents.
+package htmldiff
+
+import (
+	"html"
+	"strings"
+	"unicode"
+
+	nethtml "golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+)
+
+// Upper bound of the lcs table size. Documents with larger changed regions
+// are displayed as a removal of the old text followed by the new one.
+const maxTableSize = 4_000_000
+
+type op int
+
+const (
+	opEqual op = iota
+	opDelete
+	opInsert
+)
+
+var blockTags = map[atom.Atom]bool{
+	atom.Address: true, atom.Article: true, atom.Aside: true, atom.Blockquote: true,
+	atom.Br: true, atom.Dd: true, atom.Div: true, atom.Dl: true, atom.Dt: true,
+	atom.Figcaption: true, atom.Figure: true, atom.Footer: true, atom.H1: true,
+	atom.H2: true, atom.H3: true, atom.H4: true, atom.H5: true, atom.H6: true,
+	atom.Header: true, atom.Hr: true, atom.Li: true, atom.Ol: true, atom.P: true,
+	atom.Pre: true, atom.Section: true, atom.Table: true, atom.Tr: true, atom.Ul: true,
+}
+
+// Compare the text of the documents and return the new text as html,
+// with the removed words wrapped in <del> and the added ones in <ins>.
+func Diff(oldHTML, newHTML string) string {
+	a := tokenize(oldHTML)
+	b := tokenize(newHTML)
+
+	// common prefix & suffix are excluded from the lcs computation
+	prefix := 0
+	for prefix < len(a) && prefix < len(b) && a[prefix] == b[prefix] {
+		prefix++
+	}
+	suffix := 0
+	for suffix < len(a)-prefix && suffix < len(b)-prefix && a[len(a)-1-suffix] == b[len(b)-1-suffix] {
+		suffix++
+	}
+
+	out := &writer{}
+	for _, token := range a[:prefix] {
+		out.write(opEqual, token)
+	}
+	diffTokens(out, a[prefix:len(a)-suffix], b[prefix:len(b)-suffix])
+	for _, token := range a[len(a)-suffix:] {
+		out.write(opEqual, token)
+	}
+	out.flush()
+	return strings.TrimSpace(out.buf.String())
+}
+
+func diffTokens(out *writer, a, b []string) {
+	n, m := len(a), len(b)
+	if n*m > maxTableSize {
+		for _, token := range a {
+			out.write(opDelete, token)
+		}
+		for _, token := range b {
+			out.write(opInsert, token)
+		}
+		return
+	}
+
+	// lcs[i][j] is the length of the longest common subsequence of a[i:] & b[j:]
+	lcs := make([][]int32, n+1)
+	for i := range lcs {
+		lcs[i] = make([]int32, m+1)
+	}
+	for i := n - 1; i >= 0; i-- {
+		for j := m - 1; j >= 0; j-- {
+			if a[i] == b[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else {
+				lcs[i][j] = max(lcs[i+1][j], lcs[i][j+1])
+			}
+		}
+	}
+
+	i, j := 0, 0
+	for i < n && j < m {
+		switch {
+		case a[i] == b[j]:
+			out.write(opEqual, a[i])
+			i++
+			j++
+		case lcs[i+1][j] >= lcs[i][j+1]:
+			out.write(opDelete, a[i])
+			i++
+		default:
+			out.write(opInsert, b[j])
+			j++
+		}
+	}
+	for ; i < n; i++ {
+		out.write(opDelete, a[i])
+	}
+	for ; j < m; j++ {
+		out.write(opInsert, b[j])
+	}
+}
+
+// Split the text of the document into words & line breaks.
+// The whitespace separating the words is kept as a prefix of the following word.
+func tokenize(content string) []string {
+	tokens := make([]string, 0)
+	space := false
+	addBreak := func() {
+		if len(tokens) > 0 && tokens[len(tokens)-1] != "\n" {
+			tokens = append(tokens, "\n")
+		}
+		space = false
+	}
+
+	tokenizer := nethtml.NewTokenizer(strings.NewReader(content))
+	for {
+		switch tokenizer.Next() {
+		case nethtml.ErrorToken:
+			if len(tokens) > 0 && tokens[len(tokens)-1] == "\n" {
+				tokens = tokens[:len(tokens)-1]
+			}
+			return tokens
+		case nethtml.StartTagToken, nethtml.EndTagToken, nethtml.SelfClosingTagToken:
+			name, _ := tokenizer.TagName()
+			if blockTags[atom.Lookup(name)] {
+				addBreak()
+			}
+		case nethtml.TextToken:
+			text := html.UnescapeString(string(tokenizer.Text()))
+			if strings.IndexFunc(text, unicode.IsSpace) == 0 {
+				space = true
+			}
+			for i, word := range strings.Fields(text) {
+				if (i > 0 || space) && len(tokens) > 0 && tokens[len(tokens)-1] != "\n" {
+					word = " " + word
+				}
+				tokens = append(tokens, word)
+				space = false
+			}
+			if text != strings.TrimRightFunc(text, unicode.IsSpace) {
+				space = true
+			}
+		}
+	}
+}
+
+// Accumulates the tokens, grouping the consecutive ones with the same operation.
+type writer struct {
+	buf   strings.Builder
+	op    op
+	chunk []string
+}
+
+func (w *writer) write(o op, token string) {
+	if o != w.op {
+		w.flush()
+		w.op = o
+	}
+	w.chunk = append(w.chunk, token)
+}
+
+func (w *writer) flush() {
+	if len(w.chunk) == 0 {
+		return
+	}
+	var text strings.Builder
+	for _, token := range w.chunk {
+		if token == "\n" {
+			text.WriteString("<br>\n")
+		} else {
+			text.WriteString(html.EscapeString(token))
+		}
+	}
+	switch w.op {
+	case opDelete:
+		w.buf.WriteString("<del>" + text.String() + "</del>")
+	case opInsert:
+		w.buf.WriteString("<ins>" + text.String() + "</ins>")
+	default:
+		w.buf.WriteString(text.String())
+	}
+	w.chunk = w.chunk[:0]
+}
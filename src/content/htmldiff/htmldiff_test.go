@@ -0,0 +1,33 @@
+package htmldiff
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestTokenize(t *testing.T) {
+	have := tokenize(`<p>Hello, <b>big</b> world!</p><p>foo&amp;bar  baz</p>`)
+	want := []string{"Hello,", " big", " world!", "\n", "foo&bar", " baz"}
+	if !reflect.DeepEqual(have, want) {
+		t.Logf("want: %#v", want)
+		t.Logf("have: %#v", have)
+		t.Fail()
+	}
+}
+
+func TestDiff(t *testing.T) {
+	testcases := []struct {
+		old, new, want string
+	}{
+		{"<p>same text</p>", "<p>same text</p>", "same text"},
+		{"the quick fox", "the quick brown fox", "the quick<ins> brown</ins> fox"},
+		{"the quick brown fox", "the fox", "the<del> quick brown</del> fox"},
+		{"price: 10$", "price: 20$", "price:<del> 10$</del><ins> 20$</ins>"},
+		{"<p>one</p>", "<p>one</p><p>a &lt;b&gt;</p>", "one<ins><br>\na &lt;b&gt;</ins>"},
+	}
+	for _, tc := range testcases {
+		if have := Diff(tc.old, tc.new); have != tc.want {
+			t.Errorf("\nold:  %q\nnew:  %q\nwant: %q\nhave: %q", tc.old, tc.new, tc.want, have)
+		}
+	}
+}
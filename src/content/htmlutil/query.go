@@ -1,14 +1,11 @@
 package htmlutil
 
 import (
-	"regexp"
 	"strings"
 
 	"golang.org/x/net/html"
 )
 
-var nodeNameRegex = regexp.MustCompile(`\w+|\*`)
-
 func FindNodes(node *html.Node, match func(*html.Node) bool) []*html.Node {
 	nodes := make([]*html.Node, 0)
 
@@ -42,18 +39,13 @@ func Closest(node *html.Node, sel string) *html.Node {
 	return nil
 }
 
+// Same as `ParseSelector`, panics if the selector is invalid.
 func NewMatcher(sel string) Matcher {
-	multi := MultiMatch{}
-	parts := strings.Split(sel, ",")
-	for _, part := range parts {
-		part := strings.TrimSpace(part)
-		if nodeNameRegex.MatchString(part) {
-			multi.Add(ElementMatch{Name: part})
-		} else {
-			panic("unsupported selector: " + part)
-		}
+	matcher, err := ParseSelector(sel)
+	if err != nil {
+		panic(err)
 	}
-	return multi
+	return matcher
 }
 
 type Matcher interface {
@@ -68,6 +60,125 @@ func (m ElementMatch) Match(n *html.Node) bool {
 	return n.Type == html.ElementNode && (n.Data == m.Name || m.Name == "*")
 }
 
+// Element matching all the conditions, e.g. `a.link[href^="/"]:nth-child(2)`.
+type CompoundMatch struct {
+	matchers []Matcher
+}
+
+func (m *CompoundMatch) Add(matcher Matcher) {
+	m.matchers = append(m.matchers, matcher)
+}
+
+func (m CompoundMatch) Match(n *html.Node) bool {
+	if n.Type != html.ElementNode {
+		return false
+	}
+	for _, matcher := range m.matchers {
+		if !matcher.Match(n) {
+			return false
+		}
+	}
+	return true
+}
+
+// Sequence of the compound selectors separated by the combinators, e.g. `ul.posts > li a`.
+type ComplexMatch struct {
+	compounds []Matcher
+	// combinators[i] goes between compounds[i] & compounds[i+1]: ' ' (descendant) or '>' (child)
+	combinators []byte
+}
+
+func (m ComplexMatch) Match(n *html.Node) bool {
+	return m.matchAt(n, len(m.compounds)-1)
+}
+
+func (m ComplexMatch) matchAt(n *html.Node, i int) bool {
+	if !m.compounds[i].Match(n) {
+		return false
+	}
+	if i == 0 {
+		return true
+	}
+	if m.combinators[i-1] == '>' {
+		return n.Parent != nil && m.matchAt(n.Parent, i-1)
+	}
+	for p := n.Parent; p != nil; p = p.Parent {
+		if m.matchAt(p, i-1) {
+			return true
+		}
+	}
+	return false
+}
+
+// Attribute selector: `[name]` or `[name<op>value]`, where op is one of `= ~= |= ^= $= *=`.
+type AttrMatch struct {
+	Name  string
+	Op    string
+	Value string
+}
+
+func (m AttrMatch) Match(n *html.Node) bool {
+	var value string
+	found := false
+	for _, a := range n.Attr {
+		if strings.EqualFold(a.Key, m.Name) {
+			value, found = a.Val, true
+			break
+		}
+	}
+	if !found {
+		return false
+	}
+	switch m.Op {
+	case "":
+		return true
+	case "=":
+		return value == m.Value
+	case "~=":
+		for _, word := range strings.Fields(value) {
+			if word == m.Value {
+				return true
+			}
+		}
+		return false
+	case "|=":
+		return value == m.Value || strings.HasPrefix(value, m.Value+"-")
+	case "^=":
+		return m.Value != "" && strings.HasPrefix(value, m.Value)
+	case "$=":
+		return m.Value != "" && strings.HasSuffix(value, m.Value)
+	case "*=":
+		return m.Value != "" && strings.Contains(value, m.Value)
+	}
+	return false
+}
+
+// Position of the element among its siblings: `:nth-child(An+B)`, counting from 1.
+// With `FromEnd` the siblings are counted from the last one.
+type NthChildMatch struct {
+	A, B    int
+	FromEnd bool
+}
+
+func (m NthChildMatch) Match(n *html.Node) bool {
+	index := 1
+	for s := n.PrevSibling; s != nil && !m.FromEnd; s = s.PrevSibling {
+		if s.Type == html.ElementNode {
+			index++
+		}
+	}
+	for s := n.NextSibling; s != nil && m.FromEnd; s = s.NextSibling {
+		if s.Type == html.ElementNode {
+			index++
+		}
+	}
+	if m.A == 0 {
+		return index == m.B
+	}
+	steps := index - m.B
+	return steps%m.A == 0 && steps/m.A >= 0
+}
+
 type MultiMatch struct {
 	matchers []Matcher
 }
@@ -1,6 +1,7 @@
 package htmlutil
 
 import (
+	"sort"
 	"strings"
 	"testing"
 
@@ -85,3 +86,67 @@ func TestClosest(t *testing.T) {
 		t.FailNow()
 	}
 }
+
+func TestQuerySelectors(t *testing.T) {
+	node, _ := html.Parse(strings.NewReader(`
+		<div id="main">
+			<ul class="posts list">
+				<li><a href="/1" data-kind="post">one</a></li>
+				<li class="ad"><a href="https://ads.example.com">ad</a></li>
+				<li><span><a href="/3">three</a></span></li>
+				<li><a href="/4" lang="en-US">four</a></li>
+			</ul>
+		</div>
+		<ul><li><a href="/other">other</a></li></ul>
+	`))
+	testcases := []struct {
+		sel  string
+		want []string
+	}{
+		{"#main a", []string{"one", "ad", "three", "four"}},
+		{"ul.posts > li > a", []string{"one", "ad", "four"}},
+		{".list li:not-a-class a", nil},
+		{"li.ad a", []string{"ad"}},
+		{"a[href^='/']", []string{"one", "three", "four", "other"}},
+		{`a[href$="3"], a[data-kind=post]`, []string{"one", "three"}},
+		{"a[href*=example]", []string{"ad"}},
+		{"a[lang|=en]", []string{"four"}},
+		{"[data-kind]", []string{"one"}},
+		{"ul[class~=list] li:nth-child(2n+1) a", []string{"one", "three"}},
+		{".posts li:nth-child(even) > a", []string{"ad", "four"}},
+		{".posts li:nth-child(-n+2) a", []string{"one", "ad"}},
+		{".posts li:nth-last-child(1) a", []string{"four"}},
+		{"li:first-child a", []string{"one", "other"}},
+		{"LI:LAST-CHILD A", []string{"four", "other"}},
+	}
+	for _, testcase := range testcases {
+		matcher, err := ParseSelector(testcase.sel)
+		if testcase.want == nil {
+			if err == nil {
+				t.Errorf("%s: expected an error", testcase.sel)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: %s", testcase.sel, err)
+			continue
+		}
+		have := make([]string, 0)
+		for _, n := range FindNodes(node, matcher.Match) {
+			have = append(have, Text(n))
+		}
+		sort.Strings(have)
+		sort.Strings(testcase.want)
+		if strings.Join(have, ",") != strings.Join(testcase.want, ",") {
+			t.Errorf("%s\nwant: %v\nhave: %v", testcase.sel, testcase.want, have)
+		}
+	}
+}
+
+func TestParseSelectorInvalid(t *testing.T) {
+	for _, sel := range []string{"", "a,", "a >", "a[href", "a[href=]", "a:hover", "li:nth-child(x)", "div..x", "a[href='x]"} {
+		if _, err := ParseSelector(sel); err == nil {
+			t.Errorf("%q: expected an error", sel)
+		}
+	}
+}
@@ -0,0 +1,255 @@
+package htmlutil
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+var nthRegex = regexp.MustCompile(`^([+-]?\d*)n([+-]\d+)?$`)
+
+// Parse the css selector. Supported are the lists of the complex selectors
+// with the descendant (` `) and child (`>`) combinators, made of the type, universal (`*`),
+// class, id & attribute selectors along with `:nth-child()`, `:nth-last-child()`,
+// `:first-child` and `:last-child`.
+func ParseSelector(sel string) (Matcher, error) {
+	p := &selectorParser{input: sel}
+	multi := MultiMatch{}
+	for {
+		matcher, err := p.complex()
+		if err != nil {
+			return nil, err
+		}
+		multi.Add(matcher)
+		p.skipSpace()
+		if p.eof() {
+			break
+		}
+		if p.peek() != ',' {
+			return nil, p.errorf("unexpected %q", p.peek())
+		}
+		p.pos++
+	}
+	if len(multi.matchers) == 1 {
+		return multi.matchers[0], nil
+	}
+	return multi, nil
+}
+
+type selectorParser struct {
+	input string
+	pos   int
+}
+
+func (p *selectorParser) errorf(format string, args ...any) error {
+	return fmt.Errorf("invalid selector %q at %d: %s", p.input, p.pos, fmt.Sprintf(format, args...))
+}
+
+func (p *selectorParser) eof() bool {
+	return p.pos >= len(p.input)
+}
+
+func (p *selectorParser) peek() byte {
+	return p.input[p.pos]
+}
+
+func (p *selectorParser) skipSpace() bool {
+	start := p.pos
+	for !p.eof() && strings.IndexByte(" \t\r\n\f", p.peek()) >= 0 {
+		p.pos++
+	}
+	return p.pos > start
+}
+
+func (p *selectorParser) ident() string {
+	start := p.pos
+	for !p.eof() {
+		r, size := utf8.DecodeRuneInString(p.input[p.pos:])
+		if !(r == '-' || r == '_' || unicode.IsLetter(r) || unicode.IsDigit(r)) {
+			break
+		}
+		p.pos += size
+	}
+	return p.input[start:p.pos]
+}
+
+func (p *selectorParser) complex() (Matcher, error) {
+	p.skipSpace()
+	first, err := p.compound()
+	if err != nil {
+		return nil, err
+	}
+	complex := ComplexMatch{compounds: []Matcher{first}}
+	for {
+		spaced := p.skipSpace()
+		if p.eof() || p.peek() == ',' {
+			break
+		}
+		combinator := byte(' ')
+		if p.peek() == '>' {
+			combinator = '>'
+			p.pos++
+			p.skipSpace()
+		} else if !spaced {
+			return nil, p.errorf("unexpected %q", p.peek())
+		}
+		next, err := p.compound()
+		if err != nil {
+			return nil, err
+		}
+		complex.compounds = append(complex.compounds, next)
+		complex.combinators = append(complex.combinators, combinator)
+	}
+	if len(complex.compounds) == 1 {
+		return first, nil
+	}
+	return complex, nil
+}
+
+func (p *selectorParser) compound() (Matcher, error) {
+	compound := CompoundMatch{}
+	empty := true
+	if name := p.ident(); name != "" {
+		compound.Add(ElementMatch{Name: strings.ToLower(name)})
+		empty = false
+	} else if !p.eof() && p.peek() == '*' {
+		p.pos++
+		empty = false
+	}
+	for !p.eof() {
+		var matcher Matcher
+		var err error
+		switch p.peek() {
+		case '.', '#':
+			attr := map[byte]string{'.': "class", '#': "id"}[p.peek()]
+			p.pos++
+			value := p.ident()
+			if value == "" {
+				return nil, p.errorf("%s name missing", attr)
+			}
+			if attr == "class" {
+				matcher = AttrMatch{Name: attr, Op: "~=", Value: value}
+			} else {
+				matcher = AttrMatch{Name: attr, Op: "=", Value: value}
+			}
+		case '[':
+			matcher, err = p.attr()
+		case ':':
+			matcher, err = p.pseudo()
+		}
+		if err != nil {
+			return nil, err
+		}
+		if matcher == nil {
+			break
+		}
+		compound.Add(matcher)
+		empty = false
+	}
+	if empty {
+		if p.eof() {
+			return nil, p.errorf("selector missing")
+		}
+		return nil, p.errorf("unexpected %q", p.peek())
+	}
+	return compound, nil
+}
+
+func (p *selectorParser) attr() (Matcher, error) {
+	p.pos++ // [
+	p.skipSpace()
+	m := AttrMatch{Name: p.ident()}
+	if m.Name == "" {
+		return nil, p.errorf("attribute name missing")
+	}
+	p.skipSpace()
+	for _, op := range []string{"=", "~=", "|=", "^=", "$=", "*="} {
+		if strings.HasPrefix(p.input[p.pos:], op) {
+			m.Op = op
+			p.pos += len(op)
+			break
+		}
+	}
+	if m.Op != "" {
+		p.skipSpace()
+		if p.eof() {
+			return nil, p.errorf("attribute value missing")
+		}
+		if quote := p.peek(); quote == '"' || quote == '\'' {
+			end := strings.IndexByte(p.input[p.pos+1:], quote)
+			if end < 0 {
+				return nil, p.errorf("unterminated string")
+			}
+			m.Value = p.input[p.pos+1 : p.pos+1+end]
+			p.pos += end + 2
+		} else if m.Value = p.ident(); m.Value == "" {
+			return nil, p.errorf("attribute value missing")
+		}
+		p.skipSpace()
+	}
+	if p.eof() || p.peek() != ']' {
+		return nil, p.errorf("] expected")
+	}
+	p.pos++
+	return m, nil
+}
+
+func (p *selectorParser) pseudo() (Matcher, error) {
+	p.pos++ // :
+	name := strings.ToLower(p.ident())
+	switch name {
+	case "first-child":
+		return NthChildMatch{B: 1}, nil
+	case "last-child":
+		return NthChildMatch{B: 1, FromEnd: true}, nil
+	case "nth-child", "nth-last-child":
+		if p.eof() || p.peek() != '(' {
+			return nil, p.errorf("( expected")
+		}
+		end := strings.IndexByte(p.input[p.pos:], ')')
+		if end < 0 {
+			return nil, p.errorf(") expected")
+		}
+		m, ok := parseNth(p.input[p.pos+1 : p.pos+end])
+		if !ok {
+			return nil, p.errorf("invalid argument of :%s", name)
+		}
+		m.FromEnd = name == "nth-last-child"
+		p.pos += end + 1
+		return m, nil
+	}
+	return nil, p.errorf("unsupported pseudo-class :%s", name)
+}
+
+// Parse the argument of `:nth-child`: `odd`, `even`, `B` or `An+B`.
+func parseNth(expr string) (NthChildMatch, bool) {
+	expr = strings.ToLower(strings.Join(strings.Fields(expr), ""))
+	switch expr {
+	case "odd":
+		return NthChildMatch{A: 2, B: 1}, true
+	case "even":
+		return NthChildMatch{A: 2, B: 0}, true
+	}
+	if b, err := strconv.Atoi(expr); err == nil {
+		return NthChildMatch{B: b}, true
+	}
+	matches := nthRegex.FindStringSubmatch(expr)
+	if matches == nil {
+		return NthChildMatch{}, false
+	}
+	m := NthChildMatch{A: 1}
+	switch matches[1] {
+	case "", "+":
+	case "-":
+		m.A = -1
+	default:
+		m.A, _ = strconv.Atoi(matches[1])
+	}
+	if matches[2] != "" {
+		m.B, _ = strconv.Atoi(matches[2])
+	}
+	return m, true
+}
@@ -5,6 +5,7 @@ import (
 	"strings"
 
 	"github.com/nkanaev/yarr/src/content/htmlutil"
+	"github.com/nkanaev/yarr/src/content/silo"
 	"golang.org/x/net/html"
 )
 
@@ -39,13 +40,10 @@ func FindFeeds(body string, base string) map[string]string {
 
 			l, err := url.Parse(link)
 			if err == nil && l.Host == "www.youtube.com" && l.Path == "/feeds/videos.xml" {
-				// https://wiki.archiveteam.org/index.php/YouTube/Technical_details#Playlists
-				channelID, found := strings.CutPrefix(l.Query().Get("channel_id"), "UC")
-				if found {
-					const url string = "https://www.youtube.com/feeds/videos.xml?playlist_id="
-					candidates[url+"UULF"+channelID] = name + " - Videos"
-					candidates[url+"UULV"+channelID] = name + " - Live Streams"
-					candidates[url+"UUSH"+channelID] = name + " - Short videos"
+				if channelID := l.Query().Get("channel_id"); channelID != "" {
+					for link, title := range silo.YouTubeChannelFeeds(channelID, name) {
+						candidates[link] = title
+					}
 				}
 			}
 		}
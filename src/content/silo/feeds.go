@@ -0,0 +1,182 @@
+package silo
+
+import (
+	"net/url"
+	"regexp"
+	"strings"
+)
+
+var (
+	mastodonUserRegex = regexp.MustCompile(`^@\w+$`)
+	githubNameRegex   = regexp.MustCompile(`^[\w-]+$`)
+	githubRepoRegex   = regexp.MustCompile(`^[\w.-]+$`)
+)
+
+// first segments of the github paths which aren't users or organizations
+var githubReserved = map[string]bool{
+	"about": true, "apps": true, "collections": true, "contact": true, "enterprise": true,
+	"explore": true, "features": true, "login": true, "marketplace": true, "new": true,
+	"notifications": true, "orgs": true, "pricing": true, "pulls": true, "issues": true,
+	"search": true, "settings": true, "sponsors": true, "topics": true, "trending": true,
+}
+
+// Feeds of the known sites derived from the url of a page, along with their titles.
+// The sites either don't advertise their feeds or hide some of them.
+func FeedLinks(link string) map[string]string {
+	l, err := url.Parse(link)
+	if err != nil || l.Host == "" {
+		return nil
+	}
+	host := strings.TrimPrefix(strings.ToLower(l.Hostname()), "www.")
+	path := make([]string, 0)
+	for _, segment := range strings.Split(l.Path, "/") {
+		if segment != "" {
+			path = append(path, segment)
+		}
+	}
+
+	switch {
+	case host == "youtube.com" || host == "m.youtube.com":
+		return youtubeFeeds(l, path)
+	case host == "github.com":
+		return githubFeeds(path)
+	case host == "gitlab.com":
+		return gitlabFeeds(l, path)
+	case host == "reddit.com" || host == "old.reddit.com":
+		return redditFeeds(path)
+	case host == "medium.com" || strings.HasSuffix(host, ".medium.com"):
+		return mediumFeeds(host, path)
+	case strings.HasSuffix(host, ".substack.com"):
+		if len(path) > 0 && path[0] == "feed" {
+			return nil
+		}
+		return map[string]string{"https://" + host + "/feed": ""}
+	}
+
+	// mastodon & the like: https://mastodon.social/@user
+	if len(path) == 1 && mastodonUserRegex.MatchString(path[0]) {
+		return map[string]string{l.Scheme + "://" + l.Host + "/" + path[0] + ".rss": path[0]}
+	}
+	return nil
+}
+
+// Feed of the youtube channel along with the playlists of its videos, streams & shorts.
+// https://wiki.archiveteam.org/index.php/YouTube/Technical_details#Playlists
+func YouTubeChannelFeeds(channelID, title string) map[string]string {
+	const feedURL = "https://www.youtube.com/feeds/videos.xml"
+	feeds := map[string]string{feedURL + "?channel_id=" + channelID: title}
+	if id, found := strings.CutPrefix(channelID, "UC"); found {
+		prefix := title
+		if prefix != "" {
+			prefix += " - "
+		}
+		feeds[feedURL+"?playlist_id=UULF"+id] = prefix + "Videos"
+		feeds[feedURL+"?playlist_id=UULV"+id] = prefix + "Live Streams"
+		feeds[feedURL+"?playlist_id=UUSH"+id] = prefix + "Short videos"
+	}
+	return feeds
+}
+
+func youtubeFeeds(l *url.URL, path []string) map[string]string {
+	const feedURL = "https://www.youtube.com/feeds/videos.xml"
+	switch {
+	case len(path) >= 2 && path[0] == "channel":
+		return YouTubeChannelFeeds(path[1], "")
+	case len(path) >= 2 && path[0] == "user":
+		return map[string]string{feedURL + "?user=" + url.QueryEscape(path[1]): path[1]}
+	case len(path) == 1 && path[0] == "playlist" && l.Query().Get("list") != "":
+		return map[string]string{feedURL + "?playlist_id=" + url.QueryEscape(l.Query().Get("list")): ""}
+	}
+	// the handles (/@name) require the page to find the channel
+	return nil
+}
+
+func githubFeeds(path []string) map[string]string {
+	if len(path) == 0 || githubReserved[path[0]] || !githubNameRegex.MatchString(path[0]) {
+		return nil
+	}
+	for _, segment := range path {
+		if strings.HasSuffix(segment, ".atom") {
+			return nil
+		}
+	}
+	if len(path) == 1 {
+		return map[string]string{"https://github.com/" + path[0] + ".atom": path[0]}
+	}
+	if !githubRepoRegex.MatchString(path[1]) {
+		return nil
+	}
+	repo := path[0] + "/" + path[1]
+	feeds := map[string]string{
+		"https://github.com/" + repo + "/releases.atom": repo + " - Releases",
+		"https://github.com/" + repo + "/commits.atom":  repo + " - Commits",
+		"https://github.com/" + repo + "/tags.atom":     repo + " - Tags",
+	}
+	// narrowed down to the section of the repository
+	if len(path) > 2 {
+		link := "https://github.com/" + repo + "/" + path[2] + ".atom"
+		if title, ok := feeds[link]; ok {
+			return map[string]string{link: title}
+		}
+	}
+	return feeds
+}
+
+func gitlabFeeds(l *url.URL, path []string) map[string]string {
+	if l.RawQuery != "" {
+		return nil
+	}
+	// the project pages are separated from the path of the project by a dash: /group/project/-/issues
+	project := make([]string, 0)
+	for _, segment := range path {
+		if segment == "-" {
+			break
+		}
+		project = append(project, segment)
+	}
+	if len(project) == 0 || strings.HasSuffix(project[len(project)-1], ".atom") {
+		return nil
+	}
+	name := strings.Join(project, "/")
+	if len(project) == 1 {
+		return map[string]string{"https://gitlab.com/" + name + ".atom": name}
+	}
+	return map[string]string{
+		"https://gitlab.com/" + name + ".atom":               name + " - Activity",
+		"https://gitlab.com/" + name + "/-/tags?format=atom": name + " - Tags",
+	}
+}
+
+func redditFeeds(path []string) map[string]string {
+	if len(path) != 2 {
+		return nil
+	}
+	switch path[0] {
+	case "r":
+		return map[string]string{"https://www.reddit.com/r/" + path[1] + "/.rss": "r/" + path[1]}
+	case "u", "user":
+		return map[string]string{"https://www.reddit.com/user/" + path[1] + "/.rss": "u/" + path[1]}
+	}
+	return nil
+}
+
+func mediumFeeds(host string, path []string) map[string]string {
+	if len(path) > 0 && path[0] == "feed" {
+		return nil
+	}
+	if host != "medium.com" {
+		// https://author.medium.com
+		return map[string]string{"https://" + host + "/feed": ""}
+	}
+	switch {
+	case len(path) >= 1 && strings.HasPrefix(path[0], "@"):
+		// the profile of the author or one of their stories
+		return map[string]string{"https://medium.com/feed/" + path[0]: path[0]}
+	case len(path) == 2 && path[0] == "tag":
+		return map[string]string{"https://medium.com/feed/tag/" + path[1]: path[1]}
+	case len(path) == 1:
+		// publication
+		return map[string]string{"https://medium.com/feed/" + path[0]: path[0]}
+	}
+	return nil
+}
@@ -0,0 +1,61 @@
+package silo
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestFeedLinks(t *testing.T) {
+	testcases := []struct {
+		link string
+		want map[string]string
+	}{
+		{"https://www.youtube.com/channel/UCabc/videos", map[string]string{
+			"https://www.youtube.com/feeds/videos.xml?channel_id=UCabc":    "",
+			"https://www.youtube.com/feeds/videos.xml?playlist_id=UULFabc": "Videos",
+			"https://www.youtube.com/feeds/videos.xml?playlist_id=UULVabc": "Live Streams",
+			"https://www.youtube.com/feeds/videos.xml?playlist_id=UUSHabc": "Short videos",
+		}},
+		{"https://www.youtube.com/playlist?list=PLxyz", map[string]string{
+			"https://www.youtube.com/feeds/videos.xml?playlist_id=PLxyz": "",
+		}},
+		{"https://www.youtube.com/user/name", map[string]string{
+			"https://www.youtube.com/feeds/videos.xml?user=name": "name",
+		}},
+		{"https://www.youtube.com/@handle", nil},
+		{"https://github.com/nkanaev/yarr", map[string]string{
+			"https://github.com/nkanaev/yarr/releases.atom": "nkanaev/yarr - Releases",
+			"https://github.com/nkanaev/yarr/commits.atom":  "nkanaev/yarr - Commits",
+			"https://github.com/nkanaev/yarr/tags.atom":     "nkanaev/yarr - Tags",
+		}},
+		{"https://github.com/nkanaev/yarr/releases/tag/v2.4", map[string]string{
+			"https://github.com/nkanaev/yarr/releases.atom": "nkanaev/yarr - Releases",
+		}},
+		{"https://github.com/nkanaev", map[string]string{"https://github.com/nkanaev.atom": "nkanaev"}},
+		{"https://github.com/trending", nil},
+		{"https://gitlab.com/group/sub/project/-/issues", map[string]string{
+			"https://gitlab.com/group/sub/project.atom":               "group/sub/project - Activity",
+			"https://gitlab.com/group/sub/project/-/tags?format=atom": "group/sub/project - Tags",
+		}},
+		{"https://gitlab.com/user", map[string]string{"https://gitlab.com/user.atom": "user"}},
+		{"https://old.reddit.com/r/golang/", map[string]string{"https://www.reddit.com/r/golang/.rss": "r/golang"}},
+		{"https://www.reddit.com/u/someone", map[string]string{"https://www.reddit.com/user/someone/.rss": "u/someone"}},
+		{"https://mastodon.social/@someone", map[string]string{"https://mastodon.social/@someone.rss": "@someone"}},
+		{"https://example.substack.com/p/post", map[string]string{"https://example.substack.com/feed": ""}},
+		{"https://medium.com/@author/some-story-123", map[string]string{"https://medium.com/feed/@author": "@author"}},
+		{"https://author.medium.com/", map[string]string{"https://author.medium.com/feed": ""}},
+		{"https://example.com/blog", nil},
+	}
+	for _, testcase := range testcases {
+		have := FeedLinks(testcase.link)
+		if !reflect.DeepEqual(have, testcase.want) && !(len(have) == 0 && len(testcase.want) == 0) {
+			t.Errorf("%s\nwant: %#v\nhave: %#v", testcase.link, testcase.want, have)
+		}
+		// the feeds themselves aren't mapped any further
+		for link := range have {
+			if feeds := FeedLinks(link); len(feeds) != 0 {
+				t.Errorf("%s: feed %s mapped to %#v", testcase.link, link, feeds)
+			}
+		}
+	}
+}
@@ -10,11 +10,12 @@ import (
 )
 
 type atomFeed struct {
-	XMLName xml.Name    `xml:"http://www.w3.org/2005/Atom feed"`
-	ID      string      `xml:"id"`
-	Title   atomText    `xml:"title"`
-	Links   atomLinks   `xml:"link"`
-	Entries []atomEntry `xml:"entry"`
+	XMLName xml.Name     `xml:"http://www.w3.org/2005/Atom feed"`
+	ID      string       `xml:"id"`
+	Title   atomText     `xml:"title"`
+	Links   atomLinks    `xml:"link"`
+	Authors []atomPerson `xml:"author"`
+	Entries []atomEntry  `xml:"entry"`
 }
 
 type atomEntry struct {
@@ -27,6 +28,9 @@ type atomEntry struct {
 	Content   atomText  `xml:"http://www.w3.org/2005/Atom content"`
 	OrigLink  string    `xml:"http://rssnamespace.org/feedburner/ext/1.0 origLink"`
 
+	Authors    []atomPerson   `xml:"author"`
+	Categories []atomCategory `xml:"category"`
+
 	media
 }
 
@@ -43,6 +47,24 @@ type atomLink struct {
 
 type atomLinks []atomLink
 
+type atomPerson struct {
+	Name  string `xml:"name"`
+	Email string `xml:"email"`
+}
+
+type atomCategory struct {
+	Term  string `xml:"term,attr"`
+	Label string `xml:"label,attr"`
+}
+
+func atomAuthors(persons []atomPerson) string {
+	names := make([]string, 0, len(persons))
+	for _, p := range persons {
+		names = append(names, firstNonEmpty(p.Name, p.Email))
+	}
+	return joinAuthors(names...)
+}
+
 func (a *atomText) Text() string {
 	if a.Type == "html" {
 		return htmlutil.ExtractText(a.Data)
@@ -80,6 +102,8 @@ func ParseAtom(r io.Reader) (*Feed, error) {
 	dstfeed := &Feed{
 		Title:   srcfeed.Title.String(),
 		SiteURL: firstNonEmpty(srcfeed.Links.First("alternate"), srcfeed.Links.First("")),
+		HubURL:  srcfeed.Links.First("hub"),
+		SelfURL: srcfeed.Links.First("self"),
 	}
 	for _, srcitem := range srcfeed.Entries {
 		linkFromID := ""
@@ -91,14 +115,25 @@ func ParseAtom(r io.Reader) (*Feed, error) {
 
 		mediaLinks := srcitem.mediaLinks()
 
+		var categories []string
+		for _, c := range srcitem.Categories {
+			categories = append(categories, firstNonEmpty(c.Label, c.Term))
+		}
+		categories = uniqueNonEmpty(categories...)
+
 		link := firstNonEmpty(srcitem.OrigLink, srcitem.Links.First("alternate"), srcitem.Links.First(""), linkFromID)
 		dstfeed.Items = append(dstfeed.Items, Item{
-			GUID:       firstNonEmpty(guidFromID, srcitem.ID, link),
-			Date:       dateParse(firstNonEmpty(srcitem.Published, srcitem.Updated)),
-			URL:        link,
-			Title:      srcitem.Title.Text(),
-			Content:    firstNonEmpty(srcitem.Content.String(), srcitem.Summary.String(), srcitem.firstMediaDescription()),
-			MediaLinks: mediaLinks,
+			GUID:        firstNonEmpty(guidFromID, srcitem.ID, link),
+			Date:        dateParse(firstNonEmpty(srcitem.Published, srcitem.Updated)),
+			DateUpdated: dateParse(srcitem.Updated),
+			URL:         link,
+			Title:       srcitem.Title.Text(),
+			Content:     firstNonEmpty(srcitem.Content.String(), srcitem.Summary.String(), srcitem.firstMediaDescription()),
+			MediaLinks:  mediaLinks,
+
+			Author:      firstNonEmpty(atomAuthors(srcitem.Authors), atomAuthors(srcfeed.Authors)),
+			Categories:  categories,
+			CommentsURL: srcitem.Links.First("replies"),
 		})
 	}
 	return dstfeed, nil
@@ -38,13 +38,16 @@ func TestAtom(t *testing.T) {
 	want := &Feed{
 		Title:   "Example Feed",
 		SiteURL: "http://example.org/",
+		SelfURL: "http://example.org/feed/",
 		Items: []Item{
 			{
-				GUID:    "urn:uuid:1225c695-cfb8-4ebb-aaaa-80da344efa6a",
-				Date:    time.Unix(1071340202, 0).UTC(),
-				URL:     "http://example.org/2003/12/13/atom03.html",
-				Title:   "Atom-Powered Robots Run Amok",
-				Content: `<div xmlns="http://www.w3.org/1999/xhtml"><p>This is the entry content.</p></div>`,
+				GUID:        "urn:uuid:1225c695-cfb8-4ebb-aaaa-80da344efa6a",
+				Date:        time.Unix(1071340202, 0).UTC(),
+				DateUpdated: time.Unix(1071340202, 0).UTC(),
+				URL:         "http://example.org/2003/12/13/atom03.html",
+				Title:       "Atom-Powered Robots Run Amok",
+				Content:     `<div xmlns="http://www.w3.org/1999/xhtml"><p>This is the entry content.</p></div>`,
+				Author:      "John Doe",
 			},
 		},
 	}
@@ -200,6 +203,8 @@ func TestAtomLinkInID(t *testing.T) {
 			Date:  time.Date(2003, time.December, 13, 9, 17, 51, 0, time.UTC),
 			URL:   "https://example.com/posts/1",
 			Title: "one updated",
+
+			DateUpdated: time.Date(2003, time.December, 13, 9, 17, 51, 0, time.UTC),
 		},
 		Item{
 			GUID: "urn:uuid:60a76c80-d399-11d9-b93C-0003939e0af6",
@@ -234,3 +239,37 @@ func TestAtomDoesntEscapeHTMLTags(t *testing.T) {
 		t.FailNow()
 	}
 }
+
+func TestAtomAuthorsCategoriesComments(t *testing.T) {
+	feed, _ := Parse(strings.NewReader(`
+		<?xml version="1.0" encoding="utf-8"?>
+		<feed xmlns="http://www.w3.org/2005/Atom">
+			<author><name>Feed Author</name></author>
+			<entry>
+				<id>1</id>
+				<author><name>Jane</name></author>
+				<author><email>bob@example.com</email></author>
+				<category term="go" />
+				<category term="db" label="Databases" />
+				<category term="go" />
+				<link rel="replies" type="text/html" href="http://example.org/1#comments"/>
+			</entry>
+			<entry>
+				<id>2</id>
+			</entry>
+		</feed>
+	`))
+	item := feed.Items[0]
+	if item.Author != "Jane, bob@example.com" {
+		t.Errorf("invalid author: %#v", item.Author)
+	}
+	if want := []string{"go", "Databases"}; !reflect.DeepEqual(item.Categories, want) {
+		t.Errorf("invalid categories: %#v", item.Categories)
+	}
+	if item.CommentsURL != "http://example.org/1#comments" {
+		t.Errorf("invalid comments url: %#v", item.CommentsURL)
+	}
+	if feed.Items[1].Author != "Feed Author" {
+		t.Errorf("expected feed author fallback, got: %#v", feed.Items[1].Author)
+	}
+}
@@ -127,6 +127,9 @@ func ParseAndFix(r io.Reader, baseURL, fallbackEncoding string) (*Feed, error) {
 func (feed *Feed) cleanup() {
 	feed.Title = strings.TrimSpace(feed.Title)
 	feed.SiteURL = strings.TrimSpace(feed.SiteURL)
+	feed.HubURL = strings.TrimSpace(feed.HubURL)
+	feed.SelfURL = strings.TrimSpace(feed.SelfURL)
+	feed.NewFeedURL = strings.TrimSpace(feed.NewFeedURL)
 
 	for i, item := range feed.Items {
 		feed.Items[i].GUID = strings.TrimSpace(item.GUID)
@@ -164,6 +167,14 @@ func (feed *Feed) TranslateURLs(base string) error {
 		return fmt.Errorf("failed to parse feed url: %#v", feed.SiteURL)
 	}
 	feed.SiteURL = baseUrl.ResolveReference(siteUrl).String()
+	for _, link := range []*string{&feed.HubURL, &feed.SelfURL, &feed.NewFeedURL} {
+		if *link == "" {
+			continue
+		}
+		if linkUrl, err := url.Parse(*link); err == nil {
+			*link = baseUrl.ResolveReference(linkUrl).String()
+		}
+	}
 	for _, item := range feed.Items {
 		itemUrl, err := url.Parse(item.URL)
 		if err != nil {
@@ -0,0 +1,82 @@
+package parser
+
+import (
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Syndication module, used by the publishers to tell how often the feed is updated.
+// https://web.resource.org/rss/1.0/modules/syndication/
+type syndication struct {
+	UpdatePeriod    string `xml:"http://purl.org/rss/1.0/modules/syndication/ channel>updatePeriod"`
+	UpdateFrequency string `xml:"http://purl.org/rss/1.0/modules/syndication/ channel>updateFrequency"`
+}
+
+var syndicationPeriods = map[string]time.Duration{
+	"hourly":  time.Hour,
+	"daily":   time.Hour * 24,
+	"weekly":  time.Hour * 24 * 7,
+	"monthly": time.Hour * 24 * 30,
+	"yearly":  time.Hour * 24 * 365,
+}
+
+// The period divided by the number of updates within it. Defaults to once a day.
+func (s syndication) updateInterval() time.Duration {
+	period := strings.ToLower(strings.TrimSpace(s.UpdatePeriod))
+	frequency := strings.TrimSpace(s.UpdateFrequency)
+	if period == "" && frequency == "" {
+		return 0
+	}
+	interval, ok := syndicationPeriods[period]
+	if !ok {
+		interval = syndicationPeriods["daily"]
+	}
+	if n, err := strconv.Atoi(frequency); err == nil && n > 0 {
+		interval /= time.Duration(n)
+	}
+	return interval
+}
+
+// RSS `<ttl>`: number of minutes the feed can be cached for.
+func parseTTL(ttl string) time.Duration {
+	minutes, err := strconv.Atoi(strings.TrimSpace(ttl))
+	if err != nil || minutes <= 0 {
+		return 0
+	}
+	return time.Duration(minutes) * time.Minute
+}
+
+// RSS `<skipHours>`: hours in GMT, 0-23. Some publishers use 24 for midnight.
+func parseSkipHours(vals []string) []int {
+	var hours []int
+	seen := make(map[int]bool)
+	for _, val := range vals {
+		hour, err := strconv.Atoi(strings.TrimSpace(val))
+		if err != nil || hour < 0 || hour > 24 {
+			continue
+		}
+		hour %= 24
+		if !seen[hour] {
+			seen[hour] = true
+			hours = append(hours, hour)
+		}
+	}
+	return hours
+}
+
+// RSS `<skipDays>`: English names of the days.
+func parseSkipDays(vals []string) []time.Weekday {
+	var days []time.Weekday
+	seen := make(map[time.Weekday]bool)
+	for _, val := range vals {
+		val = strings.ToLower(strings.TrimSpace(val))
+		for day := time.Sunday; day <= time.Saturday; day++ {
+			if val == strings.ToLower(day.String()) && !seen[day] {
+				seen[day] = true
+				days = append(days, day)
+			}
+		}
+	}
+	return days
+}
@@ -0,0 +1,148 @@
+package parser
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/nkanaev/yarr/src/content/htmlutil"
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/charset"
+)
+
+// Css selectors of the items on the html page (see `htmlutil.ParseSelector`).
+// The item containers are required, the rest are looked up within each container.
+type Selectors struct {
+	Item    string `json:"item"`
+	Title   string `json:"title,omitempty"`
+	Link    string `json:"link,omitempty"`
+	Date    string `json:"date,omitempty"`
+	Content string `json:"content,omitempty"`
+}
+
+// Defaults of the optional selectors.
+var defaultSelectors = Selectors{
+	Title: "h1,h2,h3,h4,h5,h6",
+	Link:  "a[href]",
+	Date:  "time",
+}
+
+var ErrNoItems = errors.New("no items found on the page")
+
+func (s Selectors) Validate() error {
+	if strings.TrimSpace(s.Item) == "" {
+		return errors.New("item selector missing")
+	}
+	for _, sel := range []string{s.Item, s.Title, s.Link, s.Date, s.Content} {
+		if sel == "" {
+			continue
+		}
+		if _, err := htmlutil.ParseSelector(sel); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s Selectors) withDefaults() Selectors {
+	if s.Title == "" {
+		s.Title = defaultSelectors.Title
+	}
+	if s.Link == "" {
+		s.Link = defaultSelectors.Link
+	}
+	if s.Date == "" {
+		s.Date = defaultSelectors.Date
+	}
+	return s
+}
+
+// Build the feed from the items of the html page matched by the selectors.
+func ParseHTML(r io.Reader, baseURL, fallbackEncoding string, sel Selectors) (*Feed, error) {
+	if err := sel.Validate(); err != nil {
+		return nil, err
+	}
+	sel = sel.withDefaults()
+
+	var err error
+	if fallbackEncoding != "" {
+		r, err = charset.NewReaderLabel(fallbackEncoding, r)
+	} else {
+		r, err = charset.NewReader(r, "text/html")
+	}
+	if err != nil {
+		return nil, err
+	}
+	doc, err := html.Parse(r)
+	if err != nil {
+		return nil, err
+	}
+	base, err := url.Parse(baseURL)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse base url: %#v", baseURL)
+	}
+
+	feed := &Feed{SiteURL: baseURL}
+	if titles := htmlutil.Query(doc, "title"); len(titles) > 0 {
+		feed.Title = htmlutil.Text(titles[0])
+	}
+	for _, node := range htmlutil.Query(doc, sel.Item) {
+		item := Item{}
+		if n := first(node, sel.Title); n != nil {
+			item.Title = htmlutil.Text(n)
+		}
+		if n := first(node, sel.Link); n != nil {
+			href := htmlutil.Attr(n, "href")
+			if href == "" {
+				if a := first(n, "a[href]"); a != nil {
+					href = htmlutil.Attr(a, "href")
+				}
+			}
+			if link, err := url.Parse(strings.TrimSpace(href)); err == nil && href != "" {
+				item.URL = base.ResolveReference(link).String()
+			}
+			if item.Title == "" {
+				item.Title = htmlutil.Text(n)
+			}
+		}
+		if n := first(node, sel.Date); n != nil {
+			date := htmlutil.Attr(n, "datetime")
+			if date == "" {
+				date = htmlutil.Text(n)
+			}
+			item.Date = dateParse(strings.TrimSpace(date))
+		}
+		if sel.Content != "" {
+			if n := first(node, sel.Content); n != nil {
+				item.Content = htmlutil.InnerHTML(n)
+			}
+		} else {
+			item.Content = htmlutil.InnerHTML(node)
+		}
+		if item.Title == "" && item.URL == "" {
+			continue
+		}
+		// the links are more stable than the rest of the page
+		item.GUID = item.URL
+		feed.Items = append(feed.Items, item)
+	}
+	if len(feed.Items) == 0 {
+		return nil, ErrNoItems
+	}
+
+	feed.cleanup()
+	feed.SetMissingDatesTo(time.Now())
+	feed.SetMissingGUIDs()
+	return feed, nil
+}
+
+// First node matching the selector, the node itself included.
+func first(node *html.Node, sel string) *html.Node {
+	if nodes := htmlutil.Query(node, sel); len(nodes) > 0 {
+		return nodes[0]
+	}
+	return nil
+}
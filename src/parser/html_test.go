@@ -0,0 +1,73 @@
+package parser
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseHTML(t *testing.T) {
+	page := `
+		<!DOCTYPE html>
+		<html>
+		<head><title> Example News </title></head>
+		<body>
+			<div class="news">
+				<article>
+					<h2>First</h2>
+					<a class="more" href="/news/1">read more</a>
+					<time datetime="2024-03-01T10:00:00Z">March 1</time>
+					<div class="body"><p>one</p></div>
+				</article>
+				<article>
+					<h2><a href="https://other.example.com/2">Second</a></h2>
+					<span class="date">2024-03-02</span>
+					<div class="body"><p>two</p></div>
+				</article>
+				<article><p>no title, no link</p></article>
+			</div>
+		</body>
+		</html>
+	`
+	have, err := ParseHTML(strings.NewReader(page), "https://example.com/news/", "", Selectors{
+		Item:    ".news > article",
+		Date:    "time, .date",
+		Content: ".body",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := &Feed{
+		Title:   "Example News",
+		SiteURL: "https://example.com/news/",
+		Items: []Item{
+			{
+				GUID:    "https://example.com/news/1",
+				URL:     "https://example.com/news/1",
+				Title:   "First",
+				Date:    time.Date(2024, 3, 1, 10, 0, 0, 0, time.UTC),
+				Content: "<p>one</p>",
+			},
+			{
+				GUID:    "https://other.example.com/2",
+				URL:     "https://other.example.com/2",
+				Title:   "Second",
+				Date:    time.Date(2024, 3, 2, 0, 0, 0, 0, time.UTC),
+				Content: "<p>two</p>",
+			},
+		},
+	}
+	if !reflect.DeepEqual(want, have) {
+		t.Logf("want: %#v", want)
+		t.Logf("have: %#v", have)
+		t.Fatal("invalid html feed")
+	}
+
+	if _, err := ParseHTML(strings.NewReader(page), "https://example.com/", "", Selectors{Item: "li"}); err != ErrNoItems {
+		t.Fatalf("expected no items error, got %v", err)
+	}
+	if _, err := ParseHTML(strings.NewReader(page), "https://example.com/", "", Selectors{Item: "li:hover"}); err == nil {
+		t.Fatal("expected invalid selector error")
+	}
+}
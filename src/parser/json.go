@@ -11,6 +11,9 @@ type jsonFeed struct {
 	Title   string     `json:"title"`
 	SiteURL string     `json:"home_page_url"`
 	Items   []jsonItem `json:"items"`
+
+	Author  *jsonAuthor  `json:"author"`
+	Authors []jsonAuthor `json:"authors"`
 }
 
 type jsonItem struct {
@@ -23,6 +26,26 @@ type jsonItem struct {
 	DatePublished string           `json:"date_published"`
 	DateModified  string           `json:"date_modified"`
 	Attachments   []jsonAttachment `json:"attachments"`
+	Tags          []string         `json:"tags"`
+
+	// version 1.0 has a single author, replaced by the list in 1.1
+	Author  *jsonAuthor  `json:"author"`
+	Authors []jsonAuthor `json:"authors"`
+}
+
+type jsonAuthor struct {
+	Name string `json:"name"`
+}
+
+func jsonAuthors(author *jsonAuthor, authors []jsonAuthor) string {
+	names := make([]string, 0, len(authors)+1)
+	for _, a := range authors {
+		names = append(names, a.Name)
+	}
+	if author != nil {
+		names = append(names, author.Name)
+	}
+	return joinAuthors(names...)
 }
 
 type jsonAttachment struct {
@@ -46,11 +69,15 @@ func ParseJSON(data io.Reader) (*Feed, error) {
 	}
 	for _, srcitem := range srcfeed.Items {
 		dstfeed.Items = append(dstfeed.Items, Item{
-			GUID:    firstNonEmpty(srcitem.ID, srcitem.URL),
-			Date:    dateParse(firstNonEmpty(srcitem.DatePublished, srcitem.DateModified)),
-			URL:     srcitem.URL,
-			Title:   srcitem.Title,
-			Content: firstNonEmpty(srcitem.HTML, srcitem.Text, srcitem.Summary),
+			GUID:        firstNonEmpty(srcitem.ID, srcitem.URL),
+			Date:        dateParse(firstNonEmpty(srcitem.DatePublished, srcitem.DateModified)),
+			DateUpdated: dateParse(srcitem.DateModified),
+			URL:         srcitem.URL,
+			Title:       srcitem.Title,
+			Content:     firstNonEmpty(srcitem.HTML, srcitem.Text, srcitem.Summary),
+
+			Author:     firstNonEmpty(jsonAuthors(srcitem.Author, srcitem.Authors), jsonAuthors(srcfeed.Author, srcfeed.Authors)),
+			Categories: uniqueNonEmpty(srcitem.Tags...),
 		})
 	}
 	return dstfeed, nil
@@ -40,3 +40,30 @@ func TestJSONFeed(t *testing.T) {
 		t.Fatal("invalid json")
 	}
 }
+
+func TestJSONFeedAuthorsTags(t *testing.T) {
+	feed, _ := Parse(strings.NewReader(`{
+		"version": "https://jsonfeed.org/version/1.1",
+		"title": "My Example Feed",
+		"authors": [{"name": "Feed Author"}],
+		"items": [
+			{"id": "1", "authors": [{"name": "Jane"}, {"name": "John"}], "tags": ["news", "tech"]},
+			{"id": "2", "author": {"name": "Bob"}},
+			{"id": "3"}
+		]
+	}`))
+	have := make([][]interface{}, 0)
+	for _, item := range feed.Items {
+		have = append(have, []interface{}{item.Author, item.Categories})
+	}
+	want := [][]interface{}{
+		{"Jane, John", []string{"news", "tech"}},
+		{"Bob", []string(nil)},
+		{"Feed Author", []string(nil)},
+	}
+	if !reflect.DeepEqual(want, have) {
+		t.Logf("want: %#v", want)
+		t.Logf("have: %#v", have)
+		t.Fatal("invalid json")
+	}
+}
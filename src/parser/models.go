@@ -6,6 +6,19 @@ type Feed struct {
 	Title   string
 	SiteURL string
 	Items   []Item
+
+	// WebSub hub & the canonical feed url to subscribe to
+	HubURL  string
+	SelfURL string
+	// new location of the feed announced by the publisher (`itunes:new-feed-url`)
+	NewFeedURL string
+
+	// publisher hints on how often the feed should be checked
+	TTL            time.Duration
+	UpdateInterval time.Duration
+	// hours (in UTC) & days during which the feed should not be checked
+	SkipHours []int
+	SkipDays  []time.Weekday
 }
 
 type Item struct {
@@ -14,8 +27,16 @@ type Item struct {
 	URL   string
 	Title string
 
+	// last modification date, if provided by the feed
+	DateUpdated time.Time
+
 	Content    string
 	MediaLinks []MediaLink
+
+	Author     string
+	Categories []string
+	// link to the discussion page, or the comments feed as a fallback
+	CommentsURL string
 }
 
 type MediaLink struct {
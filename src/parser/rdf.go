@@ -13,6 +13,8 @@ type rdfFeed struct {
 	Title   string    `xml:"channel>title"`
 	Link    string    `xml:"channel>link"`
 	Items   []rdfItem `xml:"item"`
+
+	syndication
 }
 
 type rdfItem struct {
@@ -22,6 +24,10 @@ type rdfItem struct {
 
 	DublinCoreDate string `xml:"http://purl.org/dc/elements/1.1/ date"`
 	ContentEncoded string `xml:"http://purl.org/rss/1.0/modules/content/ encoded"`
+
+	DublinCoreCreators []string `xml:"http://purl.org/dc/elements/1.1/ creator"`
+	DublinCoreSubjects []string `xml:"http://purl.org/dc/elements/1.1/ subject"`
+	CommentRSS         string   `xml:"http://wellformedweb.org/CommentAPI/ commentRss"`
 }
 
 func ParseRDF(r io.Reader) (*Feed, error) {
@@ -35,6 +41,8 @@ func ParseRDF(r io.Reader) (*Feed, error) {
 	dstfeed := &Feed{
 		Title:   srcfeed.Title,
 		SiteURL: srcfeed.Link,
+
+		UpdateInterval: srcfeed.updateInterval(),
 	}
 	for _, srcitem := range srcfeed.Items {
 		dstfeed.Items = append(dstfeed.Items, Item{
@@ -43,6 +51,10 @@ func ParseRDF(r io.Reader) (*Feed, error) {
 			Date:    dateParse(srcitem.DublinCoreDate),
 			Title:   srcitem.Title,
 			Content: firstNonEmpty(srcitem.ContentEncoded, srcitem.Description),
+
+			Author:      joinAuthors(srcitem.DublinCoreCreators...),
+			Categories:  uniqueNonEmpty(srcitem.DublinCoreSubjects...),
+			CommentsURL: srcitem.CommentRSS,
 		})
 	}
 	return dstfeed, nil
@@ -64,13 +64,16 @@ func TestRDFExtensions(t *testing.T) {
 			<item>
 				<dc:date>2006-01-02T15:04:05-07:00</dc:date>
 				<content:encoded><![CDATA[test]]></content:encoded>
+				<dc:creator>Jane</dc:creator>
+				<dc:subject>News</dc:subject>
+				<dc:subject>Tech</dc:subject>
 			</item>
 		</rdf:RDF>
 	`))
 	date, _ := time.Parse(time.RFC1123Z, time.RFC1123Z)
 	want := &Feed{
 		Items: []Item{
-			{Content: "test", Date: date},
+			{Content: "test", Date: date, Author: "Jane", Categories: []string{"News", "Tech"}},
 		},
 	}
 	if !reflect.DeepEqual(want, have) {
@@ -79,3 +82,20 @@ func TestRDFExtensions(t *testing.T) {
 		t.FailNow()
 	}
 }
+
+func TestRDFSyndication(t *testing.T) {
+	feed, _ := Parse(strings.NewReader(`
+		<?xml version="1.0" encoding="utf-8"?>
+		<rdf:RDF xmlns="http://purl.org/rss/1.0/"
+				xmlns:rdf="http://www.w3.org/1999/02/22-rdf-syntax-ns#"
+				xmlns:sy="http://purl.org/rss/1.0/modules/syndication/">
+			<channel>
+				<title>Test</title>
+				<sy:updatePeriod>daily</sy:updatePeriod>
+			</channel>
+		</rdf:RDF>
+	`))
+	if feed.UpdateInterval != time.Hour*24 {
+		t.Fatalf("invalid update interval: %s", feed.UpdateInterval)
+	}
+}
@@ -15,8 +15,17 @@ type rssFeed struct {
 	XMLName xml.Name  `xml:"rss"`
 	Version string    `xml:"version,attr"`
 	Title   string    `xml:"channel>title"`
-	Link    string    `xml:"channel>link"`
+	Link    string    `xml:"rss channel>link"`
 	Items   []rssItem `xml:"channel>item"`
+
+	AtomLinks  atomLinks `xml:"http://www.w3.org/2005/Atom channel>link"`
+	NewFeedURL string    `xml:"http://www.itunes.com/dtds/podcast-1.0.dtd channel>new-feed-url"`
+
+	TTL       string   `xml:"channel>ttl"`
+	SkipHours []string `xml:"channel>skipHours>hour"`
+	SkipDays  []string `xml:"channel>skipDays>day"`
+
+	syndication
 }
 
 type rssItem struct {
@@ -26,10 +35,16 @@ type rssItem struct {
 	Description string         `xml:"rss description"`
 	PubDate     string         `xml:"rss pubDate"`
 	Enclosures  []rssEnclosure `xml:"rss enclosure"`
+	Author      string         `xml:"rss author"`
+	Categories  []string       `xml:"rss category"`
+	Comments    string         `xml:"rss comments"`
 
 	DublinCoreDate string `xml:"http://purl.org/dc/elements/1.1/ date"`
 	ContentEncoded string `xml:"http://purl.org/rss/1.0/modules/content/ encoded"`
 
+	DublinCoreCreators []string `xml:"http://purl.org/dc/elements/1.1/ creator"`
+	CommentRSS         string   `xml:"http://wellformedweb.org/CommentAPI/ commentRss"`
+
 	OrigLink          string `xml:"http://rssnamespace.org/feedburner/ext/1.0 origLink"`
 	OrigEnclosureLink string `xml:"http://rssnamespace.org/feedburner/ext/1.0 origEnclosureLink"`
 
@@ -72,6 +87,15 @@ func ParseRSS(r io.Reader) (*Feed, error) {
 	dstfeed := &Feed{
 		Title:   srcfeed.Title,
 		SiteURL: srcfeed.Link,
+		HubURL:  srcfeed.AtomLinks.First("hub"),
+		SelfURL: srcfeed.AtomLinks.First("self"),
+
+		NewFeedURL: srcfeed.NewFeedURL,
+
+		TTL:            parseTTL(srcfeed.TTL),
+		UpdateInterval: srcfeed.updateInterval(),
+		SkipHours:      parseSkipHours(srcfeed.SkipHours),
+		SkipDays:       parseSkipDays(srcfeed.SkipDays),
 	}
 	for _, srcitem := range srcfeed.Items {
 		mediaLinks := srcitem.mediaLinks()
@@ -98,7 +122,23 @@ func ParseRSS(r io.Reader) (*Feed, error) {
 			Title:      srcitem.Title,
 			Content:    firstNonEmpty(srcitem.ContentEncoded, srcitem.Description, srcitem.firstMediaDescription()),
 			MediaLinks: mediaLinks,
+
+			Author:      firstNonEmpty(joinAuthors(srcitem.DublinCoreCreators...), rssAuthorName(srcitem.Author)),
+			Categories:  uniqueNonEmpty(srcitem.Categories...),
+			CommentsURL: firstNonEmpty(srcitem.Comments, srcitem.CommentRSS),
 		})
 	}
 	return dstfeed, nil
 }
+
+// RSS 2.0 authors are email addresses, optionally followed by the name in parentheses:
+// `lawyer@boyer.net (Lawyer Boyer)`. Prefer the name if present.
+func rssAuthorName(author string) string {
+	author = strings.TrimSpace(author)
+	if open := strings.Index(author, "("); open != -1 && strings.HasSuffix(author, ")") {
+		if name := strings.TrimSpace(author[open+1 : len(author)-1]); name != "" {
+			return name
+		}
+	}
+	return author
+}
@@ -4,6 +4,7 @@ import (
 	"reflect"
 	"strings"
 	"testing"
+	"time"
 )
 
 func TestRSSFeed(t *testing.T) {
@@ -286,3 +287,96 @@ func TestRSSMultipleMedia(t *testing.T) {
 		t.Fatal("invalid rss")
 	}
 }
+
+func TestRSSAuthorsCategoriesComments(t *testing.T) {
+	feed, _ := Parse(strings.NewReader(`
+		<?xml version="1.0" encoding="UTF-8"?>
+		<rss version="2.0"
+			xmlns:dc="http://purl.org/dc/elements/1.1/"
+			xmlns:wfw="http://wellformedweb.org/CommentAPI/">
+		<channel>
+			<item>
+				<guid>1</guid>
+				<author>lawyer@boyer.net (Lawyer Boyer)</author>
+				<category>News</category>
+				<category domain="http://example.com/tags">Tech</category>
+				<comments>http://example.com/1#comments</comments>
+				<wfw:commentRss>http://example.com/1/comments/feed</wfw:commentRss>
+			</item>
+			<item>
+				<guid>2</guid>
+				<author>lawyer@boyer.net</author>
+				<dc:creator>Jane</dc:creator>
+				<dc:creator>John</dc:creator>
+				<wfw:commentRss>http://example.com/2/comments/feed</wfw:commentRss>
+			</item>
+		</channel>
+		</rss>
+	`))
+	have := make([][]interface{}, 0)
+	for _, item := range feed.Items {
+		have = append(have, []interface{}{item.Author, item.Categories, item.CommentsURL})
+	}
+	want := [][]interface{}{
+		{"Lawyer Boyer", []string{"News", "Tech"}, "http://example.com/1#comments"},
+		{"Jane, John", []string(nil), "http://example.com/2/comments/feed"},
+	}
+	if !reflect.DeepEqual(want, have) {
+		t.Logf("want: %#v", want)
+		t.Logf("have: %#v", have)
+		t.Fatal("invalid rss")
+	}
+}
+
+func TestRSSCachingHints(t *testing.T) {
+	feed, _ := Parse(strings.NewReader(`
+		<?xml version="1.0"?>
+		<rss version="2.0" xmlns:sy="http://purl.org/rss/1.0/modules/syndication/">
+		<channel>
+			<ttl>60</ttl>
+			<skipHours><hour>0</hour><hour> 23 </hour><hour>24</hour><hour>x</hour></skipHours>
+			<skipDays><day>Saturday</day><day>sunday</day><day>Funday</day></skipDays>
+			<sy:updatePeriod>hourly</sy:updatePeriod>
+			<sy:updateFrequency>2</sy:updateFrequency>
+		</channel>
+		</rss>
+	`))
+	have := []interface{}{feed.TTL, feed.UpdateInterval, feed.SkipHours, feed.SkipDays}
+	want := []interface{}{
+		time.Hour,
+		time.Minute * 30,
+		[]int{0, 23},
+		[]time.Weekday{time.Saturday, time.Sunday},
+	}
+	if !reflect.DeepEqual(want, have) {
+		t.Logf("want: %#v", want)
+		t.Logf("have: %#v", have)
+		t.Fatal("invalid rss")
+	}
+}
+
+func TestRSSFeedLinks(t *testing.T) {
+	feed, _ := ParseAndFix(strings.NewReader(`
+		<?xml version="1.0"?>
+		<rss version="2.0" xmlns:atom="http://www.w3.org/2005/Atom" xmlns:itunes="http://www.itunes.com/dtds/podcast-1.0.dtd">
+		<channel>
+			<atom:link rel="hub" href="https://hub.example.com/" />
+			<link>https://example.com/</link>
+			<atom:link rel="self" href="/feed.xml" />
+			<itunes:new-feed-url>https://podcasts.example.com/feed.xml</itunes:new-feed-url>
+		</channel>
+		</rss>
+	`), "https://example.com/feed", "")
+	have := []string{feed.SiteURL, feed.HubURL, feed.SelfURL, feed.NewFeedURL}
+	want := []string{
+		"https://example.com/",
+		"https://hub.example.com/",
+		"https://example.com/feed.xml",
+		"https://podcasts.example.com/feed.xml",
+	}
+	if !reflect.DeepEqual(want, have) {
+		t.Logf("want: %#v", want)
+		t.Logf("have: %#v", have)
+		t.Fatal("invalid rss")
+	}
+}
@@ -21,6 +21,26 @@ func firstNonEmpty(vals ...string) string {
 	return ""
 }
 
+// Trim the values, dropping the empty ones & duplicates.
+func uniqueNonEmpty(vals ...string) []string {
+	var result []string
+	seen := make(map[string]bool)
+	for _, val := range vals {
+		val = strings.TrimSpace(val)
+		if val == "" || seen[val] {
+			continue
+		}
+		seen[val] = true
+		result = append(result, val)
+	}
+	return result
+}
+
+// Convert the list of author names into a single comma-separated value.
+func joinAuthors(names ...string) string {
+	return strings.Join(uniqueNonEmpty(names...), ", ")
+}
+
 var linkRe = regexp.MustCompile(`(https?:\/\/\S+)`)
 
 func plain2html(text string) string {
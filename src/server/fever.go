@@ -142,32 +142,40 @@ func joinInts(values []int64) string {
 	return result.String()
 }
 
+// Folders are flattened into groups: a group holds the feeds of the folder and its subfolders.
 func feedGroups(db *storage.Storage) []*FeverFeedsGroup {
-	feeds := db.ListFeeds()
-
-	groupFeeds := make(map[int64][]int64)
-	for _, feed := range feeds {
-		if feed.FolderId == nil {
-			continue
-		}
-		groupFeeds[*feed.FolderId] = append(groupFeeds[*feed.FolderId], feed.Id)
-	}
 	result := make([]*FeverFeedsGroup, 0)
-	for groupId, feedIds := range groupFeeds {
+	for groupId, feedIds := range db.ListFolderFeedIDs() {
 		result = append(result, &FeverFeedsGroup{
 			GroupID: groupId,
 			FeedIDs: joinInts(feedIds),
 		})
 	}
+	for _, smartFeed := range db.ListSmartFeeds() {
+		result = append(result, &FeverFeedsGroup{
+			GroupID: smartFeed.Id + feverSmartFeedGroupOffset,
+			FeedIDs: joinInts(db.ListSmartFeedFeedIDs(smartFeed.Id)),
+		})
+	}
 	return result
 }
 
+// Smart feeds are exposed as groups containing the feeds of the matching items.
+// Their ids are shifted to avoid clashing with the folder ids.
+const feverSmartFeedGroupOffset = 1 << 30
+
 func (s *Server) feverGroupsHandler(c *router.Context) {
 	folders := s.db.ListFolders()
 	groups := make([]*FeverGroup, len(folders))
 	for i, folder := range folders {
 		groups[i] = &FeverGroup{ID: folder.Id, Title: folder.Title}
 	}
+	for _, smartFeed := range s.db.ListSmartFeeds() {
+		groups = append(groups, &FeverGroup{
+			ID:    smartFeed.Id + feverSmartFeedGroupOffset,
+			Title: smartFeed.Title,
+		})
+	}
 	writeFeverJSON(c, map[string]interface{}{
 		"groups":       groups,
 		"feeds_groups": feedGroups(s.db),
@@ -269,7 +277,7 @@ func (s *Server) feverItemsHandler(c *router.Context) {
 			ID:        item.Id,
 			FeedID:    item.FeedId,
 			Title:     item.Title,
-			Author:    "",
+			Author:    item.Author,
 			HTML:      item.Content,
 			Url:       item.Link,
 			IsSaved:   isSaved,
@@ -359,7 +367,7 @@ func (s *Server) feverMarkHandler(c *router.Context) {
 			c.Out.WriteHeader(http.StatusBadRequest)
 			return
 		}
-		s.db.UpdateItemStatus(id, status)
+		s.updateItemStatus(id, status)
 	case "feed":
 		if c.Req.Form.Get("as") != "read" {
 			c.Out.WriteHeader(http.StatusBadRequest)
@@ -381,7 +389,11 @@ func (s *Server) feverMarkHandler(c *router.Context) {
 			before := time.Unix(x, 0)
 			markFilter.Before = &before
 		}
-		s.db.MarkItemsRead(markFilter)
+		if id >= feverSmartFeedGroupOffset {
+			s.db.MarkSmartFeedRead(id-feverSmartFeedGroupOffset, markFilter.Before)
+		} else {
+			s.db.MarkItemsRead(markFilter)
+		}
 	default:
 		c.Out.WriteHeader(http.StatusBadRequest)
 		return
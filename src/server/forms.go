@@ -1,9 +1,14 @@
 package server
 
-import "github.com/nkanaev/yarr/src/storage"
+import (
+	"time"
+
+	"github.com/nkanaev/yarr/src/storage"
+)
 
 type ItemUpdateForm struct {
 	Status *storage.ItemStatus `json:"status,omitempty"`
+	Tags   *[]int64            `json:"tags,omitempty"`
 }
 
 type FolderCreateForm struct {
@@ -15,9 +20,53 @@ type FolderUpdateForm struct {
 	Title      *string `json:"title,omitempty"`
 	ParentID   *int64  `json:"parent_id,omitempty"`
 	IsExpanded *bool   `json:"is_expanded,omitempty"`
+
+	Retention *storage.RetentionPolicy `json:"retention,omitempty"`
+}
+
+type FolderMoveForm struct {
+	// nil moves the folder to the top level
+	ParentID *int64 `json:"parent_id"`
+}
+
+type FolderMergeForm struct {
+	// folder receiving the feeds & subfolders
+	FolderID int64 `json:"folder_id"`
 }
 
 type FeedCreateForm struct {
 	Url      string `json:"url"`
 	FolderID *int64 `json:"folder_id,omitempty"`
+
+	RequestOptions *storage.RequestOptions `json:"request_options,omitempty"`
+	// scrape the items from the page at the url instead of discovering its feed
+	Selectors *storage.FeedSelectors `json:"selectors,omitempty"`
+}
+
+type TagForm struct {
+	Title string `json:"title"`
+}
+
+type SmartFeedForm struct {
+	Title  *string                  `json:"title,omitempty"`
+	Filter *storage.SmartFeedFilter `json:"filter,omitempty"`
+}
+
+type RuleTestForm struct {
+	// either the rule being edited or the id of the stored one
+	Rule *storage.Rule `json:"rule,omitempty"`
+	ID   *int64        `json:"id,omitempty"`
+	// number of the latest items to test the rule against
+	Limit int `json:"limit,omitempty"`
+}
+
+type PlaybackForm struct {
+	// url of the audio/video enclosure being played
+	URL string `json:"url"`
+	// in seconds
+	Position  float64 `json:"position"`
+	Duration  float64 `json:"duration"`
+	Completed bool    `json:"completed"`
+	// when the progress was made on the device, defaults to the time of the request
+	UpdatedAt *time.Time `json:"updated_at,omitempty"`
 }
@@ -13,6 +13,11 @@ type gzipResponseWriter struct {
 
 	out *gzip.Writer
 	src http.ResponseWriter
+
+	// the encoding is decided once the headers are written
+	started bool
+	// the responses serving byte ranges (see `http.ServeContent`) are left uncompressed
+	passthrough bool
 }
 
 func (rw *gzipResponseWriter) Header() http.Header {
@@ -20,13 +25,41 @@ func (rw *gzipResponseWriter) Header() http.Header {
 }
 
 func (rw *gzipResponseWriter) Write(x []byte) (int, error) {
+	if !rw.started {
+		rw.WriteHeader(http.StatusOK)
+	}
+	if rw.passthrough {
+		return rw.src.Write(x)
+	}
 	return rw.out.Write(x)
 }
 
 func (rw *gzipResponseWriter) WriteHeader(statusCode int) {
+	if !rw.started {
+		rw.start()
+	}
 	rw.src.WriteHeader(statusCode)
 }
 
+func (rw *gzipResponseWriter) start() {
+	rw.started = true
+	if rw.src.Header().Get("Accept-Ranges") != "" {
+		rw.passthrough = true
+		return
+	}
+	rw.src.Header().Set("Content-Encoding", "gzip")
+	rw.src.Header().Del("Content-Length")
+}
+
+func (rw *gzipResponseWriter) close() {
+	if !rw.started {
+		rw.start()
+	}
+	if !rw.passthrough {
+		rw.out.Close()
+	}
+}
+
 func Middleware(c *router.Context) {
 	if !strings.Contains(c.Req.Header.Get("Accept-Encoding"), "gzip") {
 		c.Next()
@@ -34,9 +67,8 @@ func Middleware(c *router.Context) {
 	}
 
 	gz := &gzipResponseWriter{out: gzip.NewWriter(c.Out), src: c.Out}
-	defer gz.out.Close()
+	defer gz.close()
 
-	c.Out.Header().Set("Content-Encoding", "gzip")
 	c.Out = gz
 
 	c.Next()
@@ -1,11 +1,15 @@
 package server
 
 import (
+	"bytes"
 	"crypto/md5"
 	"encoding/json"
 	"fmt"
+	"io"
 	"log"
+	"mime"
 	"net/http"
+	"os"
 	"path/filepath"
 	"reflect"
 	"strconv"
@@ -13,10 +17,12 @@ import (
 	"time"
 
 	"github.com/nkanaev/yarr/src/assets"
+	"github.com/nkanaev/yarr/src/content/htmldiff"
 	"github.com/nkanaev/yarr/src/content/htmlutil"
 	"github.com/nkanaev/yarr/src/content/readability"
 	"github.com/nkanaev/yarr/src/content/sanitizer"
 	"github.com/nkanaev/yarr/src/content/silo"
+	"github.com/nkanaev/yarr/src/parser"
 	"github.com/nkanaev/yarr/src/server/auth"
 	"github.com/nkanaev/yarr/src/server/gzip"
 	"github.com/nkanaev/yarr/src/server/opml"
@@ -37,7 +43,7 @@ func (s *Server) handler() http.Handler {
 			BasePath: s.BasePath,
 			Username: s.Username,
 			Password: s.Password,
-			Public:   []string{"/static", "/fever", "/manifest.json"},
+			Public:   []string{"/static", "/fever", "/websub", "/manifest.json"},
 			DB:       s.db,
 		}
 		r.Use(a.Handler)
@@ -50,22 +56,48 @@ func (s *Server) handler() http.Handler {
 	r.For("/api/folders", s.handleFolderList)
 	r.For("/api/folders/reorder", s.handleFolderReorder)
 	r.For("/api/folders/:id", s.handleFolder)
+	r.For("/api/folders/:id/move", s.handleFolderMove)
+	r.For("/api/folders/:id/merge", s.handleFolderMerge)
+	r.For("/api/folders/:id/refresh", s.handleFolderRefreshNow)
 	r.For("/api/feeds", s.handleFeedList)
 	r.For("/api/feeds/reorder", s.handleFeedReorder)
 	r.For("/api/feeds/refresh", s.handleFeedRefresh)
 	r.For("/api/feeds/errors", s.handleFeedErrors)
+	r.For("/api/feeds/dead", s.handleFeedsDead)
 	r.For("/api/feeds/:id/icon", s.handleFeedIcon)
 	r.For("/api/feeds/:id", s.handleFeed)
+	r.For("/api/feeds/:id/history", s.handleFeedHistory)
+	r.For("/api/feeds/:id/refresh", s.handleFeedRefreshNow)
 	r.For("/api/items", s.handleItemList)
 	r.For("/api/items/:id", s.handleItem)
+	r.For("/api/items/:id/revisions", s.handleItemRevisions)
 	r.For("/api/items/:id/summarize", s.handleItemSummarize)
 	r.For("/api/items/:id/translate", s.handleItemTranslate)
+	r.For("/api/items/:id/playback", s.handleItemPlayback)
+	r.For("/api/playback", s.handlePlaybackList)
+	r.For("/api/media/:id", s.handleMedia)
+	r.For("/api/smartfeeds", s.handleSmartFeedList)
+	r.For("/api/smartfeeds/:id", s.handleSmartFeed)
+	r.For("/api/rules", s.handleRuleList)
+	r.For("/api/rules/test", s.handleRuleTest)
+	r.For("/api/rules/:id", s.handleRule)
+	r.For("/api/webhooks", s.handleWebhookList)
+	r.For("/api/webhooks/:id", s.handleWebhook)
+	r.For("/api/webhooks/:id/deliveries", s.handleWebhookDeliveries)
+	r.For("/api/digests", s.handleDigestList)
+	r.For("/api/digests/:id", s.handleDigest)
+	r.For("/api/digests/:id/preview", s.handleDigestPreview)
+	r.For("/api/digests/:id/send", s.handleDigestSend)
+	r.For("/api/tags", s.handleTagList)
+	r.For("/api/tags/:id", s.handleTag)
 	r.For("/api/settings", s.handleSettings)
+	r.For("/api/backup", s.handleBackup)
 	r.For("/opml/import", s.handleOPMLImport)
 	r.For("/opml/export", s.handleOPMLExport)
 	r.For("/page", s.handlePageCrawl)
 	r.For("/logout", s.handleLogout)
 	r.For("/fever/", s.handleFever)
+	r.For("/websub/:id", s.handleWebSub)
 
 	return r
 }
@@ -107,8 +139,10 @@ func (s *Server) handleManifest(c *router.Context) {
 
 func (s *Server) handleStatus(c *router.Context) {
 	c.JSON(http.StatusOK, map[string]interface{}{
-		"running": s.worker.FeedsPending(),
-		"stats":   s.db.FeedStats(),
+		"running":         s.worker.FeedsPending(),
+		"stats":           s.db.FeedStats(),
+		"folder_stats":    s.db.FolderStats(),
+		"smartfeed_stats": s.db.SmartFeedStats(),
 	})
 }
 
@@ -166,27 +200,113 @@ func (s *Server) handleFolder(c *router.Context) {
 	}
 	if c.Req.Method == "PUT" {
 		var body FolderUpdateForm
-		if err := json.NewDecoder(c.Req.Body).Decode(&body); err != nil {
+		// the fields present in the body, `"retention": null` clears the policy
+		var fields map[string]json.RawMessage
+		data, err := io.ReadAll(c.Req.Body)
+		if err == nil {
+			err = json.Unmarshal(data, &body)
+		}
+		if err == nil {
+			err = json.Unmarshal(data, &fields)
+		}
+		if err != nil {
 			log.Print(err)
 			c.Out.WriteHeader(http.StatusBadRequest)
 			return
 		}
-		if body.Title != nil {
-			s.db.RenameFolder(id, *body.Title)
+		_, hasRetention := fields["retention"]
+		if body.Retention != nil && !body.Retention.IsValid() {
+			c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid retention policy."})
+			return
 		}
-		if body.ParentID != nil {
-			s.db.UpdateFolderParent(id, body.ParentID)
+		if body.Title != nil || body.ParentID != nil {
+			switch err := s.db.UpdateFolder(id, body.Title, body.ParentID); err {
+			case nil:
+			case storage.ErrNotFound:
+				c.Out.WriteHeader(http.StatusNotFound)
+				return
+			case storage.ErrConflict:
+				c.JSON(http.StatusConflict, map[string]string{"error": "Folder title already in use."})
+				return
+			case storage.ErrFolderCycle:
+				c.JSON(http.StatusBadRequest, map[string]string{"error": "Unable to move the folder."})
+				return
+			default:
+				c.Out.WriteHeader(http.StatusInternalServerError)
+				return
+			}
 		}
 		if body.IsExpanded != nil {
 			s.db.ToggleFolderExpanded(id, *body.IsExpanded)
 		}
+		if hasRetention {
+			s.db.UpdateFolderRetention(id, body.Retention)
+		}
 		c.Out.WriteHeader(http.StatusOK)
 	} else if c.Req.Method == "DELETE" {
-		s.db.DeleteFolder(id)
+		mode := storage.FolderDeleteMode(c.Req.URL.Query().Get("mode"))
+		switch mode {
+		case "":
+			mode = storage.FolderDeleteReparent
+		case storage.FolderDeleteReparent, storage.FolderDeleteCascade:
+		default:
+			c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid delete mode."})
+			return
+		}
+		if !s.db.DeleteFolder(id, mode) {
+			c.Out.WriteHeader(http.StatusBadRequest)
+			return
+		}
 		c.Out.WriteHeader(http.StatusNoContent)
 	}
 }
 
+func (s *Server) handleFolderMove(c *router.Context) {
+	id, err := c.VarInt64("id")
+	if err != nil {
+		c.Out.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	if c.Req.Method != "POST" {
+		c.Out.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	var body FolderMoveForm
+	if err := json.NewDecoder(c.Req.Body).Decode(&body); err != nil {
+		log.Print(err)
+		c.Out.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	if !s.db.UpdateFolderParent(id, body.ParentID) {
+		c.JSON(http.StatusBadRequest, map[string]string{"error": "Unable to move the folder."})
+		return
+	}
+	c.Out.WriteHeader(http.StatusOK)
+}
+
+func (s *Server) handleFolderMerge(c *router.Context) {
+	id, err := c.VarInt64("id")
+	if err != nil {
+		c.Out.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	if c.Req.Method != "POST" {
+		c.Out.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	var body FolderMergeForm
+	if err := json.NewDecoder(c.Req.Body).Decode(&body); err != nil {
+		log.Print(err)
+		c.Out.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	if !s.db.MergeFolders(id, body.FolderID) {
+		c.JSON(http.StatusBadRequest, map[string]string{"error": "Unable to merge the folders."})
+		return
+	}
+	c.Out.WriteHeader(http.StatusOK)
+}
+
 func (s *Server) handleFeedRefresh(c *router.Context) {
 	if c.Req.Method == "POST" {
 		s.worker.RefreshFeeds()
@@ -196,11 +316,105 @@ func (s *Server) handleFeedRefresh(c *router.Context) {
 	}
 }
 
+// Refresh the feed right away, returning the outcome of the fetch.
+func (s *Server) handleFeedRefreshNow(c *router.Context) {
+	if c.Req.Method != "POST" {
+		c.Out.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	id, err := c.VarInt64("id")
+	if err != nil {
+		c.Out.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	feed := s.db.GetFeed(id)
+	if feed == nil {
+		c.Out.WriteHeader(http.StatusNotFound)
+		return
+	}
+	feed.Icon = nil
+	c.JSON(http.StatusOK, s.worker.RefreshFeedsNow([]storage.Feed{*feed})[0])
+}
+
+// Refresh the active feeds of the folder & its subfolders right away, returning the outcome of each fetch.
+func (s *Server) handleFolderRefreshNow(c *router.Context) {
+	if c.Req.Method != "POST" {
+		c.Out.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	id, err := c.VarInt64("id")
+	if err != nil {
+		c.Out.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	found := false
+	for _, folder := range s.db.ListFolders() {
+		found = found || folder.Id == id
+	}
+	if !found {
+		c.Out.WriteHeader(http.StatusNotFound)
+		return
+	}
+	feedIds := make(map[int64]bool)
+	for _, feedId := range s.db.ListFolderFeedIDs()[id] {
+		feedIds[feedId] = true
+	}
+	feeds := make([]storage.Feed, 0)
+	for _, feed := range s.db.ListFeeds() {
+		if feedIds[feed.Id] && feed.PausedAt == nil {
+			feeds = append(feeds, feed)
+		}
+	}
+	c.JSON(http.StatusOK, s.worker.RefreshFeedsNow(feeds))
+}
+
 func (s *Server) handleFeedErrors(c *router.Context) {
 	errors := s.db.GetFeedErrors()
 	c.JSON(http.StatusOK, errors)
 }
 
+// Feeds failing to refresh for the given number of days (7 by default), and the paused ones.
+func (s *Server) handleFeedsDead(c *router.Context) {
+	if c.Req.Method != "GET" {
+		c.Out.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	days := int64(7)
+	if c.Req.URL.Query().Has("days") {
+		var err error
+		if days, err = c.QueryInt64("days"); err != nil || days < 0 {
+			c.Out.WriteHeader(http.StatusBadRequest)
+			return
+		}
+	}
+	failingBefore := time.Now().Add(-time.Hour * 24 * time.Duration(days))
+	c.JSON(http.StatusOK, s.db.ListFailingFeeds(failingBefore))
+}
+
+func (s *Server) handleFeedHistory(c *router.Context) {
+	if c.Req.Method != "GET" {
+		c.Out.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	id, err := c.VarInt64("id")
+	if err != nil {
+		c.Out.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	if s.db.GetFeed(id) == nil {
+		c.Out.WriteHeader(http.StatusNotFound)
+		return
+	}
+	limit := int64(100)
+	if c.Req.URL.Query().Has("limit") {
+		if limit, err = c.QueryInt64("limit"); err != nil || limit <= 0 {
+			c.Out.WriteHeader(http.StatusBadRequest)
+			return
+		}
+	}
+	c.JSON(http.StatusOK, s.db.ListFeedFetches(id, int(limit)))
+}
+
 type feedicon struct {
 	ctype string
 	bytes []byte
@@ -264,8 +478,20 @@ func (s *Server) handleFeedList(c *router.Context) {
 			return
 		}
 
-		result, err := worker.DiscoverFeed(form.Url)
+		var result *worker.DiscoverResult
+		var err error
+		if form.Selectors != nil {
+			var feed *parser.Feed
+			if feed, err = worker.ScrapeFeed(form.Url, *form.Selectors, form.RequestOptions); err == nil {
+				result = &worker.DiscoverResult{Feed: feed, FeedLink: form.Url}
+			}
+		} else {
+			result, err = worker.DiscoverFeed(form.Url, form.RequestOptions)
+		}
 		switch {
+		case err != nil && form.Selectors != nil:
+			log.Printf("Failed to scrape feed from %s: %s", form.Url, err)
+			c.JSON(http.StatusOK, map[string]string{"status": "notfound", "error": err.Error()})
 		case err != nil:
 			log.Printf("Faild to discover feed for %s: %s", form.Url, err)
 			c.JSON(http.StatusOK, map[string]string{"status": "notfound"})
@@ -279,12 +505,19 @@ func (s *Server) handleFeedList(c *router.Context) {
 				result.FeedLink,
 				form.FolderID,
 			)
+			if form.RequestOptions != nil {
+				s.db.UpdateFeedRequestOptions(feed.Id, form.RequestOptions)
+			}
+			if form.Selectors != nil {
+				s.db.UpdateFeedSelectors(feed.Id, form.Selectors)
+			}
 			items := worker.ConvertItems(result.Feed.Items, *feed)
 			if len(items) > 0 {
-				s.db.CreateItems(items)
+				s.db.CreateItems(s.db.LoadRules().Apply(items))
 				s.db.SetFeedSize(feed.Id, len(items))
 				s.db.SyncSearch()
 			}
+			s.db.SetFeedChecked(feed.Id)
 			s.worker.FindFeedFavicon(*feed)
 
 			c.JSON(http.StatusOK, map[string]interface{}{
@@ -303,7 +536,42 @@ func (s *Server) handleFeed(c *router.Context) {
 		c.Out.WriteHeader(http.StatusBadRequest)
 		return
 	}
-	if c.Req.Method == "PUT" {
+	if c.Req.Method == "GET" {
+		feed := s.db.GetFeed(id)
+		if feed == nil {
+			c.Out.WriteHeader(http.StatusNotFound)
+			return
+		}
+		// secrets are write-only
+		var options *storage.RequestOptions
+		if stored := s.db.GetFeedRequestOptions(id); stored != nil {
+			masked := stored.Masked()
+			options = &masked
+		}
+		result := struct {
+			*storage.Feed
+			RequestOptions *storage.RequestOptions `json:"request_options"`
+			LastCheck      *time.Time              `json:"last_check"`
+			NextCheck      *time.Time              `json:"next_check"`
+			FetchDuration  *int64                  `json:"fetch_duration_ms"`
+			PreviousLinks  []storage.FeedAlias     `json:"previous_links"`
+			Selectors      *storage.FeedSelectors  `json:"selectors"`
+		}{
+			Feed:           feed,
+			RequestOptions: options,
+			PreviousLinks:  s.db.ListFeedAliases(id),
+			Selectors:      s.db.GetFeedSelectors(id),
+		}
+		if schedule := s.db.GetFeedSchedule(id); schedule != nil {
+			result.LastCheck = &schedule.LastCheck
+			result.NextCheck = schedule.NextCheck
+			if schedule.FetchDuration != nil {
+				ms := schedule.FetchDuration.Milliseconds()
+				result.FetchDuration = &ms
+			}
+		}
+		c.JSON(http.StatusOK, result)
+	} else if c.Req.Method == "PUT" {
 		feed := s.db.GetFeed(id)
 		if feed == nil {
 			c.Out.WriteHeader(http.StatusBadRequest)
@@ -315,23 +583,118 @@ func (s *Server) handleFeed(c *router.Context) {
 			c.Out.WriteHeader(http.StatusBadRequest)
 			return
 		}
+		// the whole body is validated before any of the changes are saved
+		updates := make([]func(), 0)
 		if title, ok := body["title"]; ok {
 			if reflect.TypeOf(title).Kind() == reflect.String {
-				s.db.RenameFeed(id, title.(string))
+				updates = append(updates, func() { s.db.RenameFeed(id, title.(string)) })
 			}
 		}
 		if f_id, ok := body["folder_id"]; ok {
 			if f_id == nil {
-				s.db.UpdateFeedFolder(id, nil)
+				updates = append(updates, func() { s.db.UpdateFeedFolder(id, nil) })
 			} else if reflect.TypeOf(f_id).Kind() == reflect.Float64 {
 				folderId := int64(f_id.(float64))
-				s.db.UpdateFeedFolder(id, &folderId)
+				updates = append(updates, func() { s.db.UpdateFeedFolder(id, &folderId) })
 			}
 		}
 		if link, ok := body["feed_link"]; ok {
 			if reflect.TypeOf(link).Kind() == reflect.String {
-				s.db.UpdateFeedLink(id, link.(string))
+				updates = append(updates, func() { s.db.UpdateFeedLink(id, link.(string)) })
+			}
+		}
+		if retention, ok := body["retention"]; ok {
+			var policy *storage.RetentionPolicy
+			if retention != nil {
+				policy = &storage.RetentionPolicy{}
+				if data, err := json.Marshal(retention); err != nil || json.Unmarshal(data, policy) != nil || !policy.IsValid() {
+					c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid retention policy."})
+					return
+				}
+			}
+			updates = append(updates, func() { s.db.UpdateFeedRetention(id, policy) })
+		}
+		if interval, ok := body["refresh_interval"]; ok {
+			if interval == nil {
+				updates = append(updates, func() { s.db.UpdateFeedRefreshInterval(id, nil) })
+			} else if value, isNumber := interval.(float64); isNumber && value >= 1 {
+				minutes := int64(value)
+				updates = append(updates, func() { s.db.UpdateFeedRefreshInterval(id, &minutes) })
+			} else {
+				c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid refresh interval."})
+				return
+			}
+		}
+		if paused, ok := body["paused"]; ok {
+			if value, isBool := paused.(bool); isBool {
+				updates = append(updates, func() { s.db.UpdateFeedPaused(id, value) })
+			} else {
+				c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid paused value."})
+				return
+			}
+		}
+		if fetchFullContent, ok := body["fetch_full_content"]; ok {
+			if value, isBool := fetchFullContent.(bool); isBool {
+				updates = append(updates, func() { s.db.UpdateFeedFetchFullContent(id, value) })
+			} else {
+				c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid full content value."})
+				return
+			}
+		}
+		if value, ok := body["request_options"]; ok {
+			var options *storage.RequestOptions
+			if value != nil {
+				options = &storage.RequestOptions{}
+				if data, err := json.Marshal(value); err != nil || json.Unmarshal(data, options) != nil {
+					c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid request options."})
+					return
+				}
+				// the masked secrets are left unchanged
+				prev := storage.RequestOptions{}
+				if stored := s.db.GetFeedRequestOptions(id); stored != nil {
+					prev = *stored
+				}
+				unmasked := options.Unmasked(prev)
+				options = &unmasked
+			}
+			updates = append(updates, func() { s.db.UpdateFeedRequestOptions(id, options) })
+		}
+		if value, ok := body["media_download"]; ok {
+			var policy *storage.MediaDownloadPolicy
+			if value != nil {
+				policy = &storage.MediaDownloadPolicy{}
+				if data, err := json.Marshal(value); err != nil || json.Unmarshal(data, policy) != nil || !policy.IsValid() {
+					c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid media download policy."})
+					return
+				}
+			}
+			updates = append(updates, func() {
+				s.db.UpdateFeedMediaDownload(id, policy)
+				if policy != nil {
+					go s.worker.SyncMedia()
+				}
+			})
+		}
+		if value, ok := body["selectors"]; ok {
+			var selectors *storage.FeedSelectors
+			if value != nil {
+				selectors = &storage.FeedSelectors{}
+				data, err := json.Marshal(value)
+				if err == nil {
+					err = json.Unmarshal(data, selectors)
+				}
+				if err == nil {
+					err = parser.Selectors(*selectors).Validate()
+				}
+				if err != nil {
+					c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid selectors: " + err.Error()})
+					return
+				}
 			}
+			updates = append(updates, func() { s.db.UpdateFeedSelectors(id, selectors) })
+		}
+		for _, update := range updates {
+			update()
 		}
 		c.Out.WriteHeader(http.StatusOK)
 	} else if c.Req.Method == "DELETE" {
@@ -362,6 +725,31 @@ func (s *Server) handleItem(c *router.Context) {
 			}
 		}
 
+		// the article extracted from the page is preferred, unless the feed content is requested
+		source := c.Req.URL.Query().Get("content")
+		if source == "" {
+			source = "feed"
+			if item.FullContent != nil {
+				source = "full"
+			}
+		}
+		switch source {
+		case "feed":
+		case "full":
+			if item.FullContent == nil {
+				c.JSON(http.StatusBadRequest, map[string]string{"error": "Full content not available."})
+				return
+			}
+			item.Content = *item.FullContent
+		default:
+			c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid content version."})
+			return
+		}
+		item.ContentSource = source
+		item.HasFullContent = item.FullContent != nil
+		item.Media = s.db.ListItemMedia(item.Id)
+		item.Playback = s.db.GetItemPlayback(item.Id)
+
 		item.Content = sanitizer.Sanitize(item.Link, item.Content)
 		for i, link := range item.MediaLinks {
 			item.MediaLinks[i].Description = sanitizer.Sanitize(item.Link, link.Description)
@@ -376,7 +764,10 @@ func (s *Server) handleItem(c *router.Context) {
 			return
 		}
 		if body.Status != nil {
-			s.db.UpdateItemStatus(id, *body.Status)
+			s.updateItemStatus(id, *body.Status)
+		}
+		if body.Tags != nil {
+			s.db.SetItemTags(id, *body.Tags)
 		}
 		c.Out.WriteHeader(http.StatusOK)
 	} else {
@@ -384,98 +775,878 @@ func (s *Server) handleItem(c *router.Context) {
 	}
 }
 
-func (s *Server) handleItemList(c *router.Context) {
-	if c.Req.Method == "GET" {
-		perPage := 20
-		query := c.Req.URL.Query()
+// Update the status of the item, notifying the webhooks if it gets starred.
+func (s *Server) updateItemStatus(id int64, status storage.ItemStatus) {
+	var item *storage.Item
+	if status == storage.STARRED {
+		item = s.db.GetItem(id)
+	}
+	s.db.UpdateItemStatus(id, status)
+	if item != nil && item.Status != storage.STARRED {
+		item.Status = status
+		s.worker.NotifyItemStarred(*item)
+	}
+}
 
-		filter := storage.ItemFilter{}
-		if folderID, err := c.QueryInt64("folder_id"); err == nil {
-			filter.FolderID = &folderID
+// Progress of the playback of the enclosure, synced across the devices.
+// The completed playback marks the item read. The outdated progress is ignored,
+// responding with the saved one.
+func (s *Server) handleItemPlayback(c *router.Context) {
+	id, err := c.VarInt64("id")
+	if err != nil {
+		c.Out.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	if c.Req.Method == "GET" {
+		if s.db.GetItem(id) == nil {
+			c.Out.WriteHeader(http.StatusNotFound)
+			return
 		}
-		if feedID, err := c.QueryInt64("feed_id"); err == nil {
-			filter.FeedID = &feedID
+		c.JSON(http.StatusOK, s.db.GetItemPlayback(id))
+	} else if c.Req.Method == "PUT" {
+		item := s.db.GetItem(id)
+		if item == nil {
+			c.Out.WriteHeader(http.StatusNotFound)
+			return
 		}
-		if after, err := c.QueryInt64("after"); err == nil {
-			filter.After = &after
+		var body PlaybackForm
+		if err := json.NewDecoder(c.Req.Body).Decode(&body); err != nil {
+			log.Print(err)
+			c.Out.WriteHeader(http.StatusBadRequest)
+			return
 		}
-		if status := query.Get("status"); len(status) != 0 {
-			statusValue := storage.StatusValues[status]
-			filter.Status = &statusValue
+		playable := false
+		for _, link := range item.MediaLinks {
+			if link.URL == body.URL && (link.Type == "audio" || link.Type == "video") {
+				playable = true
+				break
+			}
 		}
-		if search := query.Get("search"); len(search) != 0 {
-			filter.Search = &search
+		if !playable {
+			c.JSON(http.StatusBadRequest, map[string]string{"error": "Not an audio/video enclosure of the item."})
+			return
 		}
-		newestFirst := query.Get("oldest_first") != "true"
-
-		items := s.db.ListItems(filter, perPage+1, newestFirst, true)
-		hasMore := false
-		if len(items) == perPage+1 {
-			hasMore = true
-			items = items[:perPage]
+		if body.Position < 0 || body.Duration < 0 {
+			c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid position."})
+			return
 		}
-
-		for i, item := range items {
-			if item.Title == "" {
-				text := htmlutil.ExtractText(item.Content)
-				items[i].Title = htmlutil.TruncateText(text, 140)
-			}
+		update := storage.ItemPlayback{
+			ItemID:    id,
+			URL:       body.URL,
+			Position:  body.Position,
+			Duration:  body.Duration,
+			Completed: body.Completed,
 		}
-		c.JSON(http.StatusOK, map[string]interface{}{
-			"list":     items,
-			"has_more": hasMore,
-		})
-	} else if c.Req.Method == "PUT" {
-		filter := storage.MarkFilter{}
-
-		if folderID, err := c.QueryInt64("folder_id"); err == nil {
-			filter.FolderID = &folderID
+		if body.UpdatedAt != nil {
+			update.UpdatedAt = *body.UpdatedAt
 		}
-		if feedID, err := c.QueryInt64("feed_id"); err == nil {
-			filter.FeedID = &feedID
+		playback := s.db.UpdateItemPlayback(update)
+		if playback == nil {
+			c.Out.WriteHeader(http.StatusInternalServerError)
+			return
 		}
-		s.db.MarkItemsRead(filter)
-		c.Out.WriteHeader(http.StatusOK)
+		c.JSON(http.StatusOK, playback)
 	} else {
 		c.Out.WriteHeader(http.StatusMethodNotAllowed)
 	}
 }
 
-func (s *Server) handleSettings(c *router.Context) {
-	if c.Req.Method == "GET" {
-		c.JSON(http.StatusOK, s.db.GetSettings())
-	} else if c.Req.Method == "PUT" {
-		settings := make(map[string]interface{})
-		if err := json.NewDecoder(c.Req.Body).Decode(&settings); err != nil {
+// Items with the playback in progress ("continue listening"), the most recently played first.
+func (s *Server) handlePlaybackList(c *router.Context) {
+	if c.Req.Method != "GET" {
+		c.Out.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	limit := int64(20)
+	if c.Req.URL.Query().Has("limit") {
+		var err error
+		if limit, err = c.QueryInt64("limit"); err != nil || limit <= 0 {
 			c.Out.WriteHeader(http.StatusBadRequest)
 			return
 		}
-		if s.db.UpdateSettings(settings) {
-			if _, ok := settings["refresh_rate"]; ok {
-				s.worker.SetRefreshRate(s.db.GetSettingsValueInt64("refresh_rate"))
-			}
-			c.Out.WriteHeader(http.StatusOK)
-		} else {
-			c.Out.WriteHeader(http.StatusBadRequest)
-		}
 	}
+	c.JSON(http.StatusOK, s.db.ListContinueListening(int(limit)))
 }
 
-func (s *Server) handleOPMLImport(c *router.Context) {
-	if c.Req.Method == "POST" {
-		file, _, err := c.Req.FormFile("opml")
-		if err != nil {
-			log.Print(err)
-			return
-		}
-		doc, err := opml.Parse(file)
-		if err != nil {
-			log.Print(err)
-			c.Out.WriteHeader(http.StatusBadRequest)
-			return
-		}
-
-		var importFolder func(f opml.Folder, parentID *int64)
+// Downloaded enclosure, with the support of the range requests for seeking.
+func (s *Server) handleMedia(c *router.Context) {
+	if c.Req.Method != "GET" && c.Req.Method != "HEAD" {
+		c.Out.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	id, err := c.VarInt64("id")
+	if err != nil {
+		c.Out.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	media := s.db.GetItemMedia(id)
+	if media == nil || media.Status != storage.MediaDone {
+		c.Out.WriteHeader(http.StatusNotFound)
+		return
+	}
+	path := s.worker.MediaFile(*media)
+	if path == "" {
+		c.Out.WriteHeader(http.StatusNotFound)
+		return
+	}
+	file, err := os.Open(path)
+	if err != nil {
+		log.Print(err)
+		c.Out.WriteHeader(http.StatusNotFound)
+		return
+	}
+	defer file.Close()
+	info, err := file.Stat()
+	if err != nil {
+		log.Print(err)
+		c.Out.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	// the files come from the feeds, so nothing able to run the scripts is served as is
+	c.Out.Header().Set("Content-Type", mediaContentType(media.ContentType))
+	c.Out.Header().Set("X-Content-Type-Options", "nosniff")
+	c.Out.Header().Set("Content-Security-Policy", "sandbox")
+	http.ServeContent(c.Out, c.Req, filepath.Base(path), info.ModTime(), file)
+}
+
+// Content type of the downloaded enclosure, limited to the audio, video & raster images.
+func mediaContentType(contentType string) string {
+	mediatype, _, err := mime.ParseMediaType(contentType)
+	if err == nil {
+		kind, _, _ := strings.Cut(mediatype, "/")
+		switch {
+		case kind == "audio" || kind == "video":
+			return contentType
+		case kind == "image" && mediatype != "image/svg+xml":
+			return contentType
+		}
+	}
+	return "application/octet-stream"
+}
+
+// Revisions of the item, newest first.
+// Each one comes with the diff against the version which replaced it.
+func (s *Server) handleItemRevisions(c *router.Context) {
+	id, err := c.VarInt64("id")
+	if err != nil {
+		c.Out.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	if c.Req.Method != "GET" {
+		c.Out.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	item := s.db.GetItem(id)
+	if item == nil {
+		c.Out.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	type revision struct {
+		storage.ItemRevision
+		Diff string `json:"diff"`
+	}
+	revisions := s.db.ListItemRevisions(id)
+	result := make([]revision, len(revisions))
+	for i, rev := range revisions {
+		next := item.Content
+		if i+1 < len(revisions) {
+			next = revisions[i+1].Content
+		}
+		rev.Content = sanitizer.Sanitize(item.Link, rev.Content)
+		result[len(revisions)-1-i] = revision{
+			ItemRevision: rev,
+			Diff:         htmldiff.Diff(revisions[i].Content, next),
+		}
+	}
+	c.JSON(http.StatusOK, result)
+}
+
+func (s *Server) handleItemList(c *router.Context) {
+	if c.Req.Method == "GET" {
+		perPage := 20
+		query := c.Req.URL.Query()
+
+		filter := storage.ItemFilter{}
+		// the query params take precedence over the smart feed filter
+		if smartFeedID, err := c.QueryInt64("smartfeed_id"); err == nil {
+			smartFeed := s.db.GetSmartFeed(smartFeedID)
+			if smartFeed == nil {
+				c.Out.WriteHeader(http.StatusBadRequest)
+				return
+			}
+			filter = smartFeed.Filter.ItemFilter()
+		}
+		if folderID, err := c.QueryInt64("folder_id"); err == nil {
+			filter.FolderID = &folderID
+		}
+		if feedID, err := c.QueryInt64("feed_id"); err == nil {
+			filter.FeedID = &feedID
+		}
+		if after, err := c.QueryInt64("after"); err == nil {
+			filter.After = &after
+		}
+		if tagID, err := c.QueryInt64("tag_id"); err == nil {
+			filter.Tags = &[]int64{tagID}
+		}
+		if status := query.Get("status"); len(status) != 0 {
+			statusValue := storage.StatusValues[status]
+			filter.Status = &statusValue
+		}
+		if search := query.Get("search"); len(search) != 0 {
+			filter.Search = &search
+		}
+		if author := query.Get("author"); len(author) != 0 {
+			filter.Author = &author
+		}
+		if category := query.Get("category"); len(category) != 0 {
+			filter.Category = &category
+		}
+		if priority, err := c.QueryInt64("min_priority"); err == nil {
+			minPriority := int(priority)
+			filter.MinPriority = &minPriority
+		}
+		newestFirst := query.Get("oldest_first") != "true"
+
+		items := s.db.ListItems(filter, perPage+1, newestFirst, true)
+		hasMore := false
+		if len(items) == perPage+1 {
+			hasMore = true
+			items = items[:perPage]
+		}
+
+		for i, item := range items {
+			if item.Title == "" {
+				text := htmlutil.ExtractText(item.Content)
+				items[i].Title = htmlutil.TruncateText(text, 140)
+			}
+		}
+		c.JSON(http.StatusOK, map[string]interface{}{
+			"list":     items,
+			"has_more": hasMore,
+		})
+	} else if c.Req.Method == "PUT" {
+		if smartFeedID, err := c.QueryInt64("smartfeed_id"); err == nil {
+			s.db.MarkSmartFeedRead(smartFeedID, nil)
+			c.Out.WriteHeader(http.StatusOK)
+			return
+		}
+
+		filter := storage.MarkFilter{}
+
+		if folderID, err := c.QueryInt64("folder_id"); err == nil {
+			filter.FolderID = &folderID
+		}
+		if feedID, err := c.QueryInt64("feed_id"); err == nil {
+			filter.FeedID = &feedID
+		}
+		if tagID, err := c.QueryInt64("tag_id"); err == nil {
+			filter.Tags = &[]int64{tagID}
+		}
+		if author := c.Req.URL.Query().Get("author"); len(author) != 0 {
+			filter.Author = &author
+		}
+		if category := c.Req.URL.Query().Get("category"); len(category) != 0 {
+			filter.Category = &category
+		}
+		s.db.MarkItemsRead(filter)
+		c.Out.WriteHeader(http.StatusOK)
+	} else {
+		c.Out.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
+
+func (s *Server) handleSmartFeedList(c *router.Context) {
+	if c.Req.Method == "GET" {
+		c.JSON(http.StatusOK, s.db.ListSmartFeeds())
+	} else if c.Req.Method == "POST" {
+		var body SmartFeedForm
+		if err := json.NewDecoder(c.Req.Body).Decode(&body); err != nil {
+			log.Print(err)
+			c.Out.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		if body.Title == nil || len(*body.Title) == 0 {
+			c.JSON(http.StatusBadRequest, map[string]string{"error": "Smart feed title missing."})
+			return
+		}
+		if body.Filter == nil {
+			body.Filter = &storage.SmartFeedFilter{}
+		}
+		smartFeed := s.db.CreateSmartFeed(*body.Title, *body.Filter)
+		c.JSON(http.StatusCreated, smartFeed)
+	} else {
+		c.Out.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
+
+func (s *Server) handleSmartFeed(c *router.Context) {
+	id, err := c.VarInt64("id")
+	if err != nil {
+		c.Out.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	if c.Req.Method == "PUT" {
+		var body SmartFeedForm
+		if err := json.NewDecoder(c.Req.Body).Decode(&body); err != nil {
+			log.Print(err)
+			c.Out.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		if body.Title != nil {
+			s.db.RenameSmartFeed(id, *body.Title)
+		}
+		if body.Filter != nil {
+			s.db.UpdateSmartFeedFilter(id, *body.Filter)
+		}
+		c.Out.WriteHeader(http.StatusOK)
+	} else if c.Req.Method == "DELETE" {
+		s.db.DeleteSmartFeed(id)
+		c.Out.WriteHeader(http.StatusNoContent)
+	} else {
+		c.Out.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
+
+func (s *Server) handleRuleList(c *router.Context) {
+	if c.Req.Method == "GET" {
+		c.JSON(http.StatusOK, s.db.ListRules())
+	} else if c.Req.Method == "POST" {
+		var body storage.Rule
+		if err := json.NewDecoder(c.Req.Body).Decode(&body); err != nil {
+			log.Print(err)
+			c.Out.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		if err := body.Validate(); err != nil {
+			c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid rule: " + err.Error()})
+			return
+		}
+		rule := s.db.CreateRule(body)
+		if rule == nil {
+			c.Out.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		c.JSON(http.StatusCreated, rule)
+	} else {
+		c.Out.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
+
+func (s *Server) handleRule(c *router.Context) {
+	id, err := c.VarInt64("id")
+	if err != nil {
+		c.Out.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	if s.db.GetRule(id) == nil {
+		c.Out.WriteHeader(http.StatusNotFound)
+		return
+	}
+	if c.Req.Method == "PUT" {
+		var body storage.Rule
+		if err := json.NewDecoder(c.Req.Body).Decode(&body); err != nil {
+			log.Print(err)
+			c.Out.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		if err := body.Validate(); err != nil {
+			c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid rule: " + err.Error()})
+			return
+		}
+		body.Id = id
+		s.db.UpdateRule(body)
+		c.JSON(http.StatusOK, body)
+	} else if c.Req.Method == "DELETE" {
+		s.db.DeleteRule(id)
+		c.Out.WriteHeader(http.StatusNoContent)
+	} else {
+		c.Out.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
+
+// Dry run of the rule against the latest items of the feeds it applies to.
+func (s *Server) handleRuleTest(c *router.Context) {
+	if c.Req.Method != "POST" {
+		c.Out.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	var body RuleTestForm
+	if err := json.NewDecoder(c.Req.Body).Decode(&body); err != nil {
+		log.Print(err)
+		c.Out.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	var rule storage.Rule
+	switch {
+	case body.Rule != nil:
+		rule = *body.Rule
+	case body.ID != nil:
+		existing := s.db.GetRule(*body.ID)
+		if existing == nil {
+			c.Out.WriteHeader(http.StatusNotFound)
+			return
+		}
+		rule = *existing
+	default:
+		c.JSON(http.StatusBadRequest, map[string]string{"error": "Rule missing."})
+		return
+	}
+	if err := rule.Validate(); err != nil {
+		c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid rule: " + err.Error()})
+		return
+	}
+	limit := body.Limit
+	if limit <= 0 {
+		limit = 50
+	}
+	limit = min(limit, 500)
+
+	filter := storage.ItemFilter{}
+	if len(rule.Match.FeedIDs) > 0 || len(rule.Match.FolderIDs) > 0 {
+		filter.FeedIDs = &rule.Match.FeedIDs
+		filter.FolderIDs = &rule.Match.FolderIDs
+	}
+	items := s.db.ListItems(filter, limit, true, true)
+
+	// disabled rules are tested all the same
+	rule.Enabled = true
+	set := s.db.NewRuleSet([]storage.Rule{rule})
+	matched := make([]storage.Item, 0)
+	for _, item := range items {
+		if len(set.Matching(item)) > 0 {
+			item.Content = ""
+			matched = append(matched, item)
+		}
+	}
+	c.JSON(http.StatusOK, map[string]interface{}{
+		"checked": len(items),
+		"items":   matched,
+		"actions": rule.Actions,
+	})
+}
+
+func (s *Server) handleWebhookList(c *router.Context) {
+	if c.Req.Method == "GET" {
+		hooks := s.db.ListWebhooks()
+		for i := range hooks {
+			hooks[i] = hooks[i].Masked()
+		}
+		c.JSON(http.StatusOK, hooks)
+	} else if c.Req.Method == "POST" {
+		var body storage.Webhook
+		if err := json.NewDecoder(c.Req.Body).Decode(&body); err != nil {
+			log.Print(err)
+			c.Out.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		if err := body.Validate(); err != nil {
+			c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid webhook: " + err.Error()})
+			return
+		}
+		if body.Secret == "" || body.Secret == storage.SecretMask {
+			body.Secret = worker.NewWebhookSecret()
+		}
+		hook := s.db.CreateWebhook(body)
+		if hook == nil {
+			c.Out.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		// the secret is only revealed once, for setting up the receiver
+		c.JSON(http.StatusCreated, hook)
+	} else {
+		c.Out.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
+
+func (s *Server) handleWebhook(c *router.Context) {
+	id, err := c.VarInt64("id")
+	if err != nil {
+		c.Out.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	stored := s.db.GetWebhook(id)
+	if stored == nil {
+		c.Out.WriteHeader(http.StatusNotFound)
+		return
+	}
+	if c.Req.Method == "PUT" {
+		var body storage.Webhook
+		if err := json.NewDecoder(c.Req.Body).Decode(&body); err != nil {
+			log.Print(err)
+			c.Out.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		if err := body.Validate(); err != nil {
+			c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid webhook: " + err.Error()})
+			return
+		}
+		body.Id = id
+		if body.Secret == "" || body.Secret == storage.SecretMask {
+			body.Secret = stored.Secret
+		}
+		s.db.UpdateWebhook(body)
+		c.JSON(http.StatusOK, body.Masked())
+	} else if c.Req.Method == "DELETE" {
+		s.db.DeleteWebhook(id)
+		c.Out.WriteHeader(http.StatusNoContent)
+	} else {
+		c.Out.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
+
+// Log of the latest deliveries to the webhook, newest first.
+func (s *Server) handleWebhookDeliveries(c *router.Context) {
+	if c.Req.Method != "GET" {
+		c.Out.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	id, err := c.VarInt64("id")
+	if err != nil {
+		c.Out.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	if s.db.GetWebhook(id) == nil {
+		c.Out.WriteHeader(http.StatusNotFound)
+		return
+	}
+	c.JSON(http.StatusOK, s.db.ListWebhookDeliveries(id))
+}
+
+func (s *Server) handleDigestList(c *router.Context) {
+	if c.Req.Method == "GET" {
+		c.JSON(http.StatusOK, s.db.ListDigests())
+	} else if c.Req.Method == "POST" {
+		var body storage.Digest
+		if err := json.NewDecoder(c.Req.Body).Decode(&body); err != nil {
+			log.Print(err)
+			c.Out.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		if err := body.Validate(); err != nil {
+			c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid digest: " + err.Error()})
+			return
+		}
+		digest := s.db.CreateDigest(body)
+		if digest == nil {
+			c.Out.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		c.JSON(http.StatusCreated, digest)
+	} else {
+		c.Out.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
+
+func (s *Server) handleDigest(c *router.Context) {
+	id, err := c.VarInt64("id")
+	if err != nil {
+		c.Out.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	stored := s.db.GetDigest(id)
+	if stored == nil {
+		c.Out.WriteHeader(http.StatusNotFound)
+		return
+	}
+	if c.Req.Method == "PUT" {
+		var body storage.Digest
+		if err := json.NewDecoder(c.Req.Body).Decode(&body); err != nil {
+			log.Print(err)
+			c.Out.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		if err := body.Validate(); err != nil {
+			c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid digest: " + err.Error()})
+			return
+		}
+		body.Id = id
+		s.db.UpdateDigest(body)
+		c.JSON(http.StatusOK, s.db.GetDigest(id))
+	} else if c.Req.Method == "DELETE" {
+		s.db.DeleteDigest(id)
+		c.Out.WriteHeader(http.StatusNoContent)
+	} else {
+		c.Out.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
+
+// The email of the next digest, without marking its items as sent.
+func (s *Server) handleDigestPreview(c *router.Context) {
+	if c.Req.Method != "GET" {
+		c.Out.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	id, err := c.VarInt64("id")
+	if err != nil {
+		c.Out.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	digest := s.db.GetDigest(id)
+	if digest == nil {
+		c.Out.WriteHeader(http.StatusNotFound)
+		return
+	}
+	body, _, err := s.worker.RenderDigest(*digest)
+	if err != nil {
+		log.Print(err)
+		c.Out.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	c.Out.Header().Set("Content-Type", "text/html; charset=utf-8")
+	c.Out.WriteHeader(http.StatusOK)
+	c.Out.Write([]byte(body))
+}
+
+// Send the digest right away, regardless of its schedule.
+func (s *Server) handleDigestSend(c *router.Context) {
+	if c.Req.Method != "POST" {
+		c.Out.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	id, err := c.VarInt64("id")
+	if err != nil {
+		c.Out.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	digest := s.db.GetDigest(id)
+	if digest == nil {
+		c.Out.WriteHeader(http.StatusNotFound)
+		return
+	}
+	count, err := s.worker.SendDigest(*digest)
+	if err == worker.ErrSMTPNotConfigured {
+		c.JSON(http.StatusBadRequest, map[string]string{"error": "SMTP server not configured."})
+		return
+	}
+	if err != nil {
+		log.Print(err)
+		c.JSON(http.StatusBadGateway, map[string]string{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, map[string]int{"items": count})
+}
+
+func (s *Server) handleTagList(c *router.Context) {
+	if c.Req.Method == "GET" {
+		c.JSON(http.StatusOK, s.db.ListTags())
+	} else if c.Req.Method == "POST" {
+		var body TagForm
+		if err := json.NewDecoder(c.Req.Body).Decode(&body); err != nil {
+			log.Print(err)
+			c.Out.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		if len(body.Title) == 0 {
+			c.JSON(http.StatusBadRequest, map[string]string{"error": "Tag title missing."})
+			return
+		}
+		tag := s.db.CreateTag(body.Title)
+		if tag == nil {
+			c.Out.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		c.JSON(http.StatusCreated, tag)
+	} else {
+		c.Out.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
+
+func (s *Server) handleTag(c *router.Context) {
+	id, err := c.VarInt64("id")
+	if err != nil {
+		c.Out.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	if c.Req.Method == "PUT" {
+		var body TagForm
+		if err := json.NewDecoder(c.Req.Body).Decode(&body); err != nil {
+			log.Print(err)
+			c.Out.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		if len(body.Title) == 0 {
+			c.JSON(http.StatusBadRequest, map[string]string{"error": "Tag title missing."})
+			return
+		}
+		switch err := s.db.RenameTag(id, body.Title); err {
+		case nil:
+		case storage.ErrNotFound:
+			c.Out.WriteHeader(http.StatusNotFound)
+			return
+		case storage.ErrConflict:
+			c.JSON(http.StatusConflict, map[string]string{"error": "Tag title already in use."})
+			return
+		default:
+			c.Out.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		c.Out.WriteHeader(http.StatusOK)
+	} else if c.Req.Method == "DELETE" {
+		s.db.DeleteTag(id)
+		c.Out.WriteHeader(http.StatusNoContent)
+	} else {
+		c.Out.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
+
+func (s *Server) handleSettings(c *router.Context) {
+	if c.Req.Method == "GET" {
+		c.JSON(http.StatusOK, s.db.GetSettings())
+	} else if c.Req.Method == "PUT" {
+		settings := make(map[string]interface{})
+		if err := json.NewDecoder(c.Req.Body).Decode(&settings); err != nil {
+			c.Out.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		if s.db.UpdateSettings(settings) {
+			if _, ok := settings["refresh_rate"]; ok {
+				s.worker.SetRefreshRate(s.db.GetSettingsValueInt64("refresh_rate"))
+			}
+			c.Out.WriteHeader(http.StatusOK)
+		} else {
+			c.Out.WriteHeader(http.StatusBadRequest)
+		}
+	}
+}
+
+func (s *Server) handleBackup(c *router.Context) {
+	if c.Req.Method != "GET" {
+		c.Out.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	dir, err := os.MkdirTemp("", "yarr-backup")
+	if err != nil {
+		log.Print(err)
+		c.Out.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "backup.db")
+	if err := s.db.Backup(path); err != nil {
+		log.Print(err)
+		c.Out.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	file, err := os.Open(path)
+	if err != nil {
+		log.Print(err)
+		c.Out.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	defer file.Close()
+
+	filename := "yarr-" + time.Now().Format("20060102-150405") + ".db"
+	c.Out.Header().Set("Content-Type", "application/vnd.sqlite3")
+	c.Out.Header().Set("Content-Disposition", `attachment; filename="`+filename+`"`)
+	c.Out.WriteHeader(http.StatusOK)
+	io.Copy(c.Out, file)
+}
+
+const maxWebSubContentSize = 10 << 20
+
+// Callback of the websub subscription: intent verification & content distribution.
+func (s *Server) handleWebSub(c *router.Context) {
+	id, err := c.VarInt64("id")
+	if err != nil {
+		c.Out.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	// the push subscriptions are disabled without the public url
+	if s.PublicURL == "" {
+		c.Out.WriteHeader(http.StatusNotFound)
+		return
+	}
+	sub := s.db.GetWebSub(id)
+	feed := s.db.GetFeed(id)
+
+	switch c.Req.Method {
+	case "GET":
+		query := c.Req.URL.Query()
+		topic := query.Get("hub.topic")
+		challenge := query.Get("hub.challenge")
+		matches := sub != nil && feed != nil && sub.Topic == topic
+
+		switch query.Get("hub.mode") {
+		case "subscribe":
+			if !matches || sub.State == storage.WebSubNew {
+				c.Out.WriteHeader(http.StatusNotFound)
+				return
+			}
+			lease, err := strconv.ParseInt(query.Get("hub.lease_seconds"), 10, 64)
+			if err != nil || lease <= 0 {
+				c.Out.WriteHeader(http.StatusBadRequest)
+				return
+			}
+			s.db.SetWebSubVerified(id, time.Duration(lease)*time.Second)
+			log.Printf("websub: subscribed to %s", topic)
+		case "unsubscribe":
+			// confirm only the subscriptions no longer wanted
+			if matches {
+				c.Out.WriteHeader(http.StatusNotFound)
+				return
+			}
+		case "denied":
+			if matches {
+				s.db.SetWebSubDenied(id)
+				log.Printf("websub: subscription to %s denied: %s", topic, query.Get("hub.reason"))
+			}
+		default:
+			c.Out.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		c.Out.Header().Set("Content-Type", "text/plain")
+		c.Out.WriteHeader(http.StatusOK)
+		c.Out.Write([]byte(challenge))
+	case "POST":
+		if sub == nil || feed == nil {
+			c.Out.WriteHeader(http.StatusGone)
+			return
+		}
+		// only the content of the verified subscriptions is accepted, always signed
+		if sub.State != storage.WebSubActive || sub.Secret == "" {
+			c.Out.WriteHeader(http.StatusNotFound)
+			return
+		}
+		body, err := io.ReadAll(io.LimitReader(c.Req.Body, maxWebSubContentSize))
+		if err != nil {
+			log.Print(err)
+			c.Out.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		// the content with an invalid signature is acknowledged, but ignored
+		if !worker.VerifyWebSubSignature(sub.Secret, c.Req.Header.Get("X-Hub-Signature"), body) {
+			log.Printf("websub: invalid signature of the content for %s", feed.FeedLink)
+			c.Out.WriteHeader(http.StatusAccepted)
+			return
+		}
+		err = s.worker.IngestWebSub(*feed, bytes.NewReader(body), c.Req.Header.Get("Content-Type"))
+		if err != nil {
+			log.Printf("websub: failed to ingest the content for %s: %s", feed.FeedLink, err)
+		}
+		c.Out.WriteHeader(http.StatusAccepted)
+	default:
+		c.Out.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
+
+func (s *Server) handleOPMLImport(c *router.Context) {
+	if c.Req.Method == "POST" {
+		file, _, err := c.Req.FormFile("opml")
+		if err != nil {
+			log.Print(err)
+			return
+		}
+		doc, err := opml.Parse(file)
+		if err != nil {
+			log.Print(err)
+			c.Out.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		var importFolder func(f opml.Folder, parentID *int64)
 		importFolder = func(f opml.Folder, parentID *int64) {
 			var currentFolderID *int64
 			if f.Title != "" {
@@ -523,22 +1694,35 @@ func (s *Server) handleOPMLExport(c *router.Context) {
 		}
 
 		// Build folder tree
-		folderNodes := make(map[int64]*opml.Folder)
+		childFolders := make(map[int64][]storage.Folder)
+		rootFolders := make([]storage.Folder, 0)
+		folderIds := make(map[int64]bool)
 		for _, f := range allFolders {
-			folderNodes[f.Id] = &opml.Folder{
+			folderIds[f.Id] = true
+		}
+		for _, f := range allFolders {
+			if f.ParentId != nil && folderIds[*f.ParentId] {
+				childFolders[*f.ParentId] = append(childFolders[*f.ParentId], f)
+			} else {
+				rootFolders = append(rootFolders, f)
+			}
+		}
+
+		var buildFolder func(f storage.Folder) opml.Folder
+		buildFolder = func(f storage.Folder) opml.Folder {
+			node := opml.Folder{
 				Title: f.Title,
 				Feeds: feedsByFolderID[f.Id],
 			}
+			for _, child := range childFolders[f.Id] {
+				node.Folders = append(node.Folders, buildFolder(child))
+			}
+			return node
 		}
 
 		doc := opml.Folder{Feeds: rootFeeds}
-		for _, f := range allFolders {
-			node := folderNodes[f.Id]
-			if f.ParentId == nil {
-				doc.Folders = append(doc.Folders, *node)
-			} else if parent, ok := folderNodes[*f.ParentId]; ok {
-				parent.Folders = append(parent.Folders, *node)
-			}
+		for _, f := range rootFolders {
+			doc.Folders = append(doc.Folders, buildFolder(f))
 		}
 
 		c.Out.Write([]byte(doc.OPML()))
@@ -562,7 +1746,14 @@ func (s *Server) handlePageCrawl(c *router.Context) {
 		return
 	}
 
-	body, err := worker.GetBody(url)
+	// the page of an item of a private feed may require the same credentials
+	var opts *storage.RequestOptions
+	if feedID, err := c.QueryInt64("feed_id"); err == nil {
+		if feed := s.db.GetFeed(feedID); feed != nil {
+			opts = s.worker.FeedRequestOptions(*feed, url)
+		}
+	}
+	body, err := worker.GetBody(url, opts)
 	if err != nil {
 		log.Print(err)
 		c.Out.WriteHeader(http.StatusBadRequest)
@@ -1,16 +1,26 @@
 package server
 
 import (
+	"bufio"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
 	"fmt"
 	"io"
 	"log"
+	"net"
 	"net/http"
 	"net/http/httptest"
 	"os"
+	"path/filepath"
 	"reflect"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/nkanaev/yarr/src/storage"
+	"github.com/nkanaev/yarr/src/worker"
 )
 
 func TestStatic(t *testing.T) {
@@ -112,3 +122,779 @@ func TestFeedIcons(t *testing.T) {
 		t.Fatal("got", response2.StatusCode)
 	}
 }
+
+// Fresh in-memory db, the logs are discarded until the end of the test.
+func newTestDB(t *testing.T) *storage.Storage {
+	return openTestDB(t, ":memory:")
+}
+
+// Db in a file, for the tests updating it in the background:
+// unlike the in-memory one, it's shared by all the connections.
+func newTestFileDB(t *testing.T) *storage.Storage {
+	return openTestDB(t, filepath.Join(t.TempDir(), "storage.db"))
+}
+
+func openTestDB(t *testing.T, path string) *storage.Storage {
+	log.SetOutput(io.Discard)
+	t.Cleanup(func() { log.SetOutput(os.Stderr) })
+	db, err := storage.New(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return db
+}
+
+func serve(handler http.Handler, req *http.Request) *http.Response {
+	recorder := httptest.NewRecorder()
+	handler.ServeHTTP(recorder, req)
+	return recorder.Result()
+}
+
+// Returns the status code & the body of the response.
+func doRequest(handler http.Handler, method, url, body string) (int, string) {
+	res := serve(handler, httptest.NewRequest(method, url, strings.NewReader(body)))
+	data, _ := io.ReadAll(res.Body)
+	return res.StatusCode, string(data)
+}
+
+func TestOPMLExportNestedFolders(t *testing.T) {
+	db := newTestDB(t)
+	// created children first to make sure the order doesn't matter
+	folderC := db.CreateFolder("c", nil)
+	folderB := db.CreateFolder("b", nil)
+	folderA := db.CreateFolder("a", nil)
+	db.UpdateFolderParent(folderB.Id, &folderA.Id)
+	db.UpdateFolderParent(folderC.Id, &folderB.Id)
+	db.CreateFeed("feed", "", "", "http://example.com/feed.xml", &folderC.Id)
+
+	_, body := doRequest(NewServer(db, "127.0.0.1:8000").handler(), "GET", "/opml/export", "")
+	want := `<body>
+  <outline text="a">
+    <outline text="b">
+      <outline text="c">
+        <outline type="rss" text="feed" xmlUrl="http://example.com/feed.xml" htmlUrl=""/>
+      </outline>
+    </outline>
+  </outline>
+</body>`
+	if !strings.Contains(body, want) {
+		t.Fatalf("invalid opml export:\n%s", body)
+	}
+}
+
+func TestWebSubCallback(t *testing.T) {
+	db := newTestDB(t)
+	feed := db.CreateFeed("feed", "", "", "http://example.com/feed.xml", nil)
+	db.SetWebSubHub(feed.Id, "http://hub.example.com/", "http://example.com/feed.xml")
+	db.SetWebSubRequested(feed.Id, "secret")
+
+	server := NewServer(db, "127.0.0.1:8000")
+	server.PublicURL = "http://yarr.example.com/"
+	handler := server.handler()
+	callback := fmt.Sprintf("/websub/%d", feed.Id)
+	request := func(method, url, body, signature string) *http.Response {
+		req := httptest.NewRequest(method, url, strings.NewReader(body))
+		if signature != "" {
+			req.Header.Set("X-Hub-Signature", signature)
+		}
+		return serve(handler, req)
+	}
+
+	// intent verification
+	verify := callback + "?hub.mode=subscribe&hub.challenge=abc&hub.lease_seconds=3600&hub.topic="
+	if res := request("GET", verify+"http://example.com/other.xml", "", ""); res.StatusCode != http.StatusNotFound {
+		t.Fatalf("verified subscription to unknown topic: %d", res.StatusCode)
+	}
+	res := request("GET", verify+"http://example.com/feed.xml", "", "")
+	body, _ := io.ReadAll(res.Body)
+	if res.StatusCode != http.StatusOK || string(body) != "abc" {
+		t.Fatalf("invalid verification response: %d %s", res.StatusCode, body)
+	}
+	if sub := db.GetWebSub(feed.Id); sub.State != storage.WebSubActive || sub.ExpiresAt == nil {
+		t.Fatalf("subscription not activated: %#v", sub)
+	}
+
+	// content distribution
+	content := `<?xml version="1.0"?>
+		<rss version="2.0"><channel><item><guid>1</guid><title>pushed</title></item></channel></rss>`
+	mac := hmac.New(sha256.New, []byte("secret"))
+	mac.Write([]byte(content))
+	signature := "sha256=" + hex.EncodeToString(mac.Sum(nil))
+
+	if res := request("POST", callback, content, "sha256=0000"); res.StatusCode != http.StatusAccepted {
+		t.Fatalf("invalid response: %d", res.StatusCode)
+	}
+	if items := db.ListItems(storage.ItemFilter{}, 10, false, false); len(items) != 0 {
+		t.Fatalf("ingested content with invalid signature: %#v", items)
+	}
+	if res := request("POST", callback, content, signature); res.StatusCode != http.StatusAccepted {
+		t.Fatalf("invalid response: %d", res.StatusCode)
+	}
+	items := db.ListItems(storage.ItemFilter{}, 10, false, false)
+	if len(items) != 1 || items[0].Title != "pushed" || items[0].FeedId != feed.Id {
+		t.Fatalf("content not ingested: %#v", items)
+	}
+	// recorded like the fetched content
+	if fetches := db.ListFeedFetches(feed.Id, 10); len(fetches) != 1 || fetches[0].Items != 1 || fetches[0].Bytes != int64(len(content)) {
+		t.Fatalf("invalid fetch log: %#v", fetches)
+	}
+}
+
+func TestWebSubCallbackRejected(t *testing.T) {
+	db := newTestDB(t)
+	feed := db.CreateFeed("feed", "", "", "http://example.com/feed.xml", nil)
+	db.SetWebSubHub(feed.Id, "http://hub.example.com/", "http://example.com/feed.xml")
+
+	server := NewServer(db, "127.0.0.1:8000")
+	callback := fmt.Sprintf("/websub/%d", feed.Id)
+	content := `<?xml version="1.0"?>
+		<rss version="2.0"><channel><item><guid>1</guid><title>injected</title></item></channel></rss>`
+	post := func() int {
+		status, _ := doRequest(server.handler(), "POST", callback, content)
+		return status
+	}
+
+	// websub disabled
+	if status := post(); status != http.StatusNotFound {
+		t.Fatalf("unexpected status: %d", status)
+	}
+	// subscription not verified, no secret
+	server.PublicURL = "http://yarr.example.com/"
+	if status := post(); status != http.StatusNotFound {
+		t.Fatalf("unexpected status: %d", status)
+	}
+	// active subscription, unsigned content
+	db.SetWebSubRequested(feed.Id, "secret")
+	db.SetWebSubVerified(feed.Id, time.Hour)
+	if status := post(); status != http.StatusAccepted {
+		t.Fatalf("unexpected status: %d", status)
+	}
+	if items := db.ListItems(storage.ItemFilter{}, 10, false, false); len(items) != 0 {
+		t.Fatalf("ingested unsigned content: %#v", items)
+	}
+}
+
+func TestFeedRequestOptionsMasked(t *testing.T) {
+	db := newTestDB(t)
+	feed := db.CreateFeed("feed", "", "", "http://example.com/feed.xml", nil)
+	db.UpdateFeedRequestOptions(feed.Id, &storage.RequestOptions{Username: "user", Password: "pass"})
+
+	handler := NewServer(db, "127.0.0.1:8000").handler()
+	url := fmt.Sprintf("/api/feeds/%d", feed.Id)
+
+	_, body := doRequest(handler, "GET", url, "")
+	if strings.Contains(body, `"pass"`) || !strings.Contains(body, `"password":"********"`) {
+		t.Fatalf("secrets not masked: %s", body)
+	}
+
+	// the masked password is kept as is
+	update := `{"request_options": {"username": "other", "password": "********", "cookie": "a=b"}}`
+	if status, _ := doRequest(handler, "PUT", url, update); status != http.StatusOK {
+		t.Fatalf("invalid response: %d", status)
+	}
+	want := storage.RequestOptions{Username: "other", Password: "pass", Cookie: "a=b"}
+	if have := db.GetFeedRequestOptions(feed.Id); have == nil || !reflect.DeepEqual(*have, want) {
+		t.Fatalf("invalid options: %#v", have)
+	}
+}
+
+func TestItemContentVersion(t *testing.T) {
+	db := newTestDB(t)
+	feed := db.CreateFeed("feed", "", "", "http://example.com/feed.xml", nil)
+	full := "<p>full text</p>"
+	db.CreateItems([]storage.Item{
+		{GUID: "item1", FeedId: feed.Id, Link: "http://example.com/1", Content: "<p>teaser</p>", FullContent: &full},
+		{GUID: "item2", FeedId: feed.Id, Link: "http://example.com/2", Content: "<p>text</p>"},
+	})
+
+	handler := NewServer(db, "127.0.0.1:8000").handler()
+	items := db.ListItems(storage.ItemFilter{}, 10, false, false)
+
+	testcases := []struct {
+		url    string
+		status int
+		body   string
+	}{
+		{fmt.Sprintf("/api/items/%d", items[0].Id), http.StatusOK, "full text"},
+		{fmt.Sprintf("/api/items/%d?content=feed", items[0].Id), http.StatusOK, "teaser"},
+		{fmt.Sprintf("/api/items/%d", items[1].Id), http.StatusOK, `"content_source":"feed"`},
+		{fmt.Sprintf("/api/items/%d?content=full", items[1].Id), http.StatusBadRequest, "not available"},
+		{fmt.Sprintf("/api/items/%d?content=other", items[0].Id), http.StatusBadRequest, "Invalid"},
+	}
+	for _, testcase := range testcases {
+		status, body := doRequest(handler, "GET", testcase.url, "")
+		if status != testcase.status || !strings.Contains(body, testcase.body) {
+			t.Errorf("%s: unexpected response %d: %s", testcase.url, status, body)
+		}
+	}
+}
+
+func TestRefreshNow(t *testing.T) {
+	feedServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/rss+xml")
+		io.WriteString(w, `<rss version="2.0"><channel><title>feed</title>
+			<item><guid>1</guid><title>one</title></item>
+			<item><guid>2</guid><title>two</title></item>
+		</channel></rss>`)
+	}))
+	defer feedServer.Close()
+
+	db := newTestDB(t)
+	folder := db.CreateFolder("folder", nil)
+	subfolder := db.CreateFolder("subfolder", &folder.Id)
+	feed1 := db.CreateFeed("feed1", "", "", feedServer.URL+"/1.xml", &folder.Id)
+	feed2 := db.CreateFeed("feed2", "", "", feedServer.URL+"/2.xml", &subfolder.Id)
+	db.CreateFeed("feed3", "", "", feedServer.URL+"/3.xml", nil)
+
+	handler := NewServer(db, "127.0.0.1:8000").handler()
+	status, body := doRequest(handler, "POST", fmt.Sprintf("/api/feeds/%d/refresh", feed1.Id), "")
+	if status != http.StatusOK || !strings.Contains(body, `"items":2`) || !strings.Contains(body, `"error":""`) {
+		t.Fatalf("unexpected feed refresh response %d: %s", status, body)
+	}
+
+	var fetches []storage.FeedFetch
+	status, body = doRequest(handler, "POST", fmt.Sprintf("/api/folders/%d/refresh", folder.Id), "")
+	if err := json.Unmarshal([]byte(body), &fetches); status != http.StatusOK || err != nil {
+		t.Fatalf("unexpected folder refresh response %d: %s", status, body)
+	}
+	items := map[int64]int{}
+	for _, fetch := range fetches {
+		items[fetch.FeedID] = fetch.Items
+	}
+	if want := map[int64]int{feed1.Id: 0, feed2.Id: 2}; !reflect.DeepEqual(items, want) {
+		t.Fatalf("invalid fetches\nwant: %v\nhave: %v", want, items)
+	}
+
+	if status, _ = doRequest(handler, "POST", "/api/folders/100/refresh", ""); status != http.StatusNotFound {
+		t.Fatalf("unexpected response for missing folder: %d", status)
+	}
+}
+
+func TestScrapedFeed(t *testing.T) {
+	page := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		io.WriteString(w, `<html><head><title>News</title></head><body><ul class="news">
+			<li><a href="/1">one</a></li>
+			<li><a href="/2">two</a></li>
+		</ul></body></html>`)
+	}))
+	defer page.Close()
+
+	db := newTestDB(t)
+	handler := NewServer(db, "127.0.0.1:8000").handler()
+
+	_, body := doRequest(handler, "POST", "/api/feeds", `{"url": "`+page.URL+`", "selectors": {"item": "ul.news > li"}}`)
+	if !strings.Contains(body, `"status":"success"`) {
+		t.Fatalf("feed not created: %s", body)
+	}
+	feeds := db.ListFeeds()
+	if len(feeds) != 1 || feeds[0].Title != "News" || feeds[0].FeedLink != page.URL {
+		t.Fatalf("invalid feeds: %#v", feeds)
+	}
+	items := db.ListItems(storage.ItemFilter{}, 10, false, false)
+	if len(items) != 2 || items[0].Link != page.URL+"/1" {
+		t.Fatalf("invalid items: %#v", items)
+	}
+	if selectors := db.GetFeedSelectors(feeds[0].Id); selectors == nil || selectors.Item != "ul.news > li" {
+		t.Fatalf("invalid selectors: %#v", selectors)
+	}
+
+	_, body = doRequest(handler, "POST", "/api/feeds", `{"url": "`+page.URL+`/other", "selectors": {"item": "article"}}`)
+	if !strings.Contains(body, `"status":"notfound"`) || !strings.Contains(body, "no items") {
+		t.Fatalf("unexpected response: %s", body)
+	}
+
+	url := fmt.Sprintf("/api/feeds/%d", feeds[0].Id)
+	if status, _ := doRequest(handler, "PUT", url, `{"selectors": {"item": "li:hover"}}`); status != http.StatusBadRequest {
+		t.Fatalf("invalid selectors accepted: %d", status)
+	}
+	if status, _ := doRequest(handler, "PUT", url, `{"selectors": null}`); status != http.StatusOK || db.GetFeedSelectors(feeds[0].Id) != nil {
+		t.Fatalf("selectors not removed: %d", status)
+	}
+}
+
+func TestRuleDryRun(t *testing.T) {
+	db := newTestDB(t)
+	feed := db.CreateFeed("feed", "", "", "http://example.com/feed.xml", nil)
+	db.CreateItems([]storage.Item{
+		{GUID: "1", FeedId: feed.Id, Title: "Weekly digest", Date: time.Now()},
+		{GUID: "2", FeedId: feed.Id, Title: "Release notes", Date: time.Now()},
+	})
+
+	handler := NewServer(db, "127.0.0.1:8000").handler()
+
+	rule := `{"title": "digests", "enabled": false, "match": {"conditions": [{"field": "title", "value": "digest"}]}, "actions": {"status": "read"}}`
+	if code, body := doRequest(handler, "POST", "/api/rules", `{"title": "empty"}`); code != 400 || !strings.Contains(body, "actions missing") {
+		t.Fatalf("unexpected response: %d %s", code, body)
+	}
+	if code, _ := doRequest(handler, "POST", "/api/rules", rule); code != 201 {
+		t.Fatalf("rule not created: %d", code)
+	}
+	rules := db.ListRules()
+	if len(rules) != 1 {
+		t.Fatalf("invalid rules: %#v", rules)
+	}
+
+	code, body := doRequest(handler, "POST", "/api/rules/test", fmt.Sprintf(`{"id": %d, "limit": 10}`, rules[0].Id))
+	var result struct {
+		Checked int            `json:"checked"`
+		Items   []storage.Item `json:"items"`
+	}
+	if err := json.Unmarshal([]byte(body), &result); err != nil || code != 200 {
+		t.Fatalf("unexpected response: %d %s", code, body)
+	}
+	if result.Checked != 2 || len(result.Items) != 1 || result.Items[0].GUID != "1" {
+		t.Fatalf("invalid dry run: %s", body)
+	}
+	// the dry run leaves the items as they were
+	if have := db.GetItem(result.Items[0].Id); have.Status != storage.UNREAD {
+		t.Fatalf("unexpected item status: %v", have.Status)
+	}
+
+	if code, _ := doRequest(handler, "DELETE", fmt.Sprintf("/api/rules/%d", rules[0].Id), ""); code != 204 {
+		t.Fatalf("rule not deleted: %d", code)
+	}
+	if code, _ := doRequest(handler, "PUT", fmt.Sprintf("/api/rules/%d", rules[0].Id), rule); code != 404 {
+		t.Fatalf("unexpected response: %d", code)
+	}
+}
+
+func TestWebhookItemStarred(t *testing.T) {
+	received := make(chan *http.Request, 1)
+	bodies := make(chan []byte, 1)
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		received <- r
+		bodies <- body
+	}))
+	defer receiver.Close()
+
+	db := newTestFileDB(t)
+	feed := db.CreateFeed("feed", "", "", "http://example.com/feed.xml", nil)
+	db.CreateItems([]storage.Item{{GUID: "1", FeedId: feed.Id, Title: "Hello", Link: "http://example.com/1", Date: time.Now()}})
+	item := db.ListItems(storage.ItemFilter{}, 1, false, false)[0]
+
+	handler := NewServer(db, "127.0.0.1:8000").handler()
+
+	if code, _ := doRequest(handler, "POST", "/api/webhooks", `{"url": "ftp://example.com", "events": ["item.starred"]}`); code != 400 {
+		t.Fatalf("expected invalid url, got %d", code)
+	}
+	code, body := doRequest(handler, "POST", "/api/webhooks", `{"url": "`+receiver.URL+`", "events": ["item.starred"], "enabled": true}`)
+	var hook storage.Webhook
+	if err := json.Unmarshal([]byte(body), &hook); err != nil || code != 201 || hook.Secret == "" {
+		t.Fatalf("webhook not created: %d %s", code, body)
+	}
+	if _, body := doRequest(handler, "GET", "/api/webhooks", ""); strings.Contains(body, hook.Secret) {
+		t.Fatalf("expected the secret to be masked: %s", body)
+	}
+
+	doRequest(handler, "PUT", fmt.Sprintf("/api/items/%d", item.Id), `{"status": "starred"}`)
+	var r *http.Request
+	select {
+	case r = <-received:
+	case <-time.After(5 * time.Second):
+		t.Fatal("webhook not delivered")
+	}
+	payload := <-bodies
+	if r.Header.Get("X-Yarr-Event") != "item.starred" {
+		t.Errorf("invalid event: %s", r.Header.Get("X-Yarr-Event"))
+	}
+	mac := hmac.New(sha256.New, []byte(hook.Secret))
+	mac.Write(payload)
+	if want := "sha256=" + hex.EncodeToString(mac.Sum(nil)); r.Header.Get("X-Yarr-Signature") != want {
+		t.Errorf("invalid signature: %s", r.Header.Get("X-Yarr-Signature"))
+	}
+	if !strings.Contains(string(payload), `"title":"Hello"`) {
+		t.Errorf("invalid payload: %s", payload)
+	}
+
+	// starring the item again isn't reported
+	doRequest(handler, "PUT", fmt.Sprintf("/api/items/%d", item.Id), `{"status": "starred"}`)
+	for start := time.Now(); time.Since(start) < 5*time.Second; time.Sleep(10 * time.Millisecond) {
+		if deliveries := db.ListWebhookDeliveries(hook.Id); len(deliveries) == 1 && deliveries[0].DeliveredAt != nil {
+			break
+		}
+	}
+	deliveries := db.ListWebhookDeliveries(hook.Id)
+	if len(deliveries) != 1 || deliveries[0].Status != 200 || deliveries[0].Attempts != 1 {
+		t.Fatalf("invalid deliveries: %#v", deliveries)
+	}
+}
+
+// Minimal smtp server keeping the messages received.
+func smtpSink(t *testing.T) (string, <-chan string) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { ln.Close() })
+	messages := make(chan string, 10)
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				r := bufio.NewReader(conn)
+				fmt.Fprint(conn, "220 sink\r\n")
+				for {
+					line, err := r.ReadString('\n')
+					if err != nil {
+						return
+					}
+					switch cmd := strings.ToUpper(strings.TrimSpace(line)); {
+					case strings.HasPrefix(cmd, "EHLO"), strings.HasPrefix(cmd, "HELO"):
+						fmt.Fprint(conn, "250 sink\r\n")
+					case cmd == "DATA":
+						fmt.Fprint(conn, "354 go ahead\r\n")
+						var msg strings.Builder
+						for {
+							line, err := r.ReadString('\n')
+							if err != nil || line == ".\r\n" {
+								break
+							}
+							msg.WriteString(line)
+						}
+						messages <- msg.String()
+						fmt.Fprint(conn, "250 ok\r\n")
+					case cmd == "QUIT":
+						fmt.Fprint(conn, "221 bye\r\n")
+						return
+					default:
+						fmt.Fprint(conn, "250 ok\r\n")
+					}
+				}
+			}()
+		}
+	}()
+	return ln.Addr().String(), messages
+}
+
+func TestDigestSend(t *testing.T) {
+	addr, messages := smtpSink(t)
+
+	db := newTestDB(t)
+	feed := db.CreateFeed("Example", "", "", "http://example.com/feed.xml", nil)
+	db.CreateItems([]storage.Item{
+		{GUID: "1", FeedId: feed.Id, Title: "Hello <world>", Link: "http://example.com/1", Content: "<p>First</p>", Date: time.Now()},
+	})
+
+	server := NewServer(db, "127.0.0.1:8000")
+	handler := server.handler()
+
+	if code, _ := doRequest(handler, "POST", "/api/digests", `{"title": "Morning", "email": "nope", "schedule": "daily"}`); code != 400 {
+		t.Fatalf("expected invalid email, got %d", code)
+	}
+	code, body := doRequest(handler, "POST", "/api/digests", `{"title": "Morning", "email": "me@example.com", "schedule": "daily", "hour": 7, "enabled": true}`)
+	var digest storage.Digest
+	if err := json.Unmarshal([]byte(body), &digest); err != nil || code != 201 {
+		t.Fatalf("digest not created: %d %s", code, body)
+	}
+	sendURL := fmt.Sprintf("/api/digests/%d/send", digest.Id)
+
+	if code, body := doRequest(handler, "POST", sendURL, ""); code != 400 || !strings.Contains(body, "SMTP") {
+		t.Fatalf("unexpected response: %d %s", code, body)
+	}
+	server.worker.SetSMTP(worker.SMTPConfig{Addr: addr, From: "yarr@example.com"})
+
+	if code, body := doRequest(handler, "GET", fmt.Sprintf("/api/digests/%d/preview", digest.Id), ""); code != 200 || !strings.Contains(body, "Hello &lt;world&gt;") {
+		t.Fatalf("unexpected preview: %d %s", code, body)
+	}
+	if code, body := doRequest(handler, "POST", sendURL, ""); code != 200 || !strings.Contains(body, `{"items":1}`) {
+		t.Fatalf("unexpected response: %d %s", code, body)
+	}
+	select {
+	case msg := <-messages:
+		for _, want := range []string{"To: me@example.com", "Subject: Morning: 1 unread", "text/html", "http://example.com/1", "First"} {
+			if !strings.Contains(msg, want) {
+				t.Errorf("expected %q in the message:\n%s", want, msg)
+			}
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("digest not received")
+	}
+
+	// the items aren't repeated
+	if code, body := doRequest(handler, "POST", sendURL, ""); code != 200 || !strings.Contains(body, `{"items":0}`) {
+		t.Fatalf("unexpected response: %d %s", code, body)
+	}
+	select {
+	case msg := <-messages:
+		t.Fatalf("unexpected message: %s", msg)
+	default:
+	}
+}
+
+func TestMediaDownload(t *testing.T) {
+	episode := []byte("0123456789abcdef")
+
+	db := newTestFileDB(t)
+	feed := db.CreateFeed("podcast", "", "", "http://example.com/feed.xml", nil)
+	db.CreateItems([]storage.Item{
+		{GUID: "1", FeedId: feed.Id, Date: time.Now().Add(-time.Hour), MediaLinks: storage.MediaLinks{{URL: "http://example.com/1.mp3", Type: "audio"}}},
+		{GUID: "2", FeedId: feed.Id, Date: time.Now(), MediaLinks: storage.MediaLinks{{URL: "http://example.com/2.mp3", Type: "audio"}}},
+	})
+
+	server := NewServer(db, "127.0.0.1:8000")
+	handler := server.handler()
+
+	// the policy is updated on a server without the media dir,
+	// the sync started by the update doesn't race with the files written below
+	settings := NewServer(db, "127.0.0.1:8000").handler()
+	feedURL := fmt.Sprintf("/api/feeds/%d", feed.Id)
+	if status, _ := doRequest(settings, "PUT", feedURL, `{"media_download": {"max_size": -1}}`); status != 400 {
+		t.Fatalf("expected invalid policy, got %d", status)
+	}
+	if status, _ := doRequest(settings, "PUT", feedURL, `{"media_download": {"max_size": 10}}`); status != 200 {
+		t.Fatalf("unexpected status: %d", status)
+	}
+
+	// the files as downloaded by the worker
+	dir := t.TempDir()
+	server.worker.SetMediaDir(dir)
+	db.QueueFeedMedia(feed.Id, *db.GetFeed(feed.Id).MediaDownload)
+	os.MkdirAll(filepath.Join(dir, fmt.Sprint(feed.Id)), 0755)
+	for _, m := range db.ListPendingMedia() {
+		m.Status = storage.MediaDone
+		m.Path = fmt.Sprintf("%d/%d-%d.mp3", feed.Id, m.ItemID, m.Id)
+		m.ContentType = "audio/mpeg"
+		m.Size = int64(len(episode))
+		os.WriteFile(filepath.Join(dir, filepath.FromSlash(m.Path)), episode, 0644)
+		db.UpdateItemMedia(m)
+	}
+
+	items := db.ListItems(storage.ItemFilter{}, 10, true, false)
+	var item storage.Item
+	_, body := doRequest(handler, "GET", fmt.Sprintf("/api/items/%d", items[0].Id), "")
+	json.Unmarshal([]byte(body), &item)
+	if len(item.Media) != 1 || item.Media[0].Status != storage.MediaDone || item.Media[0].Size != int64(len(episode)) {
+		t.Fatalf("invalid media: %#v", item.Media)
+	}
+
+	mediaURL := fmt.Sprintf("/api/media/%d", item.Media[0].Id)
+	req := httptest.NewRequest("GET", mediaURL, nil)
+	req.Header.Set("Range", "bytes=2-5")
+	req.Header.Set("Accept-Encoding", "gzip")
+	res := serve(handler, req)
+	data, _ := io.ReadAll(res.Body)
+	if res.StatusCode != 206 || string(data) != "2345" || res.Header.Get("Content-Type") != "audio/mpeg" {
+		t.Fatalf("unexpected response: %d %q %v", res.StatusCode, data, res.Header)
+	}
+	if res.Header.Get("X-Content-Type-Options") != "nosniff" || res.Header.Get("Content-Security-Policy") != "sandbox" {
+		t.Fatalf("missing security headers: %v", res.Header)
+	}
+
+	// the files are deleted along with the items
+	older := db.ListItemMedia(items[1].Id)
+	if len(older) != 1 || older[0].Status != storage.MediaDone {
+		t.Fatalf("invalid media: %#v", older)
+	}
+	db.UpdateFeedRetention(feed.Id, &storage.RetentionPolicy{Mode: storage.RetentionItems, Limit: 1})
+	db.DeleteOldItems()
+	server.worker.SyncMedia()
+	files, _ := filepath.Glob(filepath.Join(dir, "*", "*"))
+	if len(files) != 1 || !strings.HasSuffix(files[0], fmt.Sprintf("-%d.mp3", item.Media[0].Id)) {
+		t.Fatalf("unexpected files: %v", files)
+	}
+	if status, _ := doRequest(handler, "GET", fmt.Sprintf("/api/media/%d", older[0].Id), ""); status != 404 {
+		t.Fatalf("expected the media of the deleted item to be gone, got %d", status)
+	}
+}
+
+func TestItemPlayback(t *testing.T) {
+	db := newTestDB(t)
+	feed := db.CreateFeed("podcast", "", "", "http://example.com/feed.xml", nil)
+	db.CreateItems([]storage.Item{
+		{GUID: "1", FeedId: feed.Id, Status: storage.UNREAD, MediaLinks: storage.MediaLinks{{URL: "http://example.com/1.mp3", Type: "audio"}}},
+	})
+	itemID := db.ListItems(storage.ItemFilter{}, 1, true, false)[0].Id
+
+	handler := NewServer(db, "127.0.0.1:8000").handler()
+	request := func(method, url, body string, result interface{}) int {
+		status, data := doRequest(handler, method, url, body)
+		if result != nil {
+			json.Unmarshal([]byte(data), result)
+		}
+		return status
+	}
+
+	url := fmt.Sprintf("/api/items/%d/playback", itemID)
+	if status := request("PUT", url, `{"url": "http://example.com/other.mp3", "position": 10}`, nil); status != 400 {
+		t.Fatalf("expected unknown enclosure to be rejected, got %d", status)
+	}
+	if status := request("PUT", url, `{"url": "http://example.com/1.mp3", "position": 10, "duration": 100}`, nil); status != 200 {
+		t.Fatalf("unexpected status: %d", status)
+	}
+
+	var item storage.Item
+	request("GET", fmt.Sprintf("/api/items/%d", itemID), "", &item)
+	if item.Playback == nil || item.Playback.Position != 10 || item.Playback.Completed {
+		t.Fatalf("invalid playback: %#v", item.Playback)
+	}
+	var list []storage.Item
+	request("GET", "/api/playback", "", &list)
+	if len(list) != 1 || list[0].Id != itemID || list[0].Playback == nil {
+		t.Fatalf("invalid continue listening list: %#v", list)
+	}
+
+	// the outdated progress is ignored, responding with the saved one
+	var playback storage.ItemPlayback
+	outdated := `{"url": "http://example.com/1.mp3", "position": 5, "duration": 100, "updated_at": "2000-01-01T00:00:00Z"}`
+	if status := request("PUT", url, outdated, &playback); status != 200 || playback.Position != 10 {
+		t.Fatalf("expected the outdated playback to be ignored, got %d: %#v", status, playback)
+	}
+
+	request("PUT", url, `{"url": "http://example.com/1.mp3", "position": 100, "completed": true}`, &playback)
+	if !playback.Completed {
+		t.Fatalf("expected the playback to be completed: %#v", playback)
+	}
+	if status := db.GetItem(itemID).Status; status != storage.READ {
+		t.Fatalf("expected the item to be read, have: %d", status)
+	}
+	list = nil
+	request("GET", "/api/playback", "", &list)
+	if len(list) != 0 {
+		t.Fatalf("expected empty continue listening list: %#v", list)
+	}
+}
+
+func TestMediaContentType(t *testing.T) {
+	testcases := map[string]string{
+		"audio/mpeg":               "audio/mpeg",
+		"video/mp4; codecs=avc1":   "video/mp4; codecs=avc1",
+		"image/jpeg":               "image/jpeg",
+		"image/svg+xml":            "application/octet-stream",
+		"text/html; charset=utf-8": "application/octet-stream",
+		"application/xhtml+xml":    "application/octet-stream",
+		"":                         "application/octet-stream",
+	}
+	for contentType, want := range testcases {
+		if have := mediaContentType(contentType); have != want {
+			t.Errorf("%q: want %q, have %q", contentType, want, have)
+		}
+	}
+}
+
+func TestItemRevisionsNotFound(t *testing.T) {
+	db := newTestDB(t)
+
+	if status, _ := doRequest(NewServer(db, "127.0.0.1:8000").handler(), "GET", "/api/items/100/revisions", ""); status != http.StatusNotFound {
+		t.Fatalf("unexpected status: %d", status)
+	}
+}
+
+func TestFeedUpdateInvalid(t *testing.T) {
+	db := newTestDB(t)
+	feed := db.CreateFeed("feed", "", "", "http://example.com/feed.xml", nil)
+
+	// nothing is saved if any of the fields is invalid
+	update := `{"title": "renamed", "paused": true, "refresh_interval": 0}`
+	url := fmt.Sprintf("/api/feeds/%d", feed.Id)
+	if status, _ := doRequest(NewServer(db, "127.0.0.1:8000").handler(), "PUT", url, update); status != http.StatusBadRequest {
+		t.Fatalf("unexpected status: %d", status)
+	}
+	if have := db.GetFeed(feed.Id); have.Title != "feed" || have.PausedAt != nil {
+		t.Fatalf("feed partially updated: %#v", have)
+	}
+}
+
+func TestTagRenameConflict(t *testing.T) {
+	db := newTestDB(t)
+	news := db.CreateTag("news")
+	db.CreateTag("tech")
+
+	handler := NewServer(db, "127.0.0.1:8000").handler()
+	rename := func(title string) int {
+		status, _ := doRequest(handler, "PUT", fmt.Sprintf("/api/tags/%d", news.Id), `{"title": "`+title+`"}`)
+		return status
+	}
+
+	if code := rename("tech"); code != http.StatusConflict {
+		t.Fatalf("unexpected status: %d", code)
+	}
+	if code := rename("news"); code != http.StatusOK {
+		t.Fatalf("unexpected status: %d", code)
+	}
+	if status, _ := doRequest(handler, "PUT", "/api/tags/100", `{"title": "missing"}`); status != http.StatusNotFound {
+		t.Fatalf("unexpected status: %d", status)
+	}
+	for _, tag := range db.ListTags() {
+		if tag.Id == news.Id && tag.Title != "news" {
+			t.Fatalf("tag renamed: %#v", tag)
+		}
+	}
+}
+
+func TestFolderUpdate(t *testing.T) {
+	db := newTestDB(t)
+	folder := db.CreateFolder("folder", nil)
+	db.UpdateFolderRetention(folder.Id, &storage.RetentionPolicy{Mode: storage.RetentionItems, Limit: 10})
+	handler := NewServer(db, "127.0.0.1:8000").handler()
+	url := fmt.Sprintf("/api/folders/%d", folder.Id)
+	getFolder := func() storage.Folder {
+		for _, f := range db.ListFolders() {
+			if f.Id == folder.Id {
+				return f
+			}
+		}
+		t.Fatal("folder not found")
+		return storage.Folder{}
+	}
+
+	// nothing is saved if the policy is invalid
+	if status, _ := doRequest(handler, "PUT", url, `{"title": "renamed", "retention": {"mode": "items", "limit": -1}}`); status != http.StatusBadRequest {
+		t.Fatalf("unexpected status: %d", status)
+	}
+	if have := getFolder(); have.Title != "folder" || have.Retention == nil {
+		t.Fatalf("folder partially updated: %#v", have)
+	}
+
+	// the policy is kept unless given
+	if status, _ := doRequest(handler, "PUT", url, `{"title": "renamed"}`); status != http.StatusOK {
+		t.Fatalf("unexpected status: %d", status)
+	}
+	if have := getFolder(); have.Title != "renamed" || have.Retention == nil {
+		t.Fatalf("invalid folder: %#v", have)
+	}
+	if status, _ := doRequest(handler, "PUT", url, `{"retention": null}`); status != http.StatusOK {
+		t.Fatalf("unexpected status: %d", status)
+	}
+	if have := getFolder(); have.Retention != nil {
+		t.Fatalf("policy not cleared: %#v", have.Retention)
+	}
+}
+
+func TestFolderUpdateRejected(t *testing.T) {
+	db := newTestDB(t)
+	news := db.CreateFolder("news", nil)
+	child := db.CreateFolder("child", &news.Id)
+	db.CreateFolder("tech", nil)
+	handler := NewServer(db, "127.0.0.1:8000").handler()
+	url := fmt.Sprintf("/api/folders/%d", news.Id)
+
+	testcases := []struct {
+		url    string
+		body   string
+		status int
+	}{
+		{url, `{"title": "tech"}`, http.StatusConflict},
+		{url, fmt.Sprintf(`{"parent_id": %d}`, child.Id), http.StatusBadRequest},
+		// neither of the changes is saved
+		{url, fmt.Sprintf(`{"title": "renamed", "parent_id": %d}`, child.Id), http.StatusBadRequest},
+		// the titles are unique among the siblings only
+		{fmt.Sprintf("/api/folders/%d", child.Id), `{"title": "tech"}`, http.StatusOK},
+		{"/api/folders/100", `{"title": "missing"}`, http.StatusNotFound},
+	}
+	for _, tc := range testcases {
+		if status, body := doRequest(handler, "PUT", tc.url, tc.body); status != tc.status {
+			t.Errorf("%s %s: want %d, have %d %s", tc.url, tc.body, tc.status, status, body)
+		}
+	}
+	for _, folder := range db.ListFolders() {
+		if folder.Id == news.Id && (folder.Title != "news" || folder.ParentId != nil) {
+			t.Fatalf("folder updated: %#v", folder)
+		}
+	}
+}
@@ -7,6 +7,7 @@ import (
 	"os"
 	"strings"
 	"sync"
+	"time"
 
 	"github.com/nkanaev/yarr/src/storage"
 	"github.com/nkanaev/yarr/src/worker"
@@ -27,6 +28,20 @@ type Server struct {
 	// https
 	CertFile string
 	KeyFile  string
+	// scheduled backups
+	BackupDir      string
+	BackupInterval time.Duration
+	BackupKeep     int
+	// externally reachable url of the service, enables websub push subscriptions
+	PublicURL string
+	// feed fetching limits
+	FetchConcurrency     int
+	FetchHostConcurrency int
+	FetchHostDelay       time.Duration
+	// server sending the email digests, disabled if the address is empty
+	SMTP worker.SMTPConfig
+	// directory of the downloaded enclosures, disabled if empty
+	MediaDir string
 }
 
 func NewServer(db *storage.Storage, addr string) *Server {
@@ -49,12 +64,25 @@ func (h *Server) GetAddr() string {
 
 func (s *Server) Start() {
 	refreshRate := s.db.GetSettingsValueInt64("refresh_rate")
+	s.worker.SetFetchLimits(s.FetchConcurrency, s.FetchHostConcurrency, s.FetchHostDelay)
 	s.worker.FindFavicons()
 	s.worker.StartFeedCleaner()
-	s.worker.SetRefreshRate(refreshRate)
-	if refreshRate > 0 {
-		s.worker.RefreshFeeds()
+	s.worker.StartWebhooks()
+	if s.BackupDir != "" && s.BackupInterval > 0 {
+		s.worker.StartBackups(s.BackupDir, s.BackupInterval, s.BackupKeep)
+	}
+	if s.PublicURL != "" {
+		s.worker.StartWebSub(strings.TrimSuffix(s.PublicURL, "/") + "/websub/")
+	}
+	if s.MediaDir != "" {
+		s.worker.StartMediaDownloads(s.MediaDir)
 	}
+	if s.SMTP.Addr != "" {
+		s.worker.SetSMTP(s.SMTP)
+		s.worker.StartDigests()
+	}
+	// the feeds due for refresh are picked up by the scheduler right away
+	s.worker.SetRefreshRate(refreshRate)
 
 	var ln net.Listener
 	var err error
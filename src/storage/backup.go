@@ -0,0 +1,243 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/mattn/go-sqlite3"
+)
+
+// Copy the database into a standalone file using the online backup api,
+// which is safe to use while the database is being written to.
+// The file is written under a temporary name, and renamed once complete.
+// The secrets of the feed request options are left out.
+func (s *Storage) Backup(path string) error {
+	tmp := path + ".tmp"
+	if err := os.Remove(tmp); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	if err := s.backup(tmp); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+func (s *Storage) backup(path string) error {
+	dsn, err := fileURI(path, "")
+	if err != nil {
+		return err
+	}
+	dst, err := sql.Open("sqlite3", dsn)
+	if err != nil {
+		return err
+	}
+	defer dst.Close()
+
+	ctx := context.Background()
+	dstConn, err := dst.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer dstConn.Close()
+	srcConn, err := s.db.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer srcConn.Close()
+
+	err = dstConn.Raw(func(dstRaw any) error {
+		return srcConn.Raw(func(srcRaw any) error {
+			dstSqlite, ok1 := dstRaw.(*sqlite3.SQLiteConn)
+			srcSqlite, ok2 := srcRaw.(*sqlite3.SQLiteConn)
+			if !ok1 || !ok2 {
+				return fmt.Errorf("unexpected database driver")
+			}
+			backup, err := dstSqlite.Backup("main", srcSqlite, "main")
+			if err != nil {
+				return err
+			}
+			for {
+				// copied in batches, letting the writers in between
+				done, err := backup.Step(256)
+				if err != nil {
+					backup.Close()
+					return err
+				}
+				if done {
+					return backup.Finish()
+				}
+				time.Sleep(time.Millisecond * 10)
+			}
+		})
+	})
+	if err != nil {
+		return err
+	}
+	return removeSecrets(ctx, dstConn)
+}
+
+// Strip the secrets from the request options of the copy, overwriting the previous values.
+func removeSecrets(ctx context.Context, conn *sql.Conn) error {
+	if _, err := conn.ExecContext(ctx, `pragma secure_delete = on`); err != nil {
+		return err
+	}
+	rows, err := conn.QueryContext(ctx, `select feed_id, options from feed_request_options`)
+	if err != nil {
+		return err
+	}
+	options := make(map[int64]RequestOptions)
+	for rows.Next() {
+		var feedID int64
+		var opts RequestOptions
+		if err = rows.Scan(&feedID, &opts); err != nil {
+			rows.Close()
+			return err
+		}
+		options[feedID] = opts.WithoutSecrets()
+	}
+	rows.Close()
+	if err = rows.Err(); err != nil {
+		return err
+	}
+
+	for feedID, opts := range options {
+		if opts.IsEmpty() {
+			_, err = conn.ExecContext(ctx, `delete from feed_request_options where feed_id = ?`, feedID)
+		} else {
+			_, err = conn.ExecContext(ctx, `update feed_request_options set options = ? where feed_id = ?`, opts, feedID)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Check that the file is an intact yarr database
+// not created by a newer version of the app.
+func ValidateBackup(path string) error {
+	if _, err := os.Stat(path); err != nil {
+		return err
+	}
+	dsn, err := fileURI(path, "mode=ro&immutable=1")
+	if err != nil {
+		return err
+	}
+	db, err := sql.Open("sqlite3", dsn)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	var integrity string
+	if err = db.QueryRow(`pragma integrity_check`).Scan(&integrity); err != nil {
+		return err
+	}
+	if integrity != "ok" {
+		return fmt.Errorf("integrity check failed: %s", integrity)
+	}
+
+	var version int64
+	if err = db.QueryRow(`pragma user_version`).Scan(&version); err != nil {
+		return err
+	}
+	if version > maxVersion {
+		return fmt.Errorf("backup made by a newer version (schema %d, supported %d)", version, maxVersion)
+	}
+
+	var numTables int
+	err = db.QueryRow(`
+		select count(*) from sqlite_master
+		where type = 'table' and name in ('folders', 'feeds', 'items', 'settings')
+	`).Scan(&numTables)
+	if err != nil {
+		return err
+	}
+	if numTables != 4 {
+		return fmt.Errorf("not a yarr database")
+	}
+	return nil
+}
+
+// Replace the database file with the backup. Must be called before the database is opened.
+// The current database is kept next to it with the `.old` suffix.
+// The backup is migrated to the current schema once opened with `New`.
+func Restore(backupPath, path string) error {
+	if err := ValidateBackup(backupPath); err != nil {
+		return err
+	}
+
+	tmp := path + ".restore"
+	if err := copyFile(backupPath, tmp); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+
+	if _, err := os.Stat(path); err == nil {
+		// merge the write-ahead log into the database file before moving it
+		dsn, err := fileURI(path, "")
+		if err != nil {
+			return err
+		}
+		db, err := sql.Open("sqlite3", dsn)
+		if err != nil {
+			return err
+		}
+		_, err = db.Exec(`pragma wal_checkpoint(truncate)`)
+		db.Close()
+		if err != nil {
+			return err
+		}
+		if err = os.Rename(path, path+".old"); err != nil {
+			return err
+		}
+	}
+	for _, suffix := range []string{"-wal", "-shm"} {
+		if err := os.Remove(path + suffix); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	return os.Rename(tmp, path)
+}
+
+// The uri of the database file, with the characters of the path
+// meaningful in uris (`?`, `#`, `%`) escaped.
+func fileURI(path, query string) (string, error) {
+	path, err := filepath.Abs(path)
+	if err != nil {
+		return "", err
+	}
+	path = filepath.ToSlash(path)
+	if !strings.HasPrefix(path, "/") {
+		// windows drive letter
+		path = "/" + path
+	}
+	uri := url.URL{Scheme: "file", Path: path, RawQuery: query}
+	return uri.String(), nil
+}
+
+func copyFile(src, dst string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	out, err := os.Create(dst)
+	if err != nil {
+		return err
+	}
+	if _, err = io.Copy(out, in); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
@@ -0,0 +1,137 @@
+package storage
+
+import (
+	"bytes"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestBackupRestore(t *testing.T) {
+	log.SetOutput(io.Discard)
+	defer log.SetOutput(os.Stderr)
+
+	dir := t.TempDir()
+	db, err := New(filepath.Join(dir, "storage.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	db.CreateFeed("feed", "", "", "http://example.com/feed.xml", nil)
+
+	backupPath := filepath.Join(dir, "backup.db")
+	if err := db.Backup(backupPath); err != nil {
+		t.Fatal(err)
+	}
+	if err := ValidateBackup(backupPath); err != nil {
+		t.Fatal(err)
+	}
+	db.CreateFeed("feed2", "", "", "http://example.com/feed2.xml", nil)
+
+	invalidPath := filepath.Join(dir, "invalid.db")
+	os.WriteFile(invalidPath, []byte("not a database"), 0644)
+	if err := ValidateBackup(invalidPath); err == nil {
+		t.Fatal("expected invalid backup to fail validation")
+	}
+
+	restorePath := filepath.Join(dir, "restored.db")
+	if err := Restore(backupPath, restorePath); err != nil {
+		t.Fatal(err)
+	}
+	restored, err := New(restorePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if feeds := restored.ListFeeds(); len(feeds) != 1 || feeds[0].Title != "feed" {
+		t.Fatalf("invalid restored feeds: %#v", feeds)
+	}
+}
+
+func TestBackupRestoreSpecialPath(t *testing.T) {
+	log.SetOutput(io.Discard)
+	defer log.SetOutput(os.Stderr)
+
+	// the characters with a special meaning in the file uris
+	dir := filepath.Join(t.TempDir(), "a?b#c%41d")
+	if err := os.Mkdir(dir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	db, err := New(filepath.Join(t.TempDir(), "storage.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	db.CreateFeed("feed", "", "", "http://example.com/feed.xml", nil)
+
+	backupPath := filepath.Join(dir, "backup?mode=memory.db")
+	if err := db.Backup(backupPath); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(backupPath); err != nil {
+		t.Fatal(err)
+	}
+	if err := ValidateBackup(backupPath); err != nil {
+		t.Fatal(err)
+	}
+
+	restorePath := filepath.Join(dir, "restored%20.db")
+	os.WriteFile(restorePath, nil, 0644)
+	if err := Restore(backupPath, restorePath); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(restorePath + ".old"); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestBackupSecrets(t *testing.T) {
+	log.SetOutput(io.Discard)
+	defer log.SetOutput(os.Stderr)
+
+	dir := t.TempDir()
+	db, err := New(filepath.Join(dir, "storage.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	feed1 := db.CreateFeed("feed1", "", "", "http://example.com/feed1.xml", nil)
+	feed2 := db.CreateFeed("feed2", "", "", "http://example.com/feed2.xml", nil)
+	db.UpdateFeedRequestOptions(feed1.Id, &RequestOptions{
+		Username:  "user",
+		Password:  "secret-password",
+		Cookie:    "session=secret-cookie",
+		UserAgent: "agent",
+		Headers:   map[string]string{"X-Api-Key": "secret-key"},
+	})
+	db.UpdateFeedRequestOptions(feed2.Id, &RequestOptions{Token: "secret-token"})
+
+	backupPath := filepath.Join(dir, "backup.db")
+	if err := db.Backup(backupPath); err != nil {
+		t.Fatal(err)
+	}
+	// not even in the free pages
+	data, err := os.ReadFile(backupPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Contains(data, []byte("secret-")) {
+		t.Fatal("the backup contains the secrets")
+	}
+
+	backup, err := New(backupPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if have := backup.GetFeedRequestOptions(feed1.Id); have == nil || have.Username != "user" || have.UserAgent != "agent" {
+		t.Fatalf("invalid options in the backup: %#v", have)
+	}
+	if have := backup.GetFeedRequestOptions(feed1.Id); have.Password != "" || have.Cookie != "" || len(have.Headers) != 0 {
+		t.Fatalf("the secrets kept in the backup: %#v", have)
+	}
+	if have := backup.GetFeedRequestOptions(feed2.Id); have != nil {
+		t.Fatalf("expected the options without secrets to be removed: %#v", have)
+	}
+	// the database keeps them
+	if have := db.GetFeedRequestOptions(feed1.Id); have == nil || have.Password != "secret-password" {
+		t.Fatalf("invalid options: %#v", have)
+	}
+}
@@ -0,0 +1,261 @@
+package storage
+
+import (
+	"database/sql"
+	"fmt"
+	"log"
+	"net/mail"
+	"time"
+)
+
+const (
+	DigestDaily  = "daily"
+	DigestWeekly = "weekly"
+)
+
+// Number of the unread items sent in a single digest at most.
+var digestItemLimit = 100
+
+// Delay before sending the digest again after a failure, doubled with each consecutive one.
+const (
+	digestRetryDelay    = time.Minute * 5
+	maxDigestRetryDelay = time.Hour * 6
+)
+
+// Email of the unread items of a folder or a smart feed, sent on a schedule.
+// All the unread items are included if neither is given.
+type Digest struct {
+	Id    int64  `json:"id"`
+	Title string `json:"title"`
+	Email string `json:"email"`
+	// daily or weekly
+	Schedule string `json:"schedule"`
+	// hour of the day (local time) & the day of the week (weekly only, 0 is sunday) to send the digest at
+	Hour    int `json:"hour"`
+	Weekday int `json:"weekday"`
+
+	FolderID    *int64 `json:"folder_id"`
+	SmartFeedID *int64 `json:"smartfeed_id"`
+	Enabled     bool   `json:"enabled"`
+
+	CreatedAt time.Time  `json:"created_at"`
+	SentAt    *time.Time `json:"sent_at"`
+	// the latest failed attempt to send the digest & the number of the consecutive ones
+	FailedAt *time.Time `json:"failed_at"`
+	Failures int        `json:"failures"`
+}
+
+func (d Digest) Validate() error {
+	if d.Title == "" {
+		return fmt.Errorf("title missing")
+	}
+	if _, err := mail.ParseAddress(d.Email); err != nil {
+		return fmt.Errorf("invalid email")
+	}
+	if d.Schedule != DigestDaily && d.Schedule != DigestWeekly {
+		return fmt.Errorf("invalid schedule")
+	}
+	if d.Hour < 0 || d.Hour > 23 {
+		return fmt.Errorf("invalid hour")
+	}
+	if d.Weekday < 0 || d.Weekday > 6 {
+		return fmt.Errorf("invalid weekday")
+	}
+	if d.FolderID != nil && d.SmartFeedID != nil {
+		return fmt.Errorf("either folder or smart feed expected")
+	}
+	return nil
+}
+
+// Latest time the digest was scheduled for, at or before the given one.
+func (d Digest) LastSlot(now time.Time) time.Time {
+	slot := time.Date(now.Year(), now.Month(), now.Day(), d.Hour, 0, 0, 0, now.Location())
+	if d.Schedule == DigestWeekly {
+		days := (int(now.Weekday()) - d.Weekday + 7) % 7
+		slot = slot.AddDate(0, 0, -days)
+	}
+	if slot.After(now) {
+		if d.Schedule == DigestWeekly {
+			slot = slot.AddDate(0, 0, -7)
+		} else {
+			slot = slot.AddDate(0, 0, -1)
+		}
+	}
+	return slot
+}
+
+// Whether the digest hasn't been sent since it was last scheduled,
+// and the delay after the latest failure to send it has passed.
+func (d Digest) Due(now time.Time) bool {
+	last := d.CreatedAt
+	if d.SentAt != nil && d.SentAt.After(last) {
+		last = *d.SentAt
+	}
+	if d.FailedAt != nil && now.Before(d.FailedAt.Add(d.RetryDelay())) {
+		return false
+	}
+	return d.Enabled && last.Before(d.LastSlot(now))
+}
+
+// Delay before sending the digest again, following the consecutive failures.
+func (d Digest) RetryDelay() time.Duration {
+	delay := digestRetryDelay
+	for i := 1; i < d.Failures && delay < maxDigestRetryDelay; i++ {
+		delay *= 2
+	}
+	return min(delay, maxDigestRetryDelay)
+}
+
+func (s *Storage) CreateDigest(digest Digest) *Digest {
+	digest.CreatedAt = time.Now().UTC()
+	digest.SentAt = nil
+	row := s.db.QueryRow(`
+		insert into digests (title, email, schedule, hour, weekday, folder_id, smartfeed_id, enabled, created_at)
+		values (?, ?, ?, ?, ?, ?, ?, ?, ?)
+		returning id`,
+		digest.Title, digest.Email, digest.Schedule, digest.Hour, digest.Weekday,
+		digest.FolderID, digest.SmartFeedID, digest.Enabled, digest.CreatedAt,
+	)
+	if err := row.Scan(&digest.Id); err != nil {
+		log.Print(err)
+		return nil
+	}
+	return &digest
+}
+
+func (s *Storage) UpdateDigest(digest Digest) bool {
+	_, err := s.db.Exec(`
+		update digests set
+			title = ?, email = ?, schedule = ?, hour = ?, weekday = ?,
+			folder_id = ?, smartfeed_id = ?, enabled = ?
+		where id = ?`,
+		digest.Title, digest.Email, digest.Schedule, digest.Hour, digest.Weekday,
+		digest.FolderID, digest.SmartFeedID, digest.Enabled, digest.Id,
+	)
+	if err != nil {
+		log.Print(err)
+	}
+	return err == nil
+}
+
+func (s *Storage) DeleteDigest(id int64) bool {
+	_, err := s.db.Exec(`delete from digests where id = ?`, id)
+	if err != nil {
+		log.Print(err)
+	}
+	return err == nil
+}
+
+const digestColumns = `
+	id, title, email, schedule, hour, weekday, folder_id, smartfeed_id, enabled,
+	created_at, sent_at, failed_at, failures`
+
+func scanDigest(row interface{ Scan(...any) error }) (Digest, error) {
+	var d Digest
+	err := row.Scan(
+		&d.Id, &d.Title, &d.Email, &d.Schedule, &d.Hour, &d.Weekday,
+		&d.FolderID, &d.SmartFeedID, &d.Enabled,
+		&d.CreatedAt, &d.SentAt, &d.FailedAt, &d.Failures,
+	)
+	return d, err
+}
+
+func (s *Storage) GetDigest(id int64) *Digest {
+	d, err := scanDigest(s.db.QueryRow(`select `+digestColumns+` from digests where id = ?`, id))
+	if err != nil {
+		if err != sql.ErrNoRows {
+			log.Print(err)
+		}
+		return nil
+	}
+	return &d
+}
+
+func (s *Storage) ListDigests() []Digest {
+	result := make([]Digest, 0)
+	rows, err := s.db.Query(`select ` + digestColumns + ` from digests order by id`)
+	if err != nil {
+		log.Print(err)
+		return result
+	}
+	for rows.Next() {
+		d, err := scanDigest(rows)
+		if err != nil {
+			log.Print(err)
+			return result
+		}
+		result = append(result, d)
+	}
+	return result
+}
+
+// Unread items of the digest which haven't been sent yet, newest first.
+func (s *Storage) ListDigestItems(digest Digest) []Item {
+	filter := ItemFilter{FolderID: digest.FolderID}
+	if digest.SmartFeedID != nil {
+		smartFeed := s.GetSmartFeed(*digest.SmartFeedID)
+		if smartFeed == nil {
+			return nil
+		}
+		filter = smartFeed.Filter.ItemFilter()
+	}
+	unread := UNREAD
+	filter.Status = &unread
+
+	filter.NotInDigest = &digest.Id
+	return s.ListItems(filter, digestItemLimit, true, true)
+}
+
+// Record the items as sent with the digest, so that the later ones don't repeat them.
+func (s *Storage) MarkDigestSent(digestID int64, itemIDs []int64, sentAt time.Time) bool {
+	tx, err := s.db.Begin()
+	if err != nil {
+		log.Print(err)
+		return false
+	}
+	defer tx.Rollback()
+
+	for _, id := range itemIDs {
+		_, err = tx.Exec(`
+			insert into digest_items (digest_id, item_id) values (?, ?)
+			on conflict do nothing`,
+			digestID, id,
+		)
+		if err != nil {
+			break
+		}
+	}
+	if err == nil {
+		_, err = tx.Exec(`
+			update digests set sent_at = ?, failed_at = null, failures = 0 where id = ?`,
+			sentAt.UTC(), digestID,
+		)
+	}
+	if err == nil {
+		// the items deleted since
+		_, err = tx.Exec(`
+			delete from digest_items
+			where digest_id = ? and item_id not in (select id from items)`,
+			digestID,
+		)
+	}
+	if err == nil {
+		err = tx.Commit()
+	}
+	if err != nil {
+		log.Print(err)
+	}
+	return err == nil
+}
+
+// Record the failure to send the digest, postponing the next attempt (see `RetryDelay`).
+func (s *Storage) MarkDigestFailed(digestID int64, failedAt time.Time) bool {
+	_, err := s.db.Exec(`
+		update digests set failed_at = ?, failures = failures + 1 where id = ?`,
+		failedAt.UTC(), digestID,
+	)
+	if err != nil {
+		log.Print(err)
+	}
+	return err == nil
+}
@@ -0,0 +1,122 @@
+package storage
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestDigestDue(t *testing.T) {
+	// wednesday
+	now := time.Date(2024, 5, 15, 9, 30, 0, 0, time.UTC)
+	daily := Digest{Schedule: DigestDaily, Hour: 8, Enabled: true}
+	weekly := Digest{Schedule: DigestWeekly, Hour: 18, Weekday: int(time.Monday), Enabled: true}
+
+	if have, want := daily.LastSlot(now), time.Date(2024, 5, 15, 8, 0, 0, 0, time.UTC); !have.Equal(want) {
+		t.Errorf("want %s, have %s", want, have)
+	}
+	if have, want := weekly.LastSlot(now), time.Date(2024, 5, 13, 18, 0, 0, 0, time.UTC); !have.Equal(want) {
+		t.Errorf("want %s, have %s", want, have)
+	}
+	later := Digest{Schedule: DigestDaily, Hour: 10}
+	if have, want := later.LastSlot(now), time.Date(2024, 5, 14, 10, 0, 0, 0, time.UTC); !have.Equal(want) {
+		t.Errorf("want %s, have %s", want, have)
+	}
+
+	daily.CreatedAt = now.Add(-time.Hour * 24)
+	if !daily.Due(now) {
+		t.Error("expected the digest to be due")
+	}
+	sent := now.Add(-time.Hour)
+	daily.SentAt = &sent
+	if daily.Due(now) {
+		t.Error("expected the digest to be sent already")
+	}
+	weekly.CreatedAt = now.Add(-time.Hour)
+	if weekly.Due(now) {
+		t.Error("expected the new digest to wait for its schedule")
+	}
+
+	// retried with a growing delay after the failures
+	daily.SentAt = nil
+	failed := now.Add(-time.Minute * 7)
+	daily.FailedAt, daily.Failures = &failed, 1
+	if !daily.Due(now) {
+		t.Error("expected the digest to be retried")
+	}
+	daily.Failures = 2
+	if daily.Due(now) {
+		t.Error("expected the digest to wait for the retry")
+	}
+	for failures, want := range map[int]time.Duration{1: time.Minute * 5, 3: time.Minute * 20, 20: time.Hour * 6} {
+		daily.Failures = failures
+		if have := daily.RetryDelay(); have != want {
+			t.Errorf("%d failures: want %s, have %s", failures, want, have)
+		}
+	}
+}
+
+func TestDigestItems(t *testing.T) {
+	db := testDB()
+	scope := testItemsSetup(db)
+
+	digest := db.CreateDigest(Digest{
+		Title:    "folder1",
+		Email:    "me@example.com",
+		Schedule: DigestDaily,
+		FolderID: &scope.folder1.Id,
+		Enabled:  true,
+	})
+	if digest == nil {
+		t.Fatal("expected a digest")
+	}
+	if err := digest.Validate(); err != nil {
+		t.Fatal(err)
+	}
+	if have := db.GetDigest(digest.Id); have == nil || have.Title != "folder1" || have.SentAt != nil {
+		t.Fatalf("invalid digest: %#v", have)
+	}
+
+	items := db.ListDigestItems(*digest)
+	if have, want := getItemGuids(items), []string{"item121", "item111"}; !reflect.DeepEqual(have, want) {
+		t.Fatalf("want: %#v\nhave: %#v", want, have)
+	}
+	db.MarkDigestSent(digest.Id, []int64{items[0].Id}, time.Now())
+	if have, want := getItemGuids(db.ListDigestItems(*digest)), []string{"item111"}; !reflect.DeepEqual(have, want) {
+		t.Fatalf("want: %#v\nhave: %#v", want, have)
+	}
+	if have := db.GetDigest(digest.Id); have.SentAt == nil {
+		t.Fatal("expected the digest to be marked sent")
+	}
+	db.MarkDigestFailed(digest.Id, time.Now())
+	db.MarkDigestFailed(digest.Id, time.Now())
+	if have := db.GetDigest(digest.Id); have.FailedAt == nil || have.Failures != 2 {
+		t.Fatalf("expected the failures to be recorded: %#v", have)
+	}
+	db.MarkDigestSent(digest.Id, nil, time.Now())
+	if have := db.GetDigest(digest.Id); have.FailedAt != nil || have.Failures != 0 {
+		t.Fatalf("expected the failures to be reset: %#v", have)
+	}
+
+	// the older items still get sent once the newest ones are
+	defer func(limit int) { digestItemLimit = limit }(digestItemLimit)
+	digestItemLimit = 1
+	older := db.CreateDigest(Digest{Title: "older", Email: "me@example.com", Schedule: DigestDaily, FolderID: &scope.folder1.Id})
+	first := db.ListDigestItems(*older)
+	db.MarkDigestSent(older.Id, []int64{first[0].Id}, time.Now())
+	if have, want := getItemGuids(db.ListDigestItems(*older)), []string{"item111"}; !reflect.DeepEqual(have, want) {
+		t.Fatalf("want: %#v\nhave: %#v", want, have)
+	}
+	db.DeleteDigest(older.Id)
+	digestItemLimit = 100
+
+	all := db.CreateDigest(Digest{Title: "all", Email: "me@example.com", Schedule: DigestWeekly})
+	if have := db.ListDigestItems(*all); len(have) != 3 {
+		t.Fatalf("expected all the unread items, have: %#v", getItemGuids(have))
+	}
+
+	db.DeleteDigest(all.Id)
+	if have := db.ListDigests(); len(have) != 1 || have[0].Id != digest.Id {
+		t.Fatalf("invalid digests: %#v", have)
+	}
+}
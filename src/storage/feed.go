@@ -3,6 +3,7 @@ package storage
 import (
 	"database/sql"
 	"log"
+	"time"
 )
 
 type Feed struct {
@@ -14,12 +15,30 @@ type Feed struct {
 	FeedLink    string  `json:"feed_link"`
 	Icon        *[]byte `json:"icon,omitempty"`
 	HasIcon     bool    `json:"has_icon"`
+
+	Retention *RetentionPolicy `json:"retention"`
+	// refresh interval in minutes, overriding the adaptive one
+	RefreshInterval *int64 `json:"refresh_interval"`
+	// set if the feed is no longer refreshed
+	PausedAt *time.Time `json:"paused_at"`
+	// download the pages of the new items & keep the extracted article along with the feed content
+	FetchFullContent bool `json:"fetch_full_content"`
+	// download the audio & video enclosures of the items, nil if disabled
+	MediaDownload *MediaDownloadPolicy `json:"media_download"`
 }
 
 func (s *Storage) CreateFeed(title, description, link, feedLink string, folderId *int64) *Feed {
 	if title == "" {
 		title = feedLink
 	}
+	// the feed may have moved to another url since
+	if feedId := s.getFeedIdByAlias(feedLink); feedId != nil {
+		s.UpdateFeedFolder(*feedId, folderId)
+		if feed := s.GetFeed(*feedId); feed != nil {
+			feed.Icon = nil
+			return feed
+		}
+	}
 	row := s.db.QueryRow(`
 		insert into feeds (title, description, link, feed_link, folder_id) 
 		values (?, ?, ?, ?, ?)
@@ -93,7 +112,8 @@ func (s *Storage) ListFeeds() []Feed {
 	result := make([]Feed, 0)
 	rows, err := s.db.Query(`
 		select id, folder_id, title, description, link, feed_link,
-		       ifnull(length(icon), 0) > 0 as has_icon
+		       ifnull(length(icon), 0) > 0 as has_icon, retention, refresh_interval, paused_at,
+		       fetch_full_content, media_download
 		from feeds
 		order by sort_order asc, title collate nocase
 	`)
@@ -111,6 +131,11 @@ func (s *Storage) ListFeeds() []Feed {
 			&f.Link,
 			&f.FeedLink,
 			&f.HasIcon,
+			&f.Retention,
+			&f.RefreshInterval,
+			&f.PausedAt,
+			&f.FetchFullContent,
+			&f.MediaDownload,
 		)
 		if err != nil {
 			log.Print(err)
@@ -156,11 +181,13 @@ func (s *Storage) GetFeed(id int64) *Feed {
 	err := s.db.QueryRow(`
 		select
 			id, folder_id, title, link, feed_link,
-			icon, ifnull(icon, '') != '' as has_icon
+			icon, ifnull(icon, '') != '' as has_icon, retention, refresh_interval, paused_at,
+			fetch_full_content, media_download
 		from feeds where id = ?
 	`, id).Scan(
 		&f.Id, &f.FolderId, &f.Title, &f.Link, &f.FeedLink,
-		&f.Icon, &f.HasIcon,
+		&f.Icon, &f.HasIcon, &f.Retention, &f.RefreshInterval, &f.PausedAt,
+		&f.FetchFullContent, &f.MediaDownload,
 	)
 	if err != nil {
 		if err != sql.ErrNoRows {
@@ -171,12 +198,48 @@ func (s *Storage) GetFeed(id int64) *Feed {
 	return &f
 }
 
+func (s *Storage) UpdateFeedRefreshInterval(feedId int64, minutes *int64) bool {
+	_, err := s.db.Exec(`update feeds set refresh_interval = ? where id = ?`, minutes, feedId)
+	return err == nil
+}
+
+func (s *Storage) UpdateFeedFetchFullContent(feedId int64, enabled bool) bool {
+	_, err := s.db.Exec(`update feeds set fetch_full_content = ? where id = ?`, enabled, feedId)
+	return err == nil
+}
+
+// Pause or resume the refreshing of the feed. Resuming starts the failure count over.
+func (s *Storage) UpdateFeedPaused(feedId int64, paused bool) bool {
+	var err error
+	if paused {
+		_, err = s.db.Exec(`update feeds set paused_at = ? where id = ? and paused_at is null`, time.Now().UTC(), feedId)
+	} else {
+		_, err = s.db.Exec(`update feeds set paused_at = null where id = ?`, feedId)
+		if err == nil {
+			_, err = s.db.Exec(`
+				update feed_schedules set failures = 0, failing_since = null where feed_id = ?`,
+				feedId,
+			)
+		}
+	}
+	if err != nil {
+		log.Print(err)
+	}
+	return err == nil
+}
+
 func (s *Storage) ResetFeedErrors() {
 	if _, err := s.db.Exec(`delete from feed_errors`); err != nil {
 		log.Print(err)
 	}
 }
 
+func (s *Storage) ResetFeedError(feedID int64) {
+	if _, err := s.db.Exec(`delete from feed_errors where feed_id = ?`, feedID); err != nil {
+		log.Print(err)
+	}
+}
+
 func (s *Storage) SetFeedError(feedID int64, lastError error) {
 	_, err := s.db.Exec(`
 		insert into feed_errors (feed_id, error)
@@ -3,6 +3,7 @@ package storage
 import (
 	"reflect"
 	"testing"
+	"time"
 )
 
 func TestCreateFeed(t *testing.T) {
@@ -85,3 +86,75 @@ func TestDeleteFeed(t *testing.T) {
 		t.Fatal("feed still exists")
 	}
 }
+
+func TestFeedSchedule(t *testing.T) {
+	db := testDB()
+	feed := db.CreateFeed("feed", "", "", "http://test.com/feed.xml", nil)
+
+	interval := int64(30)
+	db.UpdateFeedRefreshInterval(feed.Id, &interval)
+	if have := db.GetFeed(feed.Id).RefreshInterval; have == nil || *have != interval {
+		t.Fatalf("invalid refresh interval: %v", have)
+	}
+
+	db.SetFeedChecked(feed.Id)
+	schedule, ok := db.ListFeedSchedules()[feed.Id]
+	if !ok || time.Since(schedule.LastCheck) > time.Minute || schedule.PostInterval != nil {
+		t.Fatalf("invalid schedule: %#v", schedule)
+	}
+
+	// 4 posts within the last 8 hours
+	now := time.Now().UTC()
+	db.CreateItems([]Item{
+		{GUID: "1", FeedId: feed.Id, Date: now.Add(-time.Hour * 8)},
+		{GUID: "2", FeedId: feed.Id, Date: now.Add(-time.Hour * 6)},
+		{GUID: "3", FeedId: feed.Id, Date: now.Add(-time.Hour * 4)},
+		{GUID: "4", FeedId: feed.Id, Date: now.Add(-time.Hour * 2)},
+		{GUID: "future", FeedId: feed.Id, Date: now.Add(time.Hour * 24)},
+	})
+	db.SetFeedChecked(feed.Id)
+	schedule = db.ListFeedSchedules()[feed.Id]
+	if schedule.PostInterval == nil || schedule.PostInterval.Round(time.Minute) != time.Hour*2 {
+		t.Fatalf("invalid post interval: %v", schedule.PostInterval)
+	}
+
+	db.SetFeedFetchDuration(feed.Id, time.Millisecond*1500)
+	if schedule := db.GetFeedSchedule(feed.Id); schedule.FetchDuration == nil || *schedule.FetchDuration != time.Millisecond*1500 {
+		t.Fatalf("invalid fetch duration: %v", schedule.FetchDuration)
+	}
+}
+
+func TestFeedScheduleHints(t *testing.T) {
+	db := testDB()
+	feed := db.CreateFeed("feed", "", "", "http://test.com/feed.xml", nil)
+
+	nextCheck := time.Now().Add(time.Hour)
+	db.SetFeedNextCheck(feed.Id, &nextCheck)
+	db.SetFeedSkipTimes(feed.Id, []int{0, 13}, []time.Weekday{time.Sunday})
+
+	schedule := db.ListFeedSchedules()[feed.Id]
+	if schedule.NextCheck == nil || !schedule.NextCheck.Equal(nextCheck) {
+		t.Fatalf("invalid next check: %v", schedule.NextCheck)
+	}
+
+	// 2024-01-01 is monday
+	times := map[time.Time]bool{
+		time.Date(2024, 1, 1, 0, 30, 0, 0, time.UTC):  true,
+		time.Date(2024, 1, 1, 12, 30, 0, 0, time.UTC): false,
+		time.Date(2024, 1, 1, 13, 30, 0, 0, time.UTC): true,
+		time.Date(2024, 1, 7, 12, 30, 0, 0, time.UTC): true,
+	}
+	for at, want := range times {
+		if have := schedule.Skips(at); have != want {
+			t.Errorf("%s: want %v, have %v", at, want, have)
+		}
+	}
+
+	// the check resets neither of the hints
+	db.SetFeedChecked(feed.Id)
+	db.SetFeedNextCheck(feed.Id, nil)
+	schedule = db.ListFeedSchedules()[feed.Id]
+	if schedule.NextCheck != nil || !schedule.Skips(time.Date(2024, 1, 1, 0, 30, 0, 0, time.UTC)) {
+		t.Fatalf("invalid schedule: %#v", schedule)
+	}
+}
@@ -1,7 +1,11 @@
 package storage
 
 import (
+	"database/sql"
+	"errors"
+	"fmt"
 	"log"
+	"strings"
 )
 
 type Folder struct {
@@ -9,16 +13,17 @@ type Folder struct {
 	ParentId   *int64 `json:"parent_id"`
 	Title      string `json:"title"`
 	IsExpanded bool   `json:"is_expanded"`
+
+	Retention *RetentionPolicy `json:"retention"`
 }
 
 func (s *Storage) CreateFolder(title string, parentId *int64) *Folder {
 	expanded := true
 	row := s.db.QueryRow(`
 		insert into folders (title, parent_id, is_expanded) values (?, ?, ?)
-		on conflict (title) do update set title = ?, parent_id = ?
-        returning id`,
+		on conflict (ifnull(parent_id, 0), title) do update set title = excluded.title
+		returning id`,
 		title, parentId, expanded,
-		title, parentId,
 	)
 	var id int64
 	err := row.Scan(&id)
@@ -30,12 +35,123 @@ func (s *Storage) CreateFolder(title string, parentId *int64) *Folder {
 	return &Folder{Id: id, ParentId: parentId, Title: title, IsExpanded: expanded}
 }
 
-func (s *Storage) DeleteFolder(folderId int64) bool {
-	_, err := s.db.Exec(`delete from folders where id = ?`, folderId)
+type FolderDeleteMode string
+
+const (
+	// move the feeds & subfolders to the parent of the deleted folder
+	FolderDeleteReparent FolderDeleteMode = "reparent"
+	// delete the subfolders along with all the feeds & their items
+	FolderDeleteCascade FolderDeleteMode = "cascade"
+)
+
+func (s *Storage) DeleteFolder(folderId int64, mode FolderDeleteMode) bool {
+	tx, err := s.db.Begin()
 	if err != nil {
 		log.Print(err)
+		return false
 	}
-	return err == nil
+	defer tx.Rollback()
+
+	switch mode {
+	case FolderDeleteCascade:
+		tree := folderTreeQuery(1)
+		queries := []string{
+			`delete from items where feed_id in (select id from feeds where folder_id in (` + tree + `))`,
+			`delete from feeds where folder_id in (` + tree + `)`,
+			`delete from folders where id in (` + tree + `)`,
+		}
+		for _, query := range queries {
+			if _, err = tx.Exec(query, folderId); err != nil {
+				log.Print(err)
+				return false
+			}
+		}
+	default:
+		var parentId *int64
+		if err = tx.QueryRow(`select parent_id from folders where id = ?`, folderId).Scan(&parentId); err != nil {
+			log.Print(err)
+			return false
+		}
+		if err = mergeFolder(tx, folderId, parentId); err != nil {
+			log.Print(err)
+			return false
+		}
+	}
+
+	if err = tx.Commit(); err != nil {
+		log.Print(err)
+		return false
+	}
+	return true
+}
+
+// Move the contents of the folder to another one (nil being the top level) and delete it.
+// Subfolders with the same title as an existing folder in the destination are merged recursively.
+func mergeFolder(tx *sql.Tx, srcId int64, dstId *int64) error {
+	if _, err := tx.Exec(`update feeds set folder_id = ? where folder_id = ?`, dstId, srcId); err != nil {
+		return err
+	}
+
+	type child struct {
+		id    int64
+		title string
+	}
+	children := make([]child, 0)
+	rows, err := tx.Query(`select id, title from folders where parent_id = ?`, srcId)
+	if err != nil {
+		return err
+	}
+	for rows.Next() {
+		var c child
+		if err = rows.Scan(&c.id, &c.title); err != nil {
+			rows.Close()
+			return err
+		}
+		children = append(children, c)
+	}
+	rows.Close()
+
+	for _, c := range children {
+		var existingId int64
+		err := tx.QueryRow(`
+			select id from folders where ifnull(parent_id, 0) = ifnull(?, 0) and title = ?
+		`, dstId, c.title).Scan(&existingId)
+		switch {
+		case err == sql.ErrNoRows:
+			_, err = tx.Exec(`update folders set parent_id = ? where id = ?`, dstId, c.id)
+		case err == nil:
+			err = mergeFolder(tx, c.id, &existingId)
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	_, err = tx.Exec(`delete from folders where id = ?`, srcId)
+	return err
+}
+
+// Merge the folder into another one, moving all of its feeds & subfolders.
+func (s *Storage) MergeFolders(srcId, dstId int64) bool {
+	if s.isFolderDescendant(dstId, srcId) {
+		return false
+	}
+	tx, err := s.db.Begin()
+	if err != nil {
+		log.Print(err)
+		return false
+	}
+	defer tx.Rollback()
+
+	if err = mergeFolder(tx, srcId, &dstId); err != nil {
+		log.Print(err)
+		return false
+	}
+	if err = tx.Commit(); err != nil {
+		log.Print(err)
+		return false
+	}
+	return true
 }
 
 func (s *Storage) RenameFolder(folderId int64, newTitle string) bool {
@@ -48,11 +164,61 @@ func (s *Storage) ToggleFolderExpanded(folderId int64, isExpanded bool) bool {
 	return err == nil
 }
 
+var ErrFolderCycle = errors.New("folder moved into its own subtree")
+
+// Rename the folder and/or move it under another folder (see `UpdateFolderParent`) at once,
+// nil values being left as is. Fails with ErrConflict if the parent already contains a folder with the title.
+func (s *Storage) UpdateFolder(folderId int64, title *string, parentId *int64) error {
+	if parentId != nil && s.isFolderDescendant(*parentId, folderId) {
+		return ErrFolderCycle
+	}
+	result, err := s.db.Exec(`
+		update folders
+		set title = coalesce(?, title), parent_id = coalesce(?, parent_id)
+		where id = ?`,
+		title, parentId, folderId,
+	)
+	if isUniqueViolation(err) {
+		return ErrConflict
+	}
+	if err != nil {
+		log.Print(err)
+		return err
+	}
+	if updated, _ := result.RowsAffected(); updated == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// Move the folder along with its subtree under another folder (nil being the top level).
+// Fails if the new parent is the folder itself or one of its descendants,
+// or if the new parent already contains a folder with the same title.
 func (s *Storage) UpdateFolderParent(folderId int64, parentId *int64) bool {
+	if parentId != nil && s.isFolderDescendant(*parentId, folderId) {
+		return false
+	}
 	_, err := s.db.Exec(`update folders set parent_id = ? where id = ?`, parentId, folderId)
+	if err != nil {
+		log.Print(err)
+	}
 	return err == nil
 }
 
+// Check whether the folder is the ancestor folder itself or one of its descendants.
+func (s *Storage) isFolderDescendant(folderId, ancestorId int64) bool {
+	var count int64
+	err := s.db.QueryRow(
+		`select count(*) from (`+folderTreeQuery(1)+`) where id = ?`,
+		ancestorId, folderId,
+	).Scan(&count)
+	if err != nil {
+		log.Print(err)
+		return true
+	}
+	return count > 0
+}
+
 func (s *Storage) ReorderFolders(ids []int64) {
 	tx, _ := s.db.Begin()
 	for i, id := range ids {
@@ -64,7 +230,7 @@ func (s *Storage) ReorderFolders(ids []int64) {
 func (s *Storage) ListFolders() []Folder {
 	result := make([]Folder, 0)
 	rows, err := s.db.Query(`
-		select id, parent_id, title, is_expanded
+		select id, parent_id, title, is_expanded, retention
 		from folders
 		order by sort_order asc, title collate nocase
 	`)
@@ -74,7 +240,7 @@ func (s *Storage) ListFolders() []Folder {
 	}
 	for rows.Next() {
 		var f Folder
-		err = rows.Scan(&f.Id, &f.ParentId, &f.Title, &f.IsExpanded)
+		err = rows.Scan(&f.Id, &f.ParentId, &f.Title, &f.IsExpanded, &f.Retention)
 		if err != nil {
 			log.Print(err)
 			return result
@@ -83,3 +249,79 @@ func (s *Storage) ListFolders() []Folder {
 	}
 	return result
 }
+
+// Subquery selecting the ids of the given folders along with all their descendants.
+func folderTreeQuery(numFolders int) string {
+	marks := strings.TrimSuffix(strings.Repeat("?,", numFolders), ",")
+	return `
+		with recursive tree(id) as (
+			select id from folders where id in (` + marks + `)
+			union
+			select f.id from folders f join tree t on f.parent_id = t.id
+		)
+		select id from tree`
+}
+
+// Common table expression mapping every folder (root_id) to itself
+// and all of its descendants (id).
+const folderDescendantsCTE = `
+	with recursive tree(root_id, id) as (
+		select id, id from folders
+		union
+		select t.root_id, f.id from folders f join tree t on f.parent_id = t.id
+	)`
+
+// List ids of the feeds belonging to each folder, including the ones from its subfolders.
+func (s *Storage) ListFolderFeedIDs() map[int64][]int64 {
+	result := make(map[int64][]int64)
+	rows, err := s.db.Query(folderDescendantsCTE + `
+		select t.root_id, f.id
+		from tree t
+		join feeds f on f.folder_id = t.id
+		order by t.root_id, f.id
+	`)
+	if err != nil {
+		log.Print(err)
+		return result
+	}
+	for rows.Next() {
+		var folderId, feedId int64
+		if err = rows.Scan(&folderId, &feedId); err != nil {
+			log.Print(err)
+			return result
+		}
+		result[folderId] = append(result[folderId], feedId)
+	}
+	return result
+}
+
+type FolderStat struct {
+	FolderId     int64 `json:"folder_id"`
+	UnreadCount  int64 `json:"unread"`
+	StarredCount int64 `json:"starred"`
+}
+
+// Same as `FeedStats`, aggregated per folder including the subfolders.
+func (s *Storage) FolderStats() []FolderStat {
+	result := make([]FolderStat, 0)
+	rows, err := s.db.Query(fmt.Sprintf(folderDescendantsCTE+`
+		select
+			t.root_id,
+			sum(case i.status when %d then 1 else 0 end),
+			sum(case i.status when %d then 1 else 0 end)
+		from tree t
+		join feeds f on f.folder_id = t.id
+		join items i on i.feed_id = f.id
+		group by t.root_id
+	`, UNREAD, STARRED))
+	if err != nil {
+		log.Print(err)
+		return result
+	}
+	for rows.Next() {
+		stat := FolderStat{}
+		rows.Scan(&stat.FolderId, &stat.UnreadCount, &stat.StarredCount)
+		result = append(result, stat)
+	}
+	return result
+}
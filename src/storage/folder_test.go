@@ -0,0 +1,173 @@
+package storage
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestNestedFolders(t *testing.T) {
+	db := testDB()
+	scope := testItemsSetup(db)
+
+	// folder1 > subfolder > feed11
+	subfolder := db.CreateFolder("subfolder", &scope.folder1.Id)
+	db.UpdateFeedFolder(scope.feed11.Id, &subfolder.Id)
+	// folder2 > folder1
+	db.UpdateFolderParent(scope.folder1.Id, &scope.folder2.Id)
+
+	have := getItemGuids(db.ListItems(ItemFilter{FolderID: &scope.folder2.Id}, 10, false, false))
+	want := []string{"item111", "item112", "item113", "item121", "item122", "item211", "item212"}
+	if !reflect.DeepEqual(have, want) {
+		t.Logf("want: %#v", want)
+		t.Logf("have: %#v", have)
+		t.Fail()
+	}
+	if count := db.CountItems(ItemFilter{FolderIDs: &[]int64{subfolder.Id}}); count != 3 {
+		t.Errorf("invalid subfolder item count: %d", count)
+	}
+
+	feedIds := db.ListFolderFeedIDs()
+	wantFeedIds := map[int64][]int64{
+		scope.folder1.Id: {scope.feed11.Id, scope.feed12.Id},
+		scope.folder2.Id: {scope.feed11.Id, scope.feed12.Id, scope.feed21.Id},
+		subfolder.Id:     {scope.feed11.Id},
+	}
+	if !reflect.DeepEqual(feedIds, wantFeedIds) {
+		t.Errorf("invalid folder feeds\nwant: %#v\nhave: %#v", wantFeedIds, feedIds)
+	}
+
+	stats := make(map[int64]FolderStat)
+	for _, stat := range db.FolderStats() {
+		stats[stat.FolderId] = stat
+	}
+	wantStats := map[int64]FolderStat{
+		scope.folder1.Id: {FolderId: scope.folder1.Id, UnreadCount: 2, StarredCount: 1},
+		scope.folder2.Id: {FolderId: scope.folder2.Id, UnreadCount: 2, StarredCount: 2},
+		subfolder.Id:     {FolderId: subfolder.Id, UnreadCount: 1, StarredCount: 1},
+	}
+	if !reflect.DeepEqual(stats, wantStats) {
+		t.Errorf("invalid folder stats\nwant: %#v\nhave: %#v", wantStats, stats)
+	}
+
+	var unread ItemStatus = UNREAD
+	db.MarkItemsRead(MarkFilter{FolderID: &scope.folder2.Id})
+	have = getItemGuids(db.ListItems(ItemFilter{Status: &unread}, 10, false, false))
+	want = []string{"item011"}
+	if !reflect.DeepEqual(have, want) {
+		t.Logf("want: %#v", want)
+		t.Logf("have: %#v", have)
+		t.Fail()
+	}
+}
+
+func folderTitles(db *Storage) map[int64]string {
+	titles := make(map[int64]string)
+	for _, folder := range db.ListFolders() {
+		titles[folder.Id] = folder.Title
+	}
+	return titles
+}
+
+func TestFolderTitlePerParent(t *testing.T) {
+	db := testDB()
+	folder1 := db.CreateFolder("folder1", nil)
+	folder2 := db.CreateFolder("folder2", nil)
+
+	news1 := db.CreateFolder("news", &folder1.Id)
+	news2 := db.CreateFolder("news", &folder2.Id)
+	if news1 == nil || news2 == nil || news1.Id == news2.Id {
+		t.Fatal("expected distinct subfolders with the same title")
+	}
+	if again := db.CreateFolder("news", &folder1.Id); again == nil || again.Id != news1.Id {
+		t.Fatal("expected existing sibling folder to be returned")
+	}
+	if again := db.CreateFolder("folder1", nil); again == nil || again.Id != folder1.Id {
+		t.Fatal("expected existing top-level folder to be returned")
+	}
+	if len(db.ListFolders()) != 4 {
+		t.Fatalf("invalid number of folders: %d", len(db.ListFolders()))
+	}
+
+	if db.UpdateFolderParent(news1.Id, &folder2.Id) {
+		t.Error("moved folder next to a sibling with the same title")
+	}
+	if db.UpdateFolderParent(folder1.Id, &news1.Id) {
+		t.Error("moved folder into its own subtree")
+	}
+	if db.UpdateFolderParent(folder1.Id, &folder1.Id) {
+		t.Error("moved folder into itself")
+	}
+	if !db.UpdateFolderParent(folder1.Id, &news2.Id) {
+		t.Error("failed to move folder")
+	}
+	if !db.UpdateFolderParent(folder1.Id, nil) {
+		t.Error("failed to move folder to the top level")
+	}
+}
+
+func TestMergeFolders(t *testing.T) {
+	db := testDB()
+	scope := testItemsSetup(db)
+
+	// folder1 > news > feed11, folder2 > news > feed21
+	news1 := db.CreateFolder("news", &scope.folder1.Id)
+	news2 := db.CreateFolder("news", &scope.folder2.Id)
+	db.UpdateFeedFolder(scope.feed11.Id, &news1.Id)
+	db.UpdateFeedFolder(scope.feed21.Id, &news2.Id)
+
+	if db.MergeFolders(scope.folder1.Id, news1.Id) {
+		t.Fatal("merged folder into its own subtree")
+	}
+	if !db.MergeFolders(scope.folder1.Id, scope.folder2.Id) {
+		t.Fatal("failed to merge folders")
+	}
+
+	want := map[int64]string{scope.folder2.Id: "folder2", news2.Id: "news"}
+	if have := folderTitles(db); !reflect.DeepEqual(have, want) {
+		t.Errorf("invalid folders\nwant: %#v\nhave: %#v", want, have)
+	}
+	wantFeedIds := map[int64][]int64{
+		scope.folder2.Id: {scope.feed11.Id, scope.feed12.Id, scope.feed21.Id},
+		news2.Id:         {scope.feed11.Id, scope.feed21.Id},
+	}
+	if have := db.ListFolderFeedIDs(); !reflect.DeepEqual(have, wantFeedIds) {
+		t.Errorf("invalid folder feeds\nwant: %#v\nhave: %#v", wantFeedIds, have)
+	}
+}
+
+func TestDeleteFolder(t *testing.T) {
+	db := testDB()
+	scope := testItemsSetup(db)
+
+	// folder1 > sub > feed11
+	sub := db.CreateFolder("sub", &scope.folder1.Id)
+	db.UpdateFeedFolder(scope.feed11.Id, &sub.Id)
+
+	if !db.DeleteFolder(sub.Id, FolderDeleteReparent) {
+		t.Fatal("failed to delete folder")
+	}
+	if feed := db.GetFeed(scope.feed11.Id); feed == nil || feed.FolderId == nil || *feed.FolderId != scope.folder1.Id {
+		t.Fatalf("feed not moved to the parent folder: %#v", feed)
+	}
+
+	// folder2 > folder1 > sub
+	sub = db.CreateFolder("sub", &scope.folder1.Id)
+	db.UpdateFolderParent(scope.folder1.Id, &scope.folder2.Id)
+	if !db.DeleteFolder(scope.folder2.Id, FolderDeleteCascade) {
+		t.Fatal("failed to delete folder")
+	}
+	if titles := folderTitles(db); len(titles) != 0 {
+		t.Errorf("expected no folders, have: %#v", titles)
+	}
+	feeds := db.ListFeeds()
+	if len(feeds) != 1 || feeds[0].Id != scope.feed01.Id {
+		t.Errorf("expected only feed01 to remain, have: %#v", feeds)
+	}
+	have := getItemGuids(db.ListItems(ItemFilter{}, 10, false, false))
+	want := []string{"item011", "item012", "item013"}
+	if !reflect.DeepEqual(have, want) {
+		t.Logf("want: %#v", want)
+		t.Logf("have: %#v", have)
+		t.Fail()
+	}
+}
@@ -0,0 +1,167 @@
+package storage
+
+import (
+	"log"
+	"time"
+)
+
+// Number of the most recent fetches kept in the log of each feed.
+var feedFetchLogSize = 100
+
+// Outcome of a single fetch of the feed.
+type FeedFetch struct {
+	Id     int64     `json:"id"`
+	FeedID int64     `json:"feed_id"`
+	Date   time.Time `json:"date"`
+	// http status code, 0 if there was no response
+	Status   int    `json:"status"`
+	Duration int64  `json:"duration_ms"`
+	Bytes    int64  `json:"bytes"`
+	Error    string `json:"error"`
+	// number of the new items
+	Items int `json:"items"`
+}
+
+// Feed failing to refresh.
+type FailingFeed struct {
+	FeedID       int64      `json:"feed_id"`
+	Title        string     `json:"title"`
+	FeedLink     string     `json:"feed_link"`
+	Failures     int        `json:"failures"`
+	FailingSince time.Time  `json:"failing_since"`
+	LastError    string     `json:"last_error"`
+	PausedAt     *time.Time `json:"paused_at"`
+}
+
+// Record the fetch in the log of the feed & update the count of its consecutive failures.
+func (s *Storage) AddFeedFetch(fetch FeedFetch) bool {
+	tx, err := s.db.Begin()
+	if err != nil {
+		log.Print(err)
+		return false
+	}
+	defer tx.Rollback()
+
+	date := fetch.Date.UTC()
+	_, err = tx.Exec(`
+		insert into feed_fetches (feed_id, date, status, duration, bytes, error, items)
+		values (?, ?, ?, ?, ?, ?, ?)`,
+		fetch.FeedID, date, fetch.Status, fetch.Duration, fetch.Bytes, fetch.Error, fetch.Items,
+	)
+	if err == nil {
+		_, err = tx.Exec(`
+			delete from feed_fetches
+			where feed_id = ? and id not in (
+				select id from feed_fetches where feed_id = ? order by date desc limit ?
+			)`,
+			fetch.FeedID, fetch.FeedID, feedFetchLogSize,
+		)
+	}
+	if err == nil {
+		if fetch.Error != "" {
+			_, err = tx.Exec(`
+				insert into feed_schedules (feed_id, last_check, failures, failing_since)
+				values (?, ?, 1, ?)
+				on conflict (feed_id) do update set
+					failures = failures + 1,
+					failing_since = coalesce(failing_since, excluded.failing_since)`,
+				fetch.FeedID, date, date,
+			)
+		} else {
+			_, err = tx.Exec(`
+				update feed_schedules set failures = 0, failing_since = null where feed_id = ?`,
+				fetch.FeedID,
+			)
+		}
+	}
+	if err == nil {
+		err = tx.Commit()
+	}
+	if err != nil {
+		log.Print(err)
+		return false
+	}
+	return true
+}
+
+// The most recent fetches of the feed, newest first.
+func (s *Storage) ListFeedFetches(feedID int64, limit int) []FeedFetch {
+	result := make([]FeedFetch, 0)
+	rows, err := s.db.Query(`
+		select id, feed_id, date, status, duration, bytes, error, items
+		from feed_fetches
+		where feed_id = ?
+		order by date desc, id desc
+		limit ?
+	`, feedID, limit)
+	if err != nil {
+		log.Print(err)
+		return result
+	}
+	for rows.Next() {
+		var f FeedFetch
+		err = rows.Scan(&f.Id, &f.FeedID, &f.Date, &f.Status, &f.Duration, &f.Bytes, &f.Error, &f.Items)
+		if err != nil {
+			log.Print(err)
+			return result
+		}
+		result = append(result, f)
+	}
+	return result
+}
+
+// Feeds failing since the given time or earlier, along with the paused ones.
+func (s *Storage) ListFailingFeeds(failingBefore time.Time) []FailingFeed {
+	result := make([]FailingFeed, 0)
+	rows, err := s.db.Query(`
+		select
+			f.id, f.title, f.feed_link, s.failures, s.failing_since,
+			coalesce(e.error, ''), f.paused_at
+		from feeds f
+		join feed_schedules s on s.feed_id = f.id
+		left join feed_errors e on e.feed_id = f.id
+		where s.failures > 0 and (s.failing_since <= ? or f.paused_at is not null)
+		order by s.failing_since
+	`, failingBefore.UTC())
+	if err != nil {
+		log.Print(err)
+		return result
+	}
+	for rows.Next() {
+		var f FailingFeed
+		err = rows.Scan(&f.FeedID, &f.Title, &f.FeedLink, &f.Failures, &f.FailingSince, &f.LastError, &f.PausedAt)
+		if err != nil {
+			log.Print(err)
+			return result
+		}
+		result = append(result, f)
+	}
+	return result
+}
+
+// Pause the feeds which failed at least the given number of times in a row
+// and haven't been refreshed successfully since the given time. Returns the paused feeds.
+func (s *Storage) PauseFailingFeeds(minFailures int, failingBefore time.Time) []Feed {
+	result := make([]Feed, 0)
+	rows, err := s.db.Query(`
+		update feeds set paused_at = ?
+		where paused_at is null and id in (
+			select feed_id from feed_schedules
+			where failures >= ? and failing_since <= ?
+		)
+		returning id, title, feed_link
+	`, time.Now().UTC(), minFailures, failingBefore.UTC())
+	if err != nil {
+		log.Print(err)
+		return result
+	}
+	for rows.Next() {
+		var f Feed
+		if err = rows.Scan(&f.Id, &f.Title, &f.FeedLink); err != nil {
+			log.Print(err)
+			return result
+		}
+		result = append(result, f)
+	}
+	return result
+}
@@ -0,0 +1,61 @@
+package storage
+
+import (
+	"testing"
+	"time"
+)
+
+func TestFeedFetches(t *testing.T) {
+	db := testDB()
+	feed := db.CreateFeed("feed", "", "", "http://example.com/feed.xml", nil)
+
+	defer func(size int) { feedFetchLogSize = size }(feedFetchLogSize)
+	feedFetchLogSize = 3
+
+	start := time.Now().Add(-time.Hour * 24 * 10)
+	db.AddFeedFetch(FeedFetch{FeedID: feed.Id, Date: start, Status: 200, Items: 5})
+	for i := 1; i <= 4; i++ {
+		date := start.Add(time.Hour * 24 * time.Duration(i))
+		db.AddFeedFetch(FeedFetch{FeedID: feed.Id, Date: date, Status: 500, Error: "status code 500"})
+	}
+
+	fetches := db.ListFeedFetches(feed.Id, 10)
+	if len(fetches) != 3 {
+		t.Fatalf("log not truncated: %d fetches", len(fetches))
+	}
+	if !fetches[0].Date.After(fetches[1].Date) || fetches[0].Error != "status code 500" {
+		t.Fatalf("invalid fetches: %#v", fetches)
+	}
+
+	schedule := db.GetFeedSchedule(feed.Id)
+	failingSince := start.Add(time.Hour * 24).UTC()
+	if schedule.Failures != 4 || schedule.FailingSince == nil || !schedule.FailingSince.Equal(failingSince) {
+		t.Fatalf("invalid failures: %d since %v", schedule.Failures, schedule.FailingSince)
+	}
+
+	if failing := db.ListFailingFeeds(time.Now().Add(-time.Hour * 24 * 30)); len(failing) != 0 {
+		t.Fatalf("feed failing for a month: %#v", failing)
+	}
+	if failing := db.ListFailingFeeds(time.Now().Add(-time.Hour * 24 * 7)); len(failing) != 1 || failing[0].Failures != 4 {
+		t.Fatalf("feed failing for a week not listed: %#v", failing)
+	}
+
+	if paused := db.PauseFailingFeeds(5, time.Now()); len(paused) != 0 {
+		t.Fatalf("paused feed with too few failures: %#v", paused)
+	}
+	if paused := db.PauseFailingFeeds(3, time.Now()); len(paused) != 1 || db.GetFeed(feed.Id).PausedAt == nil {
+		t.Fatalf("feed not paused: %#v", paused)
+	}
+
+	// resuming starts the failure count over
+	db.UpdateFeedPaused(feed.Id, false)
+	if db.GetFeed(feed.Id).PausedAt != nil || db.GetFeedSchedule(feed.Id).Failures != 0 {
+		t.Fatal("feed not resumed")
+	}
+
+	db.AddFeedFetch(FeedFetch{FeedID: feed.Id, Date: time.Now(), Status: 500, Error: "status code 500"})
+	db.AddFeedFetch(FeedFetch{FeedID: feed.Id, Date: time.Now(), Status: 200})
+	if schedule := db.GetFeedSchedule(feed.Id); schedule.Failures != 0 || schedule.FailingSince != nil {
+		t.Fatalf("failures not reset: %#v", schedule)
+	}
+}
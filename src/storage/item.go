@@ -1,6 +1,7 @@
 package storage
 
 import (
+	"database/sql"
 	"database/sql/driver"
 	"encoding/json"
 	"fmt"
@@ -68,6 +69,28 @@ func (m MediaLinks) Value() (driver.Value, error) {
 	return json.Marshal(m)
 }
 
+type Categories []string
+
+func (c *Categories) Scan(src any) error {
+	switch data := src.(type) {
+	case []byte:
+		return json.Unmarshal(data, c)
+	case string:
+		return json.Unmarshal([]byte(data), c)
+	default:
+		return nil
+	}
+}
+
+func (c Categories) Value() (driver.Value, error) {
+	if len(c) == 0 {
+		return nil, nil
+	}
+	// stored as text, since sqlite treats blobs passed to json functions as jsonb
+	data, err := json.Marshal(c)
+	return string(data), err
+}
+
 type Item struct {
 	Id              int64      `json:"id"`
 	GUID            string     `json:"guid"`
@@ -76,6 +99,7 @@ type Item struct {
 	Link            string     `json:"link"`
 	Content         string     `json:"content,omitempty"`
 	Date            time.Time  `json:"date"`
+	DateUpdated     *time.Time `json:"date_updated,omitempty"`
 	Status          ItemStatus `json:"status"`
 	MediaLinks      MediaLinks `json:"media_links"`
 	AISummary       *string    `json:"ai_summary,omitempty"`
@@ -83,6 +107,26 @@ type Item struct {
 	Translation     *string    `json:"translation,omitempty"`
 	TranslationAt   *int64     `json:"translation_at,omitempty"`
 	TranslationLang *string    `json:"translation_lang,omitempty"`
+	Tags            TagIDs     `json:"tags"`
+	Author          string     `json:"author,omitempty"`
+	Categories      Categories `json:"categories,omitempty"`
+	CommentsLink    string     `json:"comments_link,omitempty"`
+	// set by the rules (see `Rule`)
+	Priority int `json:"priority,omitempty"`
+
+	// article extracted from the page of the item, nil if not fetched (see `Feed.FetchFullContent`)
+	FullContent *string `json:"-"`
+	// single item only: the version of the content returned ("feed" or "full")
+	ContentSource  string `json:"content_source,omitempty"`
+	HasFullContent bool   `json:"has_full_content,omitempty"`
+	// single item only: the downloads of the enclosures (see `Feed.MediaDownload`)
+	Media []ItemMedia `json:"media,omitempty"`
+	// single item & continue listening only: the progress of the playback of the enclosure
+	Playback *ItemPlayback `json:"playback,omitempty"`
+
+	// search results only: title & content excerpt with the matched terms highlighted
+	Highlight *string `json:"highlight,omitempty"`
+	Snippet   *string `json:"snippet,omitempty"`
 }
 
 type ItemFilter struct {
@@ -95,11 +139,27 @@ type ItemFilter struct {
 	SinceID  *int64
 	MaxID    *int64
 	Before   *time.Time
+	Since    *time.Time
+	// items having any of the given tags
+	Tags *[]int64
+	// items belonging to any of the given feeds/folders
+	FeedIDs   *[]int64
+	FolderIDs *[]int64
+	// case-insensitive exact match of the author/category
+	Author   *string
+	Category *string
+	// items not sent with the digest yet
+	NotInDigest *int64
+	// items with at least the given priority (see `RuleActions.Priority`)
+	MinPriority *int
 }
 
 type MarkFilter struct {
 	FolderID *int64
 	FeedID   *int64
+	Tags     *[]int64
+	Author   *string
+	Category *string
 
 	Before *time.Time
 }
@@ -122,12 +182,18 @@ func (list ItemList) Swap(i, j int) {
 	list[i], list[j] = list[j], list[i]
 }
 
-func (s *Storage) CreateItems(items []Item) bool {
+// Insert the new items & update the existing ones, saving their previous
+// version as a revision if changed (see `updateItem`).
+// Returns the number of the new items & whether the items were stored.
+func (s *Storage) CreateItems(items []Item) (int, bool) {
+	unreadOnUpdate := s.GetSettingsValue("unread_on_update") == true
+
 	tx, err := s.db.Begin()
 	if err != nil {
 		log.Print(err)
-		return false
+		return 0, false
 	}
+	added := 0
 
 	now := time.Now().UTC()
 
@@ -135,43 +201,87 @@ func (s *Storage) CreateItems(items []Item) bool {
 	sort.Sort(itemsSorted)
 
 	for _, item := range itemsSorted {
-		_, err = tx.Exec(`
+		var result sql.Result
+		result, err = tx.Exec(`
 			insert into items (
 				guid, feed_id, title, link, date,
-				content, media_links,
-				date_arrived, status
+				content, full_content, media_links,
+				author, categories, comments_link,
+				date_arrived, status, priority,
+				date_updated, raw_hash
 			)
 			values (
 				?, ?, ?, ?, strftime('%Y-%m-%d %H:%M:%f', ?),
-				?, ?,
-				?, ?
+				?, ?, ?,
+				?, ?, ?,
+				?, ?, ?,
+				strftime('%Y-%m-%d %H:%M:%f', ?), ?
 			)
 			on conflict (feed_id, guid) do nothing`,
 			item.GUID, item.FeedId, item.Title, item.Link, item.Date,
-			item.Content, item.MediaLinks,
-			now, UNREAD,
+			item.Content, item.FullContent, item.MediaLinks,
+			item.Author, item.Categories, item.CommentsLink,
+			now, item.Status, item.Priority,
+			item.DateUpdated, itemRawHash(item.Title, item.Content),
 		)
+		if err == nil {
+			var numrows int64
+			if numrows, err = result.RowsAffected(); err == nil && numrows == 0 {
+				err = updateItem(tx, item, unreadOnUpdate)
+			} else if err == nil {
+				err = insertItemExtras(tx, result, item)
+			}
+			added += int(numrows)
+		}
 		if err != nil {
 			log.Print(err)
 			if err = tx.Rollback(); err != nil {
 				log.Print(err)
-				return false
+				return 0, false
 			}
-			return false
+			return 0, false
 		}
 	}
 	if err = tx.Commit(); err != nil {
 		log.Print(err)
-		return false
+		return 0, false
 	}
-	return true
+	return added, true
+}
+
+// Hash the text of the newly inserted item (see `updateItem`) & tag it (see `RuleActions`).
+// Only the new items are hashed, sparing the parsing of the existing ones on every refresh.
+func insertItemExtras(tx *sql.Tx, result sql.Result, item Item) error {
+	itemId, err := result.LastInsertId()
+	if err != nil {
+		return err
+	}
+	_, err = tx.Exec(
+		`update items set content_hash = ? where id = ?`,
+		itemContentHash(item.Title, item.Content), itemId,
+	)
+	if err != nil {
+		return err
+	}
+	for _, tagId := range item.Tags {
+		_, err = tx.Exec(`
+			insert into item_tags (item_id, tag_id)
+			select ?, id from tags where id = ?
+			on conflict do nothing`,
+			itemId, tagId,
+		)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
 }
 
 func listQueryPredicate(filter ItemFilter, newestFirst bool) (string, []interface{}) {
 	cond := make([]string, 0)
 	args := make([]interface{}, 0)
 	if filter.FolderID != nil {
-		cond = append(cond, "i.feed_id in (select id from feeds where folder_id = ?)")
+		cond = append(cond, "i.feed_id in (select id from feeds where folder_id in ("+folderTreeQuery(1)+"))")
 		args = append(args, *filter.FolderID)
 	}
 	if filter.FeedID != nil {
@@ -183,14 +293,19 @@ func listQueryPredicate(filter ItemFilter, newestFirst bool) (string, []interfac
 		args = append(args, *filter.Status)
 	}
 	if filter.Search != nil {
-		words := strings.Fields(*filter.Search)
-		terms := make([]string, len(words))
-		for idx, word := range words {
-			terms[idx] = word + "*"
+		query := parseSearchQuery(*filter.Search)
+		if query.match != "" {
+			cond = append(cond, "i.search_rowid in (select rowid from search where search match ?)")
+			args = append(args, query.match)
+		}
+		if query.exclude != "" {
+			cond = append(cond, "i.search_rowid not in (select rowid from search where search match ?)")
+			args = append(args, query.exclude)
+		}
+		for _, feed := range query.feeds {
+			cond = append(cond, "i.feed_id in (select id from feeds where title like ?)")
+			args = append(args, "%"+feed+"%")
 		}
-
-		cond = append(cond, "i.search_rowid in (select rowid from search where search match ?)")
-		args = append(args, strings.Join(terms, " "))
 	}
 	if filter.After != nil {
 		compare := ">"
@@ -201,14 +316,12 @@ func listQueryPredicate(filter ItemFilter, newestFirst bool) (string, []interfac
 		args = append(args, *filter.After)
 	}
 	if filter.IDs != nil && len(*filter.IDs) > 0 {
-		qmarks := make([]string, len(*filter.IDs))
-		idargs := make([]interface{}, len(*filter.IDs))
-		for i, id := range *filter.IDs {
-			qmarks[i] = "?"
-			idargs[i] = id
-		}
-		cond = append(cond, "i.id in ("+strings.Join(qmarks, ",")+")")
-		args = append(args, idargs...)
+		cond = append(cond, "i.id in ("+qmarks(*filter.IDs)+")")
+		args = append(args, int64Args(*filter.IDs)...)
+	}
+	if filter.NotInDigest != nil {
+		cond = append(cond, "not exists (select 1 from digest_items d where d.digest_id = ? and d.item_id = i.id)")
+		args = append(args, *filter.NotInDigest)
 	}
 	if filter.SinceID != nil {
 		cond = append(cond, "i.id > ?")
@@ -222,6 +335,41 @@ func listQueryPredicate(filter ItemFilter, newestFirst bool) (string, []interfac
 		cond = append(cond, "i.date < ?")
 		args = append(args, filter.Before)
 	}
+	if filter.Since != nil {
+		cond = append(cond, "i.date >= ?")
+		args = append(args, filter.Since)
+	}
+	if filter.Tags != nil && len(*filter.Tags) > 0 {
+		cond = append(cond, "i.id in (select item_id from item_tags where tag_id in ("+qmarks(*filter.Tags)+"))")
+		args = append(args, int64Args(*filter.Tags)...)
+	}
+	if filter.FeedIDs != nil || filter.FolderIDs != nil {
+		sets := make([]string, 0)
+		if filter.FeedIDs != nil && len(*filter.FeedIDs) > 0 {
+			sets = append(sets, "i.feed_id in ("+qmarks(*filter.FeedIDs)+")")
+			args = append(args, int64Args(*filter.FeedIDs)...)
+		}
+		if filter.FolderIDs != nil && len(*filter.FolderIDs) > 0 {
+			sets = append(sets, "i.feed_id in (select id from feeds where folder_id in ("+folderTreeQuery(len(*filter.FolderIDs))+"))")
+			args = append(args, int64Args(*filter.FolderIDs)...)
+		}
+		if len(sets) > 0 {
+			cond = append(cond, "("+strings.Join(sets, " or ")+")")
+		}
+	}
+
+	if filter.Author != nil {
+		cond = append(cond, "i.author = ? collate nocase")
+		args = append(args, *filter.Author)
+	}
+	if filter.Category != nil {
+		cond = append(cond, "exists (select 1 from json_each(i.categories) where value = ? collate nocase)")
+		args = append(args, *filter.Category)
+	}
+	if filter.MinPriority != nil {
+		cond = append(cond, "i.priority >= ?")
+		args = append(args, *filter.MinPriority)
+	}
 
 	predicate := "1"
 	if len(cond) > 0 {
@@ -231,13 +379,29 @@ func listQueryPredicate(filter ItemFilter, newestFirst bool) (string, []interfac
 	return predicate, args
 }
 
+func qmarks(values []int64) string {
+	marks := make([]string, len(values))
+	for i := range values {
+		marks[i] = "?"
+	}
+	return strings.Join(marks, ",")
+}
+
+func int64Args(values []int64) []interface{} {
+	args := make([]interface{}, len(values))
+	for i, value := range values {
+		args[i] = value
+	}
+	return args
+}
+
 func (s *Storage) CountItems(filter ItemFilter) int {
 	predicate, args := listQueryPredicate(filter, false)
 
 	var count int
 	query := fmt.Sprintf(`
 		select count(*)
-		from items
+		from items i
 		where %s
 		`, predicate)
 	err := s.db.QueryRow(query, args...).Scan(&count)
@@ -248,7 +412,19 @@ func (s *Storage) CountItems(filter ItemFilter) int {
 	return count
 }
 
+// With FTS5 available, search results are ordered by relevance
+// and come with the matching terms highlighted.
 func (s *Storage) ListItems(filter ItemFilter, limit int, newestFirst bool, withContent bool) []Item {
+	match := ""
+	if s.fts5 && filter.Search != nil && filter.IDs == nil && filter.SinceID == nil && filter.MaxID == nil {
+		match = parseSearchQuery(*filter.Search).match
+	}
+	after := filter.After
+	if match != "" {
+		// replaced by the relevance-based cursor below
+		filter.After = nil
+	}
+
 	predicate, args := listQueryPredicate(filter, newestFirst)
 	result := make([]Item, 0, 0)
 
@@ -263,20 +439,41 @@ func (s *Storage) ListItems(filter ItemFilter, limit int, newestFirst bool, with
 		order = "i.id desc"
 	}
 
-	selectCols := "i.id, i.guid, i.feed_id, i.title, i.link, i.date, i.status, i.media_links"
+	selectCols := "i.id, i.guid, i.feed_id, i.title, i.link, i.date, i.date_updated, i.status, i.media_links"
 	if withContent {
 		selectCols += ", i.content"
 	} else {
 		selectCols += ", '' as content"
 	}
 	selectCols += ", i.ai_summary, i.ai_summary_at, i.translation, i.translation_at, i.translation_lang"
+	selectCols += ", (select json_group_array(tag_id) from item_tags where item_id = i.id) as tags"
+	selectCols += ", coalesce(i.author, ''), i.categories, coalesce(i.comments_link, ''), i.priority"
+
+	source := "items i"
+	if match != "" {
+		source = "items i join search on search.rowid = i.search_rowid"
+		selectCols += ", highlight(search, 0, char(2), char(3)), snippet(search, 2, char(2), char(3), '…', 24)"
+		predicate = "search match ? and " + predicate
+		args = append([]interface{}{match}, args...)
+		if after != nil {
+			predicate += ` and (search.rank, -i.id) > (
+				(select rank from search where search match ? and rowid = (select search_rowid from items where id = ?)),
+				-?
+			)`
+			args = append(args, match, *after, *after)
+		}
+		order = "search.rank, i.id desc"
+	} else {
+		selectCols += ", null, null"
+	}
+
 	query := fmt.Sprintf(`
 		select %s
-		from items i
+		from %s
 		where %s
 		order by %s
 		limit %d
-		`, selectCols, predicate, order, limit)
+		`, selectCols, source, predicate, order, limit)
 	rows, err := s.db.Query(query, args...)
 	if err != nil {
 		log.Print(err)
@@ -286,15 +483,25 @@ func (s *Storage) ListItems(filter ItemFilter, limit int, newestFirst bool, with
 		var x Item
 		err = rows.Scan(
 			&x.Id, &x.GUID, &x.FeedId,
-			&x.Title, &x.Link, &x.Date,
+			&x.Title, &x.Link, &x.Date, &x.DateUpdated,
 			&x.Status, &x.MediaLinks, &x.Content,
 			&x.AISummary, &x.AISummaryAt,
 			&x.Translation, &x.TranslationAt, &x.TranslationLang,
+			&x.Tags, &x.Author, &x.Categories, &x.CommentsLink, &x.Priority,
+			&x.Highlight, &x.Snippet,
 		)
 		if err != nil {
 			log.Print(err)
 			return result
 		}
+		if x.Highlight != nil {
+			highlight := searchHighlightHTML(*x.Highlight)
+			x.Highlight = &highlight
+		}
+		if x.Snippet != nil {
+			snippet := searchHighlightHTML(*x.Snippet)
+			x.Snippet = &snippet
+		}
 		result = append(result, x)
 	}
 	return result
@@ -304,15 +511,18 @@ func (s *Storage) GetItem(id int64) *Item {
 	i := &Item{}
 	err := s.db.QueryRow(`
 		select
-			i.id, i.guid, i.feed_id, i.title, i.link, i.content,
-			i.date, i.status, i.media_links, i.ai_summary, i.ai_summary_at,
-			i.translation, i.translation_at, i.translation_lang
+			i.id, i.guid, i.feed_id, i.title, i.link, i.content, i.full_content,
+			i.date, i.date_updated, i.status, i.media_links, i.ai_summary, i.ai_summary_at,
+			i.translation, i.translation_at, i.translation_lang,
+			(select json_group_array(tag_id) from item_tags where item_id = i.id) as tags,
+			coalesce(i.author, ''), i.categories, coalesce(i.comments_link, ''), i.priority
 		from items i
 		where i.id = ?
 	`, id).Scan(
-		&i.Id, &i.GUID, &i.FeedId, &i.Title, &i.Link, &i.Content,
-		&i.Date, &i.Status, &i.MediaLinks, &i.AISummary, &i.AISummaryAt,
-		&i.Translation, &i.TranslationAt, &i.TranslationLang,
+		&i.Id, &i.GUID, &i.FeedId, &i.Title, &i.Link, &i.Content, &i.FullContent,
+		&i.Date, &i.DateUpdated, &i.Status, &i.MediaLinks, &i.AISummary, &i.AISummaryAt,
+		&i.Translation, &i.TranslationAt, &i.TranslationLang, &i.Tags,
+		&i.Author, &i.Categories, &i.CommentsLink, &i.Priority,
 	)
 	if err != nil {
 		log.Print(err)
@@ -321,6 +531,46 @@ func (s *Storage) GetItem(id int64) *Item {
 	return i
 }
 
+// Guids of the given ones already stored for the feed.
+func (s *Storage) ListExistingItemGUIDs(feedID int64, guids []string) map[string]bool {
+	result := make(map[string]bool)
+	for guid := range s.ListItemIDsByGUID(feedID, guids) {
+		result[guid] = true
+	}
+	return result
+}
+
+// Ids of the items of the feed stored under the given guids.
+func (s *Storage) ListItemIDsByGUID(feedID int64, guids []string) map[string]int64 {
+	result := make(map[string]int64)
+	if len(guids) == 0 {
+		return result
+	}
+	list, err := json.Marshal(guids)
+	if err != nil {
+		log.Print(err)
+		return result
+	}
+	rows, err := s.db.Query(`
+		select guid, id from items
+		where feed_id = ? and guid in (select value from json_each(?))
+	`, feedID, string(list))
+	if err != nil {
+		log.Print(err)
+		return result
+	}
+	for rows.Next() {
+		var guid string
+		var id int64
+		if err = rows.Scan(&guid, &id); err != nil {
+			log.Print(err)
+			return result
+		}
+		result[guid] = id
+	}
+	return result
+}
+
 func (s *Storage) UpdateItemStatus(item_id int64, status ItemStatus) bool {
 	_, err := s.db.Exec(`update items set status = ? where id = ?`, status, item_id)
 	return err == nil
@@ -337,11 +587,18 @@ func (s *Storage) UpdateItemTranslation(item_id int64, translation string, times
 }
 
 func (s *Storage) MarkItemsRead(filter MarkFilter) bool {
-	predicate, args := listQueryPredicate(ItemFilter{
+	return s.markItemsRead(ItemFilter{
 		FolderID: filter.FolderID,
 		FeedID:   filter.FeedID,
+		Tags:     filter.Tags,
+		Author:   filter.Author,
+		Category: filter.Category,
 		Before:   filter.Before,
-	}, false)
+	})
+}
+
+func (s *Storage) markItemsRead(filter ItemFilter) bool {
+	predicate, args := listQueryPredicate(filter, false)
 	query := fmt.Sprintf(`
 		update items as i set status = %d
 		where %s and i.status != %d
@@ -432,6 +689,9 @@ var (
 //     This prevents from deleting items for rarely updated and/or ever-growing
 //     feeds which might eventually reappear as unread.
 //   - Keep entries for a certain period (default: 90 days).
+//
+// The rules above can be overridden per feed or folder by a retention policy
+// (see `RetentionPolicy`). The feed policy takes precedence over the folder one.
 func (s *Storage) DeleteOldItems() {
 	rows, err := s.db.Query(`
 		select
@@ -455,22 +715,50 @@ func (s *Storage) DeleteOldItems() {
 		feedLimits[feedId] = limit
 	}
 
+	policies := s.feedRetentionPolicies()
+	now := time.Now().UTC()
+	daysAgo := func(days int) time.Time {
+		return now.Add(-time.Hour * time.Duration(24*days))
+	}
+
 	for feedId, limit := range feedLimits {
-		result, err := s.db.Exec(`
-			delete from items
-			where id in (
-				select i.id
-				from items i
-				where i.feed_id = ? and status != ?
-				order by date desc
-				limit -1 offset ?
-			) and date_arrived < ?
-			`,
-			feedId,
-			STARRED,
-			limit,
-			time.Now().UTC().Add(-time.Hour*time.Duration(24*itemsKeepDays)),
-		)
+		var query string
+		var args []interface{}
+
+		switch policy := policies[feedId]; policy.Mode {
+		case RetentionForever:
+			continue
+		case RetentionItems:
+			query = `
+				delete from items
+				where id in (
+					select i.id
+					from items i
+					where i.feed_id = ? and status != ?
+					order by date desc
+					limit -1 offset ?
+				)`
+			args = []interface{}{feedId, STARRED, policy.Limit}
+		case RetentionDays:
+			query = `delete from items where feed_id = ? and status != ? and date_arrived < ?`
+			args = []interface{}{feedId, STARRED, daysAgo(policy.Limit)}
+		case RetentionReadDays:
+			query = `delete from items where feed_id = ? and status = ? and date_arrived < ?`
+			args = []interface{}{feedId, READ, daysAgo(policy.Limit)}
+		default:
+			query = `
+				delete from items
+				where id in (
+					select i.id
+					from items i
+					where i.feed_id = ? and status != ?
+					order by date desc
+					limit -1 offset ?
+				) and date_arrived < ?`
+			args = []interface{}{feedId, STARRED, limit, daysAgo(itemsKeepDays)}
+		}
+
+		result, err := s.db.Exec(query, args...)
 		if err != nil {
 			log.Print(err)
 			return
@@ -328,3 +328,186 @@ func TestDeleteOldItems(t *testing.T) {
 		)
 	}
 }
+
+func TestDeleteOldItemsRetention(t *testing.T) {
+	now := time.Now().UTC()
+	db := testDB()
+
+	folder := db.CreateFolder("folder", nil)
+	subfolder := db.CreateFolder("subfolder", &folder.Id)
+	feeds := map[string]*Feed{
+		"default":   db.CreateFeed("default", "", "", "http://test.com/default.xml", nil),
+		"forever":   db.CreateFeed("forever", "", "", "http://test.com/forever.xml", nil),
+		"items":     db.CreateFeed("items", "", "", "http://test.com/items.xml", nil),
+		"days":      db.CreateFeed("days", "", "", "http://test.com/days.xml", nil),
+		"read_days": db.CreateFeed("read_days", "", "", "http://test.com/read_days.xml", nil),
+		"inherited": db.CreateFeed("inherited", "", "", "http://test.com/inherited.xml", &subfolder.Id),
+	}
+	db.UpdateFeedRetention(feeds["forever"].Id, &RetentionPolicy{Mode: RetentionForever})
+	db.UpdateFeedRetention(feeds["items"].Id, &RetentionPolicy{Mode: RetentionItems, Limit: 5})
+	db.UpdateFeedRetention(feeds["days"].Id, &RetentionPolicy{Mode: RetentionDays, Limit: 10})
+	db.UpdateFeedRetention(feeds["read_days"].Id, &RetentionPolicy{Mode: RetentionReadDays, Limit: 10})
+	db.UpdateFolderRetention(folder.Id, &RetentionPolicy{Mode: RetentionItems, Limit: 3})
+
+	// 20 items per feed, the first half arrived 30 days ago, every other one is read
+	items := make([]Item, 0)
+	for name, feed := range feeds {
+		for i := 0; i < 20; i++ {
+			items = append(items, Item{
+				GUID:   name + strconv.Itoa(i),
+				FeedId: feed.Id,
+				Title:  name + strconv.Itoa(i),
+				Date:   now.Add(time.Hour * time.Duration(i)),
+			})
+		}
+	}
+	db.CreateItems(items)
+	for name := range feeds {
+		for i := 0; i < 20; i += 2 {
+			db.UpdateItemStatus(getItem(db, name+strconv.Itoa(i)).Id, READ)
+		}
+	}
+	db.db.Exec(
+		`update items set date_arrived = ? where date < ?`,
+		now.Add(-time.Hour*24*30), now.Add(time.Hour*10-time.Minute*30),
+	)
+
+	db.DeleteOldItems()
+
+	want := map[string]int{
+		"default":   20,
+		"forever":   20,
+		"items":     5,
+		"days":      10,
+		"read_days": 15,
+		"inherited": 3,
+	}
+	for name, feed := range feeds {
+		have := db.CountItems(ItemFilter{FeedID: &feed.Id})
+		if have != want[name] {
+			t.Errorf("invalid number of items kept for %s\nwant: %d\nhave: %d", name, want[name], have)
+		}
+	}
+
+	if policy := db.GetFeed(feeds["items"].Id).Retention; policy == nil || *policy != (RetentionPolicy{Mode: RetentionItems, Limit: 5}) {
+		t.Errorf("invalid feed retention policy: %#v", policy)
+	}
+	db.UpdateFeedRetention(feeds["items"].Id, &RetentionPolicy{Mode: RetentionDefault})
+	if policy := db.GetFeed(feeds["items"].Id).Retention; policy != nil {
+		t.Errorf("expected retention policy to be reset, got %#v", policy)
+	}
+}
+
+func TestListItemsAuthorCategory(t *testing.T) {
+	db := testDB()
+	feed := db.CreateFeed("feed", "", "", "http://test.com/feed.xml", nil)
+	db.CreateItems([]Item{
+		{GUID: "item1", FeedId: feed.Id, Author: "Jane Doe", Categories: Categories{"Go", "Databases"}, CommentsLink: "http://test.com/1#comments"},
+		{GUID: "item2", FeedId: feed.Id, Author: "John Doe", Categories: Categories{"go"}},
+		{GUID: "item3", FeedId: feed.Id},
+	})
+
+	author := "jane doe"
+	have := getItemGuids(db.ListItems(ItemFilter{Author: &author}, 10, false, false))
+	if want := []string{"item1"}; !reflect.DeepEqual(have, want) {
+		t.Errorf("invalid author filter\nwant: %#v\nhave: %#v", want, have)
+	}
+	category := "GO"
+	have = getItemGuids(db.ListItems(ItemFilter{Category: &category}, 10, false, false))
+	if want := []string{"item1", "item2"}; !reflect.DeepEqual(have, want) {
+		t.Errorf("invalid category filter\nwant: %#v\nhave: %#v", want, have)
+	}
+
+	item := getItem(db, "item1")
+	item = db.GetItem(item.Id)
+	if item.Author != "Jane Doe" || !reflect.DeepEqual(item.Categories, Categories{"Go", "Databases"}) || item.CommentsLink != "http://test.com/1#comments" {
+		t.Errorf("invalid item: %#v", item)
+	}
+	if item = db.GetItem(getItem(db, "item3").Id); item.Author != "" || item.Categories != nil || item.CommentsLink != "" {
+		t.Errorf("invalid item: %#v", item)
+	}
+}
+
+func TestCreateItemsUpdated(t *testing.T) {
+	db := testDB()
+	feed := db.CreateFeed("feed", "", "", "http://test.com/feed.xml", nil)
+	db.CreateItems([]Item{
+		{GUID: "item1", FeedId: feed.Id, Title: "title", Content: "<p>old text</p>"},
+		{GUID: "item2", FeedId: feed.Id, Title: "title", Content: "<p>text</p>"},
+	})
+	item1 := getItem(db, "item1")
+	db.UpdateItemStatus(item1.Id, READ)
+
+	// markup-only changes are ignored
+	db.CreateItems([]Item{
+		{GUID: "item1", FeedId: feed.Id, Title: "title", Content: "<div>old text</div>"},
+		{GUID: "item2", FeedId: feed.Id, Title: "title", Content: "<p>text</p>"},
+	})
+	if revisions := db.ListItemRevisions(item1.Id); len(revisions) != 0 {
+		t.Fatalf("unexpected revisions: %#v", revisions)
+	}
+	// the version last seen is remembered, so that the text isn't compared again
+	var rawHash, hash string
+	db.db.QueryRow(`select raw_hash, content_hash from items where id = ?`, item1.Id).Scan(&rawHash, &hash)
+	if rawHash != itemRawHash("title", "<div>old text</div>") || hash != itemContentHash("title", "<p>old text</p>") {
+		t.Fatalf("invalid hashes: %s %s", rawHash, hash)
+	}
+	if item := db.GetItem(item1.Id); item.Content != "<p>old text</p>" {
+		t.Fatalf("markup-only change stored: %#v", item)
+	}
+
+	db.CreateItems([]Item{{GUID: "item1", FeedId: feed.Id, Title: "title", Content: "<p>new text</p>"}})
+	item := db.GetItem(item1.Id)
+	if item.Content != "<p>new text</p>" || item.DateUpdated == nil || item.Status != READ {
+		t.Fatalf("item not updated: %#v", item)
+	}
+	revisions := db.ListItemRevisions(item1.Id)
+	if len(revisions) != 1 || revisions[0].Content != "<p>old text</p>" {
+		t.Fatalf("invalid revisions: %#v", revisions)
+	}
+
+	db.UpdateSettings(map[string]interface{}{"unread_on_update": true})
+	db.CreateItems([]Item{{GUID: "item1", FeedId: feed.Id, Title: "new title", Content: "<p>new text</p>"}})
+	item = db.GetItem(item1.Id)
+	if item.Title != "new title" || item.Status != UNREAD {
+		t.Fatalf("item not updated: %#v", item)
+	}
+	if revisions = db.ListItemRevisions(item1.Id); len(revisions) != 2 || revisions[1].Title != "title" {
+		t.Fatalf("invalid revisions: %#v", revisions)
+	}
+	if revisions := db.ListItemRevisions(getItem(db, "item2").Id); len(revisions) != 0 {
+		t.Fatalf("unexpected revisions: %#v", revisions)
+	}
+
+	// same modification date as the stored one
+	updated := time.Now().UTC().Add(time.Hour).Truncate(time.Millisecond)
+	db.CreateItems([]Item{{GUID: "item1", FeedId: feed.Id, Title: "v4", DateUpdated: &updated}})
+	db.CreateItems([]Item{{GUID: "item1", FeedId: feed.Id, Title: "v5", DateUpdated: &updated}})
+	if item = db.GetItem(item1.Id); item.Title != "v4" {
+		t.Fatalf("expected item with the same modification date to be skipped: %#v", item)
+	}
+}
+
+func TestItemFullContent(t *testing.T) {
+	db := testDB()
+	feed := db.CreateFeed("feed", "", "", "http://test.com/feed.xml", nil)
+	full := "<p>full text</p>"
+	db.CreateItems([]Item{
+		{GUID: "item1", FeedId: feed.Id, Title: "title", Content: "<p>teaser</p>", FullContent: &full},
+		{GUID: "item2", FeedId: feed.Id, Title: "title", Content: "<p>text</p>"},
+	})
+
+	have := db.ListExistingItemGUIDs(feed.Id, []string{"item1", "item3"})
+	want := map[string]bool{"item1": true}
+	if !reflect.DeepEqual(have, want) {
+		t.Fatalf("invalid guids\nwant: %v\nhave: %v", want, have)
+	}
+
+	item := db.GetItem(getItem(db, "item1").Id)
+	if item.Content != "<p>teaser</p>" || item.FullContent == nil || *item.FullContent != full {
+		t.Fatalf("invalid content: %#v", item)
+	}
+	if item := db.GetItem(getItem(db, "item2").Id); item.FullContent != nil {
+		t.Fatalf("unexpected full content: %#v", item)
+	}
+}
@@ -0,0 +1,201 @@
+package storage
+
+import (
+	"database/sql"
+	"database/sql/driver"
+	"encoding/json"
+	"log"
+	"time"
+)
+
+// Downloading of the audio & video enclosures of the feed items.
+type MediaDownloadPolicy struct {
+	// maximum size of a single file in megabytes, 0 for no limit
+	MaxSize int64 `json:"max_size,omitempty"`
+	// number of the most recent items of the feed keeping the downloaded files, 0 for no limit
+	MaxCount int `json:"max_count,omitempty"`
+}
+
+func (p MediaDownloadPolicy) IsValid() bool {
+	return p.MaxSize >= 0 && p.MaxCount >= 0
+}
+
+func (p *MediaDownloadPolicy) Scan(src any) error {
+	switch data := src.(type) {
+	case []byte:
+		return json.Unmarshal(data, p)
+	case string:
+		return json.Unmarshal([]byte(data), p)
+	default:
+		return nil
+	}
+}
+
+func (p MediaDownloadPolicy) Value() (driver.Value, error) {
+	return json.Marshal(p)
+}
+
+type MediaStatus string
+
+const (
+	MediaPending MediaStatus = "pending"
+	MediaDone    MediaStatus = "done"
+	MediaFailed  MediaStatus = "failed"
+	// larger than the size limit
+	MediaSkipped MediaStatus = "skipped"
+	// the file was deleted, being beyond the count limit
+	MediaRemoved MediaStatus = "removed"
+)
+
+// Download of the enclosure of the item.
+type ItemMedia struct {
+	Id     int64       `json:"id"`
+	ItemID int64       `json:"item_id"`
+	FeedID int64       `json:"feed_id"`
+	URL    string      `json:"url"`
+	Type   string      `json:"type"`
+	Status MediaStatus `json:"status"`
+	// path of the file relative to the media directory
+	Path         string     `json:"-"`
+	ContentType  string     `json:"content_type,omitempty"`
+	Size         int64      `json:"size"`
+	Error        string     `json:"error,omitempty"`
+	DownloadedAt *time.Time `json:"downloaded_at"`
+}
+
+func (s *Storage) UpdateFeedMediaDownload(feedId int64, policy *MediaDownloadPolicy) bool {
+	_, err := s.db.Exec(`update feeds set media_download = ? where id = ?`, policy, feedId)
+	return err == nil
+}
+
+// Queue the enclosures of the most recent items of the feed, within the count limit.
+func (s *Storage) QueueFeedMedia(feedID int64, policy MediaDownloadPolicy) bool {
+	limit := -1
+	if policy.MaxCount > 0 {
+		limit = policy.MaxCount
+	}
+	_, err := s.db.Exec(`
+		insert into item_media (item_id, url, type, status)
+		select i.id, json_extract(m.value, '$.url'), json_extract(m.value, '$.type'), ?
+		from (
+			select id, media_links from items where feed_id = ? order by date desc limit ?
+		) i, json_each(i.media_links) m
+		where json_extract(m.value, '$.type') in ('audio', 'video')
+		on conflict (item_id, url) do nothing`,
+		MediaPending, feedID, limit,
+	)
+	if err != nil {
+		log.Print(err)
+	}
+	return err == nil
+}
+
+const itemMediaColumns = `
+	m.id, m.item_id, i.feed_id, m.url, m.type, m.status, m.path, m.content_type, m.size, m.error, m.downloaded_at`
+
+func (s *Storage) listItemMedia(query string, args ...interface{}) []ItemMedia {
+	result := make([]ItemMedia, 0)
+	rows, err := s.db.Query(query, args...)
+	if err != nil {
+		log.Print(err)
+		return result
+	}
+	for rows.Next() {
+		var m ItemMedia
+		var feedID sql.NullInt64
+		err = rows.Scan(
+			&m.Id, &m.ItemID, &feedID, &m.URL, &m.Type, &m.Status,
+			&m.Path, &m.ContentType, &m.Size, &m.Error, &m.DownloadedAt,
+		)
+		if err != nil {
+			log.Print(err)
+			return result
+		}
+		m.FeedID = feedID.Int64
+		result = append(result, m)
+	}
+	return result
+}
+
+// Downloads waiting for their turn, of the feeds still having the downloads enabled.
+func (s *Storage) ListPendingMedia() []ItemMedia {
+	return s.listItemMedia(`
+		select `+itemMediaColumns+`
+		from item_media m
+		join items i on i.id = m.item_id
+		join feeds f on f.id = i.feed_id
+		where m.status = ? and f.media_download is not null
+		order by m.id`,
+		MediaPending,
+	)
+}
+
+func (s *Storage) ListItemMedia(itemID int64) []ItemMedia {
+	return s.listItemMedia(`
+		select `+itemMediaColumns+`
+		from item_media m
+		left join items i on i.id = m.item_id
+		where m.item_id = ?
+		order by m.id`,
+		itemID,
+	)
+}
+
+func (s *Storage) GetItemMedia(id int64) *ItemMedia {
+	result := s.listItemMedia(`
+		select `+itemMediaColumns+`
+		from item_media m
+		left join items i on i.id = m.item_id
+		where m.id = ?`,
+		id,
+	)
+	if len(result) == 0 {
+		return nil
+	}
+	return &result[0]
+}
+
+// Downloaded files of the feed beyond the most recent items to keep.
+func (s *Storage) ListExpiredMedia(feedID int64, keep int) []ItemMedia {
+	return s.listItemMedia(`
+		select `+itemMediaColumns+`
+		from item_media m
+		join items i on i.id = m.item_id
+		where i.feed_id = ? and m.status = ? and i.id not in (
+			select id from items where feed_id = ? order by date desc limit ?
+		)`,
+		feedID, MediaDone, feedID, keep,
+	)
+}
+
+// Downloads of the items deleted by the retention policies or along with their feeds.
+func (s *Storage) ListOrphanedMedia() []ItemMedia {
+	return s.listItemMedia(`
+		select ` + itemMediaColumns + `
+		from item_media m
+		left join items i on i.id = m.item_id
+		where i.id is null`,
+	)
+}
+
+// Save the outcome of the download.
+func (s *Storage) UpdateItemMedia(m ItemMedia) bool {
+	_, err := s.db.Exec(`
+		update item_media
+		set status = ?, path = ?, content_type = ?, size = ?, error = ?, downloaded_at = ?
+		where id = ?`,
+		m.Status, m.Path, m.ContentType, m.Size, m.Error, m.DownloadedAt, m.Id,
+	)
+	if err != nil {
+		log.Print(err)
+	}
+	return err == nil
+}
+
+func (s *Storage) DeleteItemMedia(id int64) bool {
+	_, err := s.db.Exec(`delete from item_media where id = ?`, id)
+	if err != nil {
+		log.Print(err)
+	}
+	return err == nil
+}
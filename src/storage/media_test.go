@@ -0,0 +1,66 @@
+package storage
+
+import (
+	"testing"
+	"time"
+)
+
+func TestItemMedia(t *testing.T) {
+	db := testDB()
+	feed := db.CreateFeed("podcast", "", "", "http://example.com/feed.xml", nil)
+	other := db.CreateFeed("other", "", "", "http://example.com/other.xml", nil)
+	now := time.Now()
+	audio := func(url string) MediaLinks {
+		return MediaLinks{{URL: url, Type: "audio"}, {URL: url + ".jpg", Type: "image"}}
+	}
+	db.CreateItems([]Item{
+		{GUID: "ep1", FeedId: feed.Id, Date: now.Add(-time.Hour * 3), MediaLinks: audio("http://example.com/ep1.mp3")},
+		{GUID: "ep2", FeedId: feed.Id, Date: now.Add(-time.Hour * 2), MediaLinks: audio("http://example.com/ep2.mp3")},
+		{GUID: "ep3", FeedId: feed.Id, Date: now.Add(-time.Hour * 1), MediaLinks: audio("http://example.com/ep3.mp3")},
+		{GUID: "other", FeedId: other.Id, Date: now, MediaLinks: audio("http://example.com/other.mp3")},
+	})
+
+	policy := MediaDownloadPolicy{MaxCount: 2}
+	db.UpdateFeedMediaDownload(feed.Id, &policy)
+	if have := db.GetFeed(feed.Id).MediaDownload; have == nil || *have != policy {
+		t.Fatalf("invalid policy: %#v", have)
+	}
+	db.QueueFeedMedia(feed.Id, policy)
+	db.QueueFeedMedia(other.Id, policy)
+
+	pending := db.ListPendingMedia()
+	if len(pending) != 2 || pending[0].URL != "http://example.com/ep3.mp3" || pending[0].FeedID != feed.Id {
+		t.Fatalf("invalid pending media: %#v", pending)
+	}
+	for _, m := range pending {
+		m.Status = MediaDone
+		m.Path = "1/file.mp3"
+		m.Size = 10
+		db.UpdateItemMedia(m)
+	}
+	if have := db.ListItemMedia(pending[0].ItemID); len(have) != 1 || have[0].Status != MediaDone || have[0].Size != 10 {
+		t.Fatalf("invalid item media: %#v", have)
+	}
+	if have := db.ListExpiredMedia(feed.Id, 2); len(have) != 0 {
+		t.Fatalf("expected no expired media, have: %#v", have)
+	}
+	if have := db.ListExpiredMedia(feed.Id, 1); len(have) != 1 || have[0].URL != "http://example.com/ep2.mp3" {
+		t.Fatalf("invalid expired media: %#v", have)
+	}
+
+	db.db.Exec(`delete from items where guid = 'ep3'`)
+	orphaned := db.ListOrphanedMedia()
+	if len(orphaned) != 1 || orphaned[0].Id != pending[0].Id {
+		t.Fatalf("invalid orphaned media: %#v", orphaned)
+	}
+	db.DeleteItemMedia(orphaned[0].Id)
+	if have := db.GetItemMedia(orphaned[0].Id); have != nil {
+		t.Fatalf("expected the media to be deleted: %#v", have)
+	}
+
+	db.UpdateFeedMediaDownload(feed.Id, nil)
+	db.QueueFeedMedia(feed.Id, MediaDownloadPolicy{})
+	if have := db.ListPendingMedia(); len(have) != 0 {
+		t.Fatalf("expected no pending media of the disabled feeds, have: %#v", have)
+	}
+}
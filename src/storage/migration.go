@@ -4,6 +4,7 @@ import (
 	"database/sql"
 	"fmt"
 	"log"
+	"strings"
 	"time"
 )
 
@@ -22,6 +23,30 @@ var migrations = []func(*sql.Tx) error{
 	m12_add_translation_fields,
 	m13_add_folder_parent_id,
 	m14_add_sort_order,
+	m15_add_retention_policies,
+	m16_add_tags,
+	m17_add_smart_feeds,
+	m18_folder_title_per_parent,
+	m19_add_item_categories_and_comments,
+	m20_add_item_revisions,
+	m21_add_feed_schedules,
+	m22_add_feed_schedule_hints,
+	m23_add_websub_subscriptions,
+	m24_add_feed_request_options,
+	m25_add_feed_fetch_duration,
+	m26_add_feed_health,
+	m27_add_feed_moves,
+	m28_add_item_full_content,
+	m29_add_feed_selectors,
+	m30_add_rules,
+	m31_add_webhooks,
+	m32_add_digests,
+	m33_add_item_media,
+	m34_add_item_playback,
+	m35_add_feed_move_conflict,
+	m36_add_webhook_next_attempt,
+	m37_add_item_raw_hash,
+	m38_add_digest_failures,
 }
 
 var maxVersion = int64(len(migrations))
@@ -66,6 +91,61 @@ func migrate(db *sql.DB) error {
 	return nil
 }
 
+// Rebuild the full-text search index with FTS5, if supported by the sqlite library.
+// Done apart from the versioned migrations, since FTS5 availability depends
+// on the build (see `sqlite_fts5` build tag), not on the db version.
+// Returns whether the index uses FTS5.
+func migrateSearchFTS5(db *sql.DB) (bool, error) {
+	var schema string
+	if err := db.QueryRow(`select sql from sqlite_master where name = 'search'`).Scan(&schema); err != nil {
+		return false, err
+	}
+	if strings.Contains(strings.ToLower(schema), "using fts5") {
+		return true, nil
+	}
+
+	var available bool
+	if err := db.QueryRow(`select sqlite_compileoption_used('ENABLE_FTS5')`).Scan(&available); err != nil {
+		return false, err
+	}
+	if !available {
+		log.Print("fts5 is not available, using fts4 for search")
+		return false, nil
+	}
+
+	log.Print("[migration:fts5] starting")
+	tx, err := db.Begin()
+	if err != nil {
+		return false, err
+	}
+	_, err = tx.Exec(`
+		drop trigger if exists del_item_search;
+
+		create virtual table search_fts5 using fts5(title, description, content);
+		insert into search_fts5 (rowid, title, description, content)
+		select rowid, title, description, content from search;
+		insert into search_fts5 (search_fts5, rank) values ('rank', 'bm25(10.0, 1.0, 1.0)');
+
+		drop table search;
+		alter table search_fts5 rename to search;
+
+		create trigger if not exists del_item_search after delete on items begin
+		  delete from search where rowid = old.search_rowid;
+		end;
+	`)
+	if err != nil {
+		log.Print("[migration:fts5] failed to migrate")
+		tx.Rollback()
+		return false, err
+	}
+	if err = tx.Commit(); err != nil {
+		log.Print("[migration:fts5] failed to commit changes")
+		return false, err
+	}
+	log.Print("[migration:fts5] done")
+	return true, nil
+}
+
 func migrateVersion(v int64, db *sql.DB) error {
 	var err error
 	var tx *sql.Tx
@@ -367,3 +447,352 @@ func m14_add_sort_order(tx *sql.Tx) error {
 	_, err = tx.Exec(`alter table feeds add column sort_order integer not null default 0`)
 	return err
 }
+
+func m15_add_retention_policies(tx *sql.Tx) error {
+	sql := `
+		alter table feeds add column retention json;
+		alter table folders add column retention json;
+	`
+	_, err := tx.Exec(sql)
+	return err
+}
+
+func m16_add_tags(tx *sql.Tx) error {
+	sql := `
+		create table if not exists tags (
+		 id             integer primary key autoincrement,
+		 title          text not null
+		);
+
+		create unique index if not exists idx_tag_title on tags(title);
+
+		create table if not exists item_tags (
+		 item_id        references items(id) on delete cascade,
+		 tag_id         references tags(id) on delete cascade,
+		 primary key (item_id, tag_id)
+		);
+
+		create index if not exists idx_item_tags_tag_id on item_tags(tag_id);
+	`
+	_, err := tx.Exec(sql)
+	return err
+}
+
+func m17_add_smart_feeds(tx *sql.Tx) error {
+	sql := `
+		create table if not exists smart_feeds (
+		 id             integer primary key autoincrement,
+		 title          text not null,
+		 filter         json not null
+		);
+	`
+	_, err := tx.Exec(sql)
+	return err
+}
+
+func m18_folder_title_per_parent(tx *sql.Tx) error {
+	sql := `
+		drop index if exists idx_folder_title;
+		create unique index if not exists idx_folder_parent_title on folders(ifnull(parent_id, 0), title);
+	`
+	_, err := tx.Exec(sql)
+	return err
+}
+
+func m19_add_item_categories_and_comments(tx *sql.Tx) error {
+	sql := `
+		alter table items add column categories json;
+		alter table items add column comments_link text;
+		create index if not exists idx_item_author on items(author collate nocase);
+	`
+	_, err := tx.Exec(sql)
+	return err
+}
+
+func m20_add_item_revisions(tx *sql.Tx) error {
+	sql := `
+		alter table items add column content_hash text;
+
+		create table if not exists item_revisions (
+		 id             integer primary key autoincrement,
+		 item_id        references items(id) on delete cascade,
+		 title          text,
+		 content        text,
+		 date           datetime
+		);
+
+		create index if not exists idx_item_revisions_item_id on item_revisions(item_id);
+	`
+	_, err := tx.Exec(sql)
+	return err
+}
+
+func m21_add_feed_schedules(tx *sql.Tx) error {
+	sql := `
+		alter table feeds add column refresh_interval integer;
+
+		create table if not exists feed_schedules (
+		 feed_id        references feeds(id) on delete cascade unique,
+		 last_check     datetime not null,
+		 post_interval  integer
+		);
+	`
+	_, err := tx.Exec(sql)
+	return err
+}
+
+func m22_add_feed_schedule_hints(tx *sql.Tx) error {
+	sql := `
+		alter table feed_schedules add column next_check datetime;
+		alter table feed_schedules add column skip_hours integer not null default 0;
+		alter table feed_schedules add column skip_days integer not null default 0;
+	`
+	_, err := tx.Exec(sql)
+	return err
+}
+
+func m23_add_websub_subscriptions(tx *sql.Tx) error {
+	sql := `
+		create table if not exists websub_subscriptions (
+		 feed_id       references feeds(id) on delete cascade unique,
+		 hub           text not null,
+		 topic         text not null,
+		 secret        text not null default '',
+		 state         text not null default '',
+		 requested_at  datetime,
+		 expires_at    datetime
+		);
+	`
+	_, err := tx.Exec(sql)
+	return err
+}
+
+func m24_add_feed_request_options(tx *sql.Tx) error {
+	sql := `
+		create table if not exists feed_request_options (
+		 feed_id  references feeds(id) on delete cascade unique,
+		 options  json not null
+		);
+	`
+	_, err := tx.Exec(sql)
+	return err
+}
+
+func m25_add_feed_fetch_duration(tx *sql.Tx) error {
+	sql := `
+		alter table feed_schedules add column fetch_duration integer;
+	`
+	_, err := tx.Exec(sql)
+	return err
+}
+
+func m26_add_feed_health(tx *sql.Tx) error {
+	sql := `
+		create table if not exists feed_fetches (
+		 id        integer primary key autoincrement,
+		 feed_id   references feeds(id) on delete cascade,
+		 date      datetime not null,
+		 status    integer not null default 0,
+		 duration  integer not null default 0,
+		 bytes     integer not null default 0,
+		 error     text not null default '',
+		 items     integer not null default 0
+		);
+
+		create index if not exists idx_feed_fetches_feed on feed_fetches(feed_id, date);
+
+		alter table feed_schedules add column failures integer not null default 0;
+		alter table feed_schedules add column failing_since datetime;
+
+		alter table feeds add column paused_at datetime;
+	`
+	_, err := tx.Exec(sql)
+	return err
+}
+
+func m27_add_feed_moves(tx *sql.Tx) error {
+	sql := `
+		create table if not exists feed_aliases (
+		 feed_id  references feeds(id) on delete cascade,
+		 url      text not null unique,
+		 date     datetime not null
+		);
+
+		create table if not exists feed_moves (
+		 feed_id     references feeds(id) on delete cascade unique,
+		 url         text not null,
+		 reason      text not null,
+		 hits        integer not null default 1,
+		 first_seen  datetime not null
+		);
+
+		alter table feed_schedules add column self_link text not null default '';
+	`
+	_, err := tx.Exec(sql)
+	return err
+}
+
+func m28_add_item_full_content(tx *sql.Tx) error {
+	sql := `
+		alter table feeds add column fetch_full_content boolean not null default 0;
+		alter table items add column full_content text;
+	`
+	_, err := tx.Exec(sql)
+	return err
+}
+
+func m29_add_feed_selectors(tx *sql.Tx) error {
+	sql := `
+		create table if not exists feed_selectors (
+		 feed_id    references feeds(id) on delete cascade unique,
+		 selectors  json not null
+		);
+	`
+	_, err := tx.Exec(sql)
+	return err
+}
+
+func m30_add_rules(tx *sql.Tx) error {
+	sql := `
+		create table if not exists rules (
+		 id         integer primary key autoincrement,
+		 title      text not null,
+		 enabled    boolean not null default 1,
+		 match      json not null,
+		 actions    json not null
+		);
+
+		alter table items add column priority integer not null default 0;
+	`
+	_, err := tx.Exec(sql)
+	return err
+}
+
+func m31_add_webhooks(tx *sql.Tx) error {
+	sql := `
+		create table if not exists webhooks (
+		 id         integer primary key autoincrement,
+		 url        text not null,
+		 secret     text not null,
+		 events     json not null,
+		 filter     json not null,
+		 enabled    boolean not null default 1
+		);
+
+		create table if not exists webhook_deliveries (
+		 id           integer primary key autoincrement,
+		 webhook_id   references webhooks(id) on delete cascade,
+		 event        text not null,
+		 payload      text not null,
+		 status       integer not null default 0,
+		 attempts     integer not null default 0,
+		 error        text not null default '',
+		 created_at   datetime not null,
+		 delivered_at datetime
+		);
+
+		create index if not exists idx_webhook_deliveries_webhook_id on webhook_deliveries(webhook_id);
+	`
+	_, err := tx.Exec(sql)
+	return err
+}
+
+func m32_add_digests(tx *sql.Tx) error {
+	sql := `
+		create table if not exists digests (
+		 id           integer primary key autoincrement,
+		 title        text not null,
+		 email        text not null,
+		 schedule     text not null,
+		 hour         integer not null default 0,
+		 weekday      integer not null default 0,
+		 folder_id    references folders(id) on delete cascade,
+		 smartfeed_id references smart_feeds(id) on delete cascade,
+		 enabled      boolean not null default 1,
+		 created_at   datetime not null,
+		 sent_at      datetime
+		);
+
+		create table if not exists digest_items (
+		 digest_id    references digests(id) on delete cascade,
+		 item_id      references items(id) on delete cascade,
+		 primary key (digest_id, item_id)
+		);
+	`
+	_, err := tx.Exec(sql)
+	return err
+}
+
+func m33_add_item_media(tx *sql.Tx) error {
+	sql := `
+		alter table feeds add column media_download json;
+
+		create table if not exists item_media (
+		 id            integer primary key autoincrement,
+		 item_id       integer not null,
+		 url           text not null,
+		 type          text not null,
+		 status        text not null,
+		 path          text not null default '',
+		 content_type  text not null default '',
+		 size          integer not null default 0,
+		 error         text not null default '',
+		 downloaded_at datetime,
+		 unique (item_id, url)
+		);
+	`
+	_, err := tx.Exec(sql)
+	return err
+}
+
+func m34_add_item_playback(tx *sql.Tx) error {
+	sql := `
+		create table if not exists item_playback (
+		 item_id    references items(id) on delete cascade unique,
+		 url        text not null,
+		 position   real not null default 0,
+		 duration   real not null default 0,
+		 completed  boolean not null default 0,
+		 updated_at datetime not null
+		);
+
+		create index if not exists idx_item_playback_updated_at on item_playback(updated_at);
+	`
+	_, err := tx.Exec(sql)
+	return err
+}
+
+func m35_add_feed_move_conflict(tx *sql.Tx) error {
+	sql := `
+		alter table feed_moves add column conflict_feed_id integer;
+	`
+	_, err := tx.Exec(sql)
+	return err
+}
+
+func m36_add_webhook_next_attempt(tx *sql.Tx) error {
+	sql := `
+		alter table webhook_deliveries add column next_attempt_at datetime;
+
+		create index if not exists idx_webhook_deliveries_next_attempt_at on webhook_deliveries(next_attempt_at);
+	`
+	_, err := tx.Exec(sql)
+	return err
+}
+
+func m37_add_item_raw_hash(tx *sql.Tx) error {
+	sql := `
+		alter table items add column raw_hash text;
+	`
+	_, err := tx.Exec(sql)
+	return err
+}
+
+func m38_add_digest_failures(tx *sql.Tx) error {
+	sql := `
+		alter table digests add column failed_at datetime;
+		alter table digests add column failures integer not null default 0;
+	`
+	_, err := tx.Exec(sql)
+	return err
+}
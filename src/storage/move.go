@@ -0,0 +1,163 @@
+package storage
+
+import (
+	"database/sql"
+	"log"
+	"time"
+)
+
+// Previous url of the feed.
+type FeedAlias struct {
+	URL  string    `json:"url"`
+	Date time.Time `json:"date"`
+}
+
+// Record the new location of the feed seen on the latest fetch, empty if there is none.
+// Returns the number of the consecutive fetches the location has been seen on,
+// or 0 while the location belongs to another feed (see `MoveFeed`).
+func (s *Storage) TrackFeedMove(feedID int64, url, reason string) int {
+	if url == "" {
+		if _, err := s.db.Exec(`delete from feed_moves where feed_id = ?`, feedID); err != nil {
+			log.Print(err)
+		}
+		return 0
+	}
+	var hits int
+	err := s.db.QueryRow(`
+		insert into feed_moves (feed_id, url, reason, hits, first_seen)
+		values (?, ?, ?, 1, ?)
+		on conflict (feed_id) do update set
+			hits = iif(url = excluded.url, hits + 1, 1),
+			first_seen = iif(url = excluded.url, first_seen, excluded.first_seen),
+			conflict_feed_id = iif(url = excluded.url, conflict_feed_id, null),
+			url = excluded.url,
+			reason = excluded.reason
+		returning iif(exists (select 1 from feeds where id = conflict_feed_id), 0, hits)`,
+		feedID, url, reason, time.Now().UTC(),
+	).Scan(&hits)
+	if err != nil {
+		log.Print(err)
+	}
+	return hits
+}
+
+// Change the url of the feed, keeping the previous one as an alias.
+// Fails if the new url belongs to another feed, the move is then
+// kept as conflicting until the feed points to a different location.
+func (s *Storage) MoveFeed(feedID int64, newLink string) bool {
+	tx, err := s.db.Begin()
+	if err != nil {
+		log.Print(err)
+		return false
+	}
+	defer tx.Rollback()
+
+	var conflictID int64
+	err = tx.QueryRow(`select id from feeds where feed_link = ? and id != ?`, newLink, feedID).Scan(&conflictID)
+	if err == nil {
+		log.Printf("Feed %d not moved to %s: the url belongs to feed %d", feedID, newLink, conflictID)
+		_, err = tx.Exec(`update feed_moves set conflict_feed_id = ? where feed_id = ?`, conflictID, feedID)
+		if err == nil {
+			err = tx.Commit()
+		}
+		if err != nil {
+			log.Print(err)
+		}
+		return false
+	}
+	if err != sql.ErrNoRows {
+		log.Print(err)
+		return false
+	}
+
+	var oldLink string
+	err = tx.QueryRow(`select feed_link from feeds where id = ?`, feedID).Scan(&oldLink)
+	if err == nil && oldLink != newLink {
+		_, err = tx.Exec(`
+			insert into feed_aliases (feed_id, url, date) values (?, ?, ?)
+			on conflict (url) do update set feed_id = excluded.feed_id, date = excluded.date`,
+			feedID, oldLink, time.Now().UTC(),
+		)
+		if err == nil {
+			_, err = tx.Exec(`delete from feed_aliases where url = ?`, newLink)
+		}
+		if err == nil {
+			_, err = tx.Exec(`update feeds set feed_link = ? where id = ?`, newLink, feedID)
+		}
+	}
+	if err == nil {
+		_, err = tx.Exec(`delete from feed_moves where feed_id = ?`, feedID)
+	}
+	if err == nil {
+		err = tx.Commit()
+	}
+	if err != nil {
+		log.Print(err)
+		return false
+	}
+	return true
+}
+
+// Previous urls of the feed, newest first.
+func (s *Storage) ListFeedAliases(feedID int64) []FeedAlias {
+	result := make([]FeedAlias, 0)
+	rows, err := s.db.Query(`
+		select url, date from feed_aliases where feed_id = ? order by date desc
+	`, feedID)
+	if err != nil {
+		log.Print(err)
+		return result
+	}
+	for rows.Next() {
+		var alias FeedAlias
+		if err = rows.Scan(&alias.URL, &alias.Date); err != nil {
+			log.Print(err)
+			return result
+		}
+		result = append(result, alias)
+	}
+	return result
+}
+
+// Url the feed is being tracked as moving to, empty if none.
+func (s *Storage) FeedMoveURL(feedID int64) string {
+	var url string
+	err := s.db.QueryRow(`select url from feed_moves where feed_id = ?`, feedID).Scan(&url)
+	if err != nil && err != sql.ErrNoRows {
+		log.Print(err)
+	}
+	return url
+}
+
+// Id of the feed which used to be located at the url.
+func (s *Storage) getFeedIdByAlias(url string) *int64 {
+	var feedID int64
+	err := s.db.QueryRow(`select feed_id from feed_aliases where url = ?`, url).Scan(&feedID)
+	if err != nil {
+		if err != sql.ErrNoRows {
+			log.Print(err)
+		}
+		return nil
+	}
+	return &feedID
+}
+
+// Remember the self link of the feed, returning the previous one.
+func (s *Storage) SetFeedSelfLink(feedID int64, link string) string {
+	var prev string
+	err := s.db.QueryRow(`
+		select self_link from feed_schedules where feed_id = ?`, feedID,
+	).Scan(&prev)
+	if err != nil && err != sql.ErrNoRows {
+		log.Print(err)
+	}
+	_, err = s.db.Exec(`
+		insert into feed_schedules (feed_id, last_check, self_link) values (?, ?, ?)
+		on conflict (feed_id) do update set self_link = excluded.self_link`,
+		feedID, time.Now().UTC(), link,
+	)
+	if err != nil {
+		log.Print(err)
+	}
+	return prev
+}
@@ -0,0 +1,54 @@
+package storage
+
+import "testing"
+
+func TestMoveFeed(t *testing.T) {
+	db := testDB()
+	feed := db.CreateFeed("feed", "", "", "http://example.com/old.xml", nil)
+	other := db.CreateFeed("other", "", "", "http://example.com/other.xml", nil)
+
+	hits := []int{
+		db.TrackFeedMove(feed.Id, "http://example.com/new.xml", "redirect"),
+		db.TrackFeedMove(feed.Id, "http://example.com/new.xml", "redirect"),
+		db.TrackFeedMove(feed.Id, "http://example.com/newer.xml", "redirect"),
+		db.TrackFeedMove(feed.Id, "", ""),
+		db.TrackFeedMove(feed.Id, "http://example.com/new.xml", "redirect"),
+	}
+	want := []int{1, 2, 1, 0, 1}
+	for i := range want {
+		if hits[i] != want[i] {
+			t.Fatalf("invalid hits: want %v, have %v", want, hits)
+		}
+	}
+
+	// the url of another feed is not tracked any further
+	db.TrackFeedMove(feed.Id, other.FeedLink, "redirect")
+	if db.MoveFeed(feed.Id, other.FeedLink) {
+		t.Fatal("moved feed to the url of another feed")
+	}
+	if hits := db.TrackFeedMove(feed.Id, other.FeedLink, "redirect"); hits != 0 {
+		t.Fatalf("conflicting move still tracked: %d", hits)
+	}
+	if hits := db.TrackFeedMove(feed.Id, "http://example.com/new.xml", "redirect"); hits != 1 {
+		t.Fatalf("invalid hits: %d", hits)
+	}
+	if !db.MoveFeed(feed.Id, "http://example.com/new.xml") {
+		t.Fatal("failed to move feed")
+	}
+	if have := db.GetFeed(feed.Id).FeedLink; have != "http://example.com/new.xml" {
+		t.Fatalf("feed link not updated: %s", have)
+	}
+	if aliases := db.ListFeedAliases(feed.Id); len(aliases) != 1 || aliases[0].URL != "http://example.com/old.xml" {
+		t.Fatalf("invalid aliases: %#v", aliases)
+	}
+
+	// the feed is found by the previous url
+	folder := db.CreateFolder("folder", nil)
+	same := db.CreateFeed("feed", "", "", "http://example.com/old.xml", &folder.Id)
+	if same == nil || same.Id != feed.Id || *db.GetFeed(feed.Id).FolderId != folder.Id {
+		t.Fatalf("duplicate feed created: %#v", same)
+	}
+	if len(db.ListFeeds()) != 2 {
+		t.Fatalf("invalid number of feeds: %d", len(db.ListFeeds()))
+	}
+}
@@ -0,0 +1,127 @@
+package storage
+
+import (
+	"database/sql"
+	"database/sql/driver"
+	"encoding/json"
+	"log"
+)
+
+// Extra parameters of the http requests for the feed, e.g. the credentials of a private feed.
+// Kept apart from the feeds, so that they don't end up in the listings & exports.
+// The secrets are stored as is (the database file is to be kept private), but left out of the backups.
+type RequestOptions struct {
+	Username string `json:"username,omitempty"`
+	Password string `json:"password,omitempty"`
+	// bearer token, sent in the `Authorization` header
+	Token     string            `json:"token,omitempty"`
+	Cookie    string            `json:"cookie,omitempty"`
+	UserAgent string            `json:"user_agent,omitempty"`
+	Headers   map[string]string `json:"headers,omitempty"`
+}
+
+// Placeholder of the secret values in the api responses.
+// When received back, the stored values are kept.
+const SecretMask = "********"
+
+func (o *RequestOptions) Scan(src any) error {
+	switch data := src.(type) {
+	case []byte:
+		return json.Unmarshal(data, o)
+	case string:
+		return json.Unmarshal([]byte(data), o)
+	default:
+		return nil
+	}
+}
+
+func (o RequestOptions) Value() (driver.Value, error) {
+	return json.Marshal(o)
+}
+
+func (o RequestOptions) IsEmpty() bool {
+	return o.Username == "" && o.Password == "" && o.Token == "" &&
+		o.Cookie == "" && o.UserAgent == "" && len(o.Headers) == 0
+}
+
+// Copy of the options with the secrets replaced by the mask.
+func (o RequestOptions) Masked() RequestOptions {
+	mask := func(val string) string {
+		if val == "" {
+			return ""
+		}
+		return SecretMask
+	}
+	masked := o
+	masked.Password = mask(o.Password)
+	masked.Token = mask(o.Token)
+	masked.Cookie = mask(o.Cookie)
+	if len(o.Headers) > 0 {
+		masked.Headers = make(map[string]string, len(o.Headers))
+		for name, val := range o.Headers {
+			masked.Headers[name] = mask(val)
+		}
+	}
+	return masked
+}
+
+// Copy of the options without the secrets, usable as is but lacking the credentials.
+func (o RequestOptions) WithoutSecrets() RequestOptions {
+	stripped := o
+	stripped.Password = ""
+	stripped.Token = ""
+	stripped.Cookie = ""
+	stripped.Headers = nil
+	return stripped
+}
+
+// Copy of the options with the masked secrets replaced by the values from the previous version.
+func (o RequestOptions) Unmasked(prev RequestOptions) RequestOptions {
+	unmask := func(val, prevVal string) string {
+		if val == SecretMask {
+			return prevVal
+		}
+		return val
+	}
+	unmasked := o
+	unmasked.Password = unmask(o.Password, prev.Password)
+	unmasked.Token = unmask(o.Token, prev.Token)
+	unmasked.Cookie = unmask(o.Cookie, prev.Cookie)
+	if len(o.Headers) > 0 {
+		unmasked.Headers = make(map[string]string, len(o.Headers))
+		for name, val := range o.Headers {
+			unmasked.Headers[name] = unmask(val, prev.Headers[name])
+		}
+	}
+	return unmasked
+}
+
+func (s *Storage) GetFeedRequestOptions(feedID int64) *RequestOptions {
+	var options RequestOptions
+	err := s.db.QueryRow(`select options from feed_request_options where feed_id = ?`, feedID).Scan(&options)
+	if err != nil {
+		if err != sql.ErrNoRows {
+			log.Print(err)
+		}
+		return nil
+	}
+	return &options
+}
+
+// Set the request options of the feed, nil (or empty options) to remove them.
+func (s *Storage) UpdateFeedRequestOptions(feedID int64, options *RequestOptions) bool {
+	var err error
+	if options == nil || options.IsEmpty() {
+		_, err = s.db.Exec(`delete from feed_request_options where feed_id = ?`, feedID)
+	} else {
+		_, err = s.db.Exec(`
+			insert into feed_request_options (feed_id, options) values (?, ?)
+			on conflict (feed_id) do update set options = excluded.options`,
+			feedID, *options,
+		)
+	}
+	if err != nil {
+		log.Print(err)
+	}
+	return err == nil
+}
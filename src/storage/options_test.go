@@ -0,0 +1,43 @@
+package storage
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestFeedRequestOptions(t *testing.T) {
+	db := testDB()
+	feed := db.CreateFeed("feed", "", "", "http://example.com/feed.xml", nil)
+
+	options := RequestOptions{
+		Username: "user",
+		Password: "pass",
+		Headers:  map[string]string{"X-Api-Key": "key"},
+	}
+	db.UpdateFeedRequestOptions(feed.Id, &options)
+	if have := db.GetFeedRequestOptions(feed.Id); have == nil || !reflect.DeepEqual(*have, options) {
+		t.Fatalf("invalid options: %#v", have)
+	}
+
+	masked := options.Masked()
+	if masked.Username != "user" || masked.Password != SecretMask || masked.Headers["X-Api-Key"] != SecretMask {
+		t.Fatalf("invalid masked options: %#v", masked)
+	}
+	masked.Username = "other"
+	masked.Headers["X-Other"] = "value"
+	want := RequestOptions{
+		Username: "other",
+		Password: "pass",
+		Headers:  map[string]string{"X-Api-Key": "key", "X-Other": "value"},
+	}
+	if have := masked.Unmasked(options); !reflect.DeepEqual(have, want) {
+		t.Logf("want: %#v", want)
+		t.Logf("have: %#v", have)
+		t.Fatal("invalid unmasked options")
+	}
+
+	db.UpdateFeedRequestOptions(feed.Id, &RequestOptions{})
+	if have := db.GetFeedRequestOptions(feed.Id); have != nil {
+		t.Fatalf("empty options not removed: %#v", have)
+	}
+}
@@ -0,0 +1,139 @@
+package storage
+
+import (
+	"database/sql"
+	"log"
+	"time"
+)
+
+// Share of the duration after which the playback is considered completed.
+const playbackCompletedRatio = 0.95
+
+// Progress of the playback of the audio/video enclosure of the item.
+type ItemPlayback struct {
+	ItemID int64  `json:"item_id"`
+	URL    string `json:"url"`
+	// in seconds
+	Position  float64   `json:"position"`
+	Duration  float64   `json:"duration"`
+	Completed bool      `json:"completed"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// Save the progress of the playback, unless a more recent one is saved already (e.g. from another device).
+// The time of the progress defaults to the current one; the playback once completed stays completed.
+// The unread items are marked read with the progress of the completed playback saved.
+// Returns the playback saved for the item.
+func (s *Storage) UpdateItemPlayback(p ItemPlayback) *ItemPlayback {
+	if p.Duration > 0 && p.Position >= p.Duration*playbackCompletedRatio {
+		p.Completed = true
+	}
+	now := time.Now().UTC()
+	if p.UpdatedAt.IsZero() || p.UpdatedAt.After(now) {
+		p.UpdatedAt = now
+	}
+	p.UpdatedAt = p.UpdatedAt.UTC()
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		log.Print(err)
+		return nil
+	}
+	defer tx.Rollback()
+
+	res, err := tx.Exec(`
+		insert into item_playback (item_id, url, position, duration, completed, updated_at)
+		values (?, ?, ?, ?, ?, ?)
+		on conflict (item_id) do update set
+			url = excluded.url,
+			position = excluded.position,
+			duration = excluded.duration,
+			completed = item_playback.completed or excluded.completed,
+			updated_at = excluded.updated_at
+		where excluded.updated_at >= item_playback.updated_at`,
+		p.ItemID, p.URL, p.Position, p.Duration, p.Completed, p.UpdatedAt,
+	)
+	var saved int64
+	if err == nil {
+		saved, err = res.RowsAffected()
+	}
+	if err == nil {
+		err = tx.QueryRow(`
+			select item_id, url, position, duration, completed, updated_at
+			from item_playback where item_id = ?
+		`, p.ItemID).Scan(&p.ItemID, &p.URL, &p.Position, &p.Duration, &p.Completed, &p.UpdatedAt)
+	}
+	if err == nil && saved > 0 && p.Completed {
+		_, err = tx.Exec(`update items set status = ? where id = ? and status = ?`, READ, p.ItemID, UNREAD)
+	}
+	if err == nil {
+		err = tx.Commit()
+	}
+	if err != nil {
+		log.Print(err)
+		return nil
+	}
+	return &p
+}
+
+func (s *Storage) GetItemPlayback(itemID int64) *ItemPlayback {
+	var p ItemPlayback
+	err := s.db.QueryRow(`
+		select item_id, url, position, duration, completed, updated_at
+		from item_playback where item_id = ?
+	`, itemID).Scan(&p.ItemID, &p.URL, &p.Position, &p.Duration, &p.Completed, &p.UpdatedAt)
+	if err != nil {
+		if err != sql.ErrNoRows {
+			log.Print(err)
+		}
+		return nil
+	}
+	return &p
+}
+
+// Items with the playback started but not completed, the most recently played first.
+func (s *Storage) ListContinueListening(limit int) []Item {
+	result := make([]Item, 0)
+	rows, err := s.db.Query(`
+		select p.item_id, p.url, p.position, p.duration, p.completed, p.updated_at
+		from item_playback p
+		join items i on i.id = p.item_id
+		where not p.completed and p.position > 0
+		order by p.updated_at desc
+		limit ?`,
+		limit,
+	)
+	if err != nil {
+		log.Print(err)
+		return result
+	}
+	playbacks := make([]ItemPlayback, 0)
+	for rows.Next() {
+		var p ItemPlayback
+		if err = rows.Scan(&p.ItemID, &p.URL, &p.Position, &p.Duration, &p.Completed, &p.UpdatedAt); err != nil {
+			log.Print(err)
+			return result
+		}
+		playbacks = append(playbacks, p)
+	}
+	if len(playbacks) == 0 {
+		return result
+	}
+
+	ids := make([]int64, len(playbacks))
+	for i, p := range playbacks {
+		ids[i] = p.ItemID
+	}
+	items := make(map[int64]Item)
+	for _, item := range s.ListItems(ItemFilter{IDs: &ids}, len(ids), true, false) {
+		items[item.Id] = item
+	}
+	for _, p := range playbacks {
+		if item, ok := items[p.ItemID]; ok {
+			playback := p
+			item.Playback = &playback
+			result = append(result, item)
+		}
+	}
+	return result
+}
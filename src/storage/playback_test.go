@@ -0,0 +1,84 @@
+package storage
+
+import (
+	"testing"
+	"time"
+)
+
+func TestItemPlayback(t *testing.T) {
+	db := testDB()
+	feed := db.CreateFeed("podcast", "", "", "http://example.com/feed.xml", nil)
+	now := time.Now()
+	db.CreateItems([]Item{
+		{GUID: "ep1", FeedId: feed.Id, Date: now.Add(-time.Hour * 2), Status: UNREAD},
+		{GUID: "ep2", FeedId: feed.Id, Date: now.Add(-time.Hour * 1), Status: UNREAD},
+		{GUID: "ep3", FeedId: feed.Id, Date: now, Status: STARRED},
+	})
+	ep1 := getItem(db, "ep1")
+	ep2 := getItem(db, "ep2")
+	ep3 := getItem(db, "ep3")
+
+	if have := db.GetItemPlayback(ep1.Id); have != nil {
+		t.Fatalf("expected no playback, have: %#v", have)
+	}
+
+	db.UpdateItemPlayback(ItemPlayback{ItemID: ep1.Id, URL: "http://example.com/ep1.mp3", Position: 10, Duration: 100})
+	db.UpdateItemPlayback(ItemPlayback{ItemID: ep2.Id, URL: "http://example.com/ep2.mp3", Position: 20, Duration: 100})
+	have := db.UpdateItemPlayback(ItemPlayback{ItemID: ep1.Id, URL: "http://example.com/ep1.mp3", Position: 30, Duration: 100})
+	if have == nil || have.Completed || have.Position != 30 {
+		t.Fatalf("invalid playback: %#v", have)
+	}
+	if have := db.GetItemPlayback(ep1.Id); have == nil || have.Position != 30 || have.URL != "http://example.com/ep1.mp3" {
+		t.Fatalf("invalid playback: %#v", have)
+	}
+
+	list := db.ListContinueListening(10)
+	if len(list) != 2 || list[0].Id != ep1.Id || list[1].Id != ep2.Id || list[0].Playback.Position != 30 {
+		t.Fatalf("invalid continue listening list: %#v", list)
+	}
+	if list := db.ListContinueListening(1); len(list) != 1 || list[0].Id != ep1.Id {
+		t.Fatalf("invalid continue listening list: %#v", list)
+	}
+
+	// close to the end
+	have = db.UpdateItemPlayback(ItemPlayback{ItemID: ep1.Id, URL: "http://example.com/ep1.mp3", Position: 98, Duration: 100})
+	if have == nil || !have.Completed {
+		t.Fatalf("expected the playback to be completed: %#v", have)
+	}
+	if status := getItem(db, "ep1").Status; status != READ {
+		t.Fatalf("expected the item to be read, have: %d", status)
+	}
+	if list := db.ListContinueListening(10); len(list) != 1 || list[0].Id != ep2.Id {
+		t.Fatalf("invalid continue listening list: %#v", list)
+	}
+
+	// the completed playback stays completed
+	have = db.UpdateItemPlayback(ItemPlayback{ItemID: ep1.Id, URL: "http://example.com/ep1.mp3", Position: 5, Duration: 100})
+	if have == nil || !have.Completed || have.Position != 5 {
+		t.Fatalf("expected the playback to stay completed: %#v", have)
+	}
+
+	// the outdated progress (e.g. from another device) is ignored
+	have = db.UpdateItemPlayback(ItemPlayback{ItemID: ep2.Id, URL: "http://example.com/ep2.mp3", Position: 10, Duration: 100, UpdatedAt: now.Add(-time.Minute)})
+	if have == nil || have.Position != 20 {
+		t.Fatalf("expected the outdated playback to be ignored: %#v", have)
+	}
+	if have := db.GetItemPlayback(ep2.Id); have == nil || have.Position != 20 {
+		t.Fatalf("expected the outdated playback to be ignored: %#v", have)
+	}
+	have = db.UpdateItemPlayback(ItemPlayback{ItemID: ep2.Id, URL: "http://example.com/ep2.mp3", Position: 100, Duration: 100, UpdatedAt: now.Add(-time.Minute)})
+	if have == nil || have.Completed || getItem(db, "ep2").Status != UNREAD {
+		t.Fatalf("expected the outdated playback to be ignored: %#v", have)
+	}
+	// the time of the progress is never ahead of the server
+	have = db.UpdateItemPlayback(ItemPlayback{ItemID: ep2.Id, URL: "http://example.com/ep2.mp3", Position: 30, Duration: 100, UpdatedAt: now.Add(time.Hour)})
+	if have == nil || have.Position != 30 || have.UpdatedAt.After(time.Now()) {
+		t.Fatalf("invalid playback: %#v", have)
+	}
+
+	// the starred items stay starred
+	db.UpdateItemPlayback(ItemPlayback{ItemID: ep3.Id, URL: "http://example.com/ep3.mp3", Completed: true})
+	if status := getItem(db, "ep3").Status; status != STARRED {
+		t.Fatalf("expected the item to stay starred, have: %d", status)
+	}
+}
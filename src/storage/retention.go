@@ -0,0 +1,121 @@
+package storage
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"log"
+)
+
+type RetentionMode string
+
+const (
+	// keep items according to the default rules (see `DeleteOldItems`)
+	RetentionDefault RetentionMode = ""
+	// never delete items
+	RetentionForever RetentionMode = "forever"
+	// keep the last N items
+	RetentionItems RetentionMode = "items"
+	// keep items for N days
+	RetentionDays RetentionMode = "days"
+	// delete read items older than N days
+	RetentionReadDays RetentionMode = "read_days"
+)
+
+type RetentionPolicy struct {
+	Mode  RetentionMode `json:"mode"`
+	Limit int           `json:"limit,omitempty"`
+}
+
+func (p RetentionPolicy) IsValid() bool {
+	switch p.Mode {
+	case RetentionDefault, RetentionForever:
+		return true
+	case RetentionItems, RetentionDays, RetentionReadDays:
+		return p.Limit > 0
+	}
+	return false
+}
+
+func (p *RetentionPolicy) Scan(src any) error {
+	switch data := src.(type) {
+	case []byte:
+		return json.Unmarshal(data, p)
+	case string:
+		return json.Unmarshal([]byte(data), p)
+	default:
+		return nil
+	}
+}
+
+func (p RetentionPolicy) Value() (driver.Value, error) {
+	return json.Marshal(p)
+}
+
+// Policies with the default mode are stored as null,
+// so that the feed/folder inherits the policy of its parent.
+func retentionValue(policy *RetentionPolicy) *RetentionPolicy {
+	if policy == nil || policy.Mode == RetentionDefault {
+		return nil
+	}
+	return policy
+}
+
+func (s *Storage) UpdateFeedRetention(feedId int64, policy *RetentionPolicy) bool {
+	_, err := s.db.Exec(`update feeds set retention = ? where id = ?`, retentionValue(policy), feedId)
+	return err == nil
+}
+
+func (s *Storage) UpdateFolderRetention(folderId int64, policy *RetentionPolicy) bool {
+	_, err := s.db.Exec(`update folders set retention = ? where id = ?`, retentionValue(policy), folderId)
+	return err == nil
+}
+
+// Resolve the effective retention policy of every feed.
+// A feed without its own policy inherits the one of the closest folder up the tree.
+// Feeds with no policy in effect are omitted.
+func (s *Storage) feedRetentionPolicies() map[int64]RetentionPolicy {
+	result := make(map[int64]RetentionPolicy)
+
+	type node struct {
+		parentId *int64
+		policy   *RetentionPolicy
+	}
+
+	folders := make(map[int64]node)
+	rows, err := s.db.Query(`select id, parent_id, retention from folders`)
+	if err != nil {
+		log.Print(err)
+		return result
+	}
+	for rows.Next() {
+		var id int64
+		var n node
+		if err = rows.Scan(&id, &n.parentId, &n.policy); err != nil {
+			log.Print(err)
+			return result
+		}
+		folders[id] = n
+	}
+
+	rows, err = s.db.Query(`select id, folder_id, retention from feeds`)
+	if err != nil {
+		log.Print(err)
+		return result
+	}
+	for rows.Next() {
+		var id int64
+		var n node
+		if err = rows.Scan(&id, &n.parentId, &n.policy); err != nil {
+			log.Print(err)
+			return result
+		}
+		// the depth limit guards against cycles in the folder tree
+		for depth := 0; n.policy == nil && n.parentId != nil && depth < len(folders); depth++ {
+			n = folders[*n.parentId]
+		}
+		if n.policy != nil {
+			result[id] = *n.policy
+		}
+	}
+	return result
+}
@@ -0,0 +1,152 @@
+package storage
+
+import (
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"log"
+	"time"
+
+	"github.com/nkanaev/yarr/src/content/htmlutil"
+)
+
+// Previous version of an item, saved when the feed publishes an updated one.
+type ItemRevision struct {
+	Id      int64     `json:"id"`
+	ItemId  int64     `json:"item_id"`
+	Title   string    `json:"title"`
+	Content string    `json:"content"`
+	Date    time.Time `json:"date"`
+}
+
+// Only the text is hashed, so that markup changes
+// (tracking parameters, image sizes, etc) don't count as updates.
+func itemContentHash(title, content string) string {
+	hash := sha256.Sum256([]byte(title + "\x00" + htmlutil.ExtractText(content)))
+	return hex.EncodeToString(hash[:])
+}
+
+// Hash of the item as published, telling the unchanged items apart without parsing the content.
+func itemRawHash(title, content string) string {
+	hash := sha256.Sum256([]byte(title + "\x00" + content))
+	return hex.EncodeToString(hash[:])
+}
+
+// Compare the item against the stored one with the same guid.
+// If the content has changed, the stored version is saved as a revision
+// and replaced by the new one. The text is compared only if the feed
+// publishes the item differently than last time.
+func updateItem(tx *sql.Tx, item Item, markUnread bool) error {
+	var id int64
+	var hash, rawHash sql.NullString
+	var dateUpdated *time.Time
+	err := tx.QueryRow(`
+		select id, content_hash, raw_hash, date_updated from items where feed_id = ? and guid = ?
+	`, item.FeedId, item.GUID).Scan(&id, &hash, &rawHash, &dateUpdated)
+	if err != nil {
+		return err
+	}
+
+	// the feed reports the same modification date: nothing has changed
+	if item.DateUpdated != nil && dateUpdated != nil && !item.DateUpdated.After(*dateUpdated) {
+		return nil
+	}
+
+	newRawHash := itemRawHash(item.Title, item.Content)
+	if rawHash.Valid && rawHash.String == newRawHash {
+		if item.DateUpdated != nil {
+			_, err = tx.Exec(`
+				update items set date_updated = strftime('%Y-%m-%d %H:%M:%f', ?) where id = ?
+			`, item.DateUpdated, id)
+		}
+		return err
+	}
+
+	newHash := itemContentHash(item.Title, item.Content)
+	if !hash.Valid {
+		// items created before the revisions were introduced
+		var title, content string
+		err = tx.QueryRow(`
+			select coalesce(title, ''), coalesce(content, '') from items where id = ?
+		`, id).Scan(&title, &content)
+		if err != nil {
+			return err
+		}
+		hash = sql.NullString{String: itemContentHash(title, content), Valid: true}
+	}
+	if hash.String == newHash {
+		// the markup has changed only
+		_, err = tx.Exec(`
+			update items set
+				content_hash = ?, raw_hash = ?,
+				date_updated = coalesce(strftime('%Y-%m-%d %H:%M:%f', ?), date_updated)
+			where id = ?
+		`, newHash, newRawHash, item.DateUpdated, id)
+		return err
+	}
+
+	date := time.Now().UTC()
+	if item.DateUpdated != nil {
+		date = *item.DateUpdated
+	}
+	status := READ
+	if markUnread {
+		status = UNREAD
+	}
+	queries := []struct {
+		sql  string
+		args []interface{}
+	}{
+		{`
+			insert into item_revisions (item_id, title, content, date)
+			select id, title, content, coalesce(date_updated, date) from items where id = ?
+		`, []interface{}{id}},
+		// reindexed by `SyncSearch`
+		{`delete from search where rowid = (select search_rowid from items where id = ?)`, []interface{}{id}},
+		{`
+			update items set
+				title = ?, link = ?, content = ?, media_links = ?,
+				author = ?, categories = ?, comments_link = ?,
+				content_hash = ?, raw_hash = ?, date_updated = strftime('%Y-%m-%d %H:%M:%f', ?),
+				search_rowid = null,
+				status = case when status = ? then ? else status end
+			where id = ?
+		`, []interface{}{
+			item.Title, item.Link, item.Content, item.MediaLinks,
+			item.Author, item.Categories, item.CommentsLink,
+			newHash, newRawHash, date,
+			READ, status,
+			id,
+		}},
+	}
+	for _, query := range queries {
+		if _, err = tx.Exec(query.sql, query.args...); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// List the previous versions of the item, oldest first.
+func (s *Storage) ListItemRevisions(itemId int64) []ItemRevision {
+	result := make([]ItemRevision, 0)
+	rows, err := s.db.Query(`
+		select id, item_id, coalesce(title, ''), coalesce(content, ''), date
+		from item_revisions
+		where item_id = ?
+		order by id
+	`, itemId)
+	if err != nil {
+		log.Print(err)
+		return result
+	}
+	for rows.Next() {
+		var r ItemRevision
+		if err = rows.Scan(&r.Id, &r.ItemId, &r.Title, &r.Content, &r.Date); err != nil {
+			log.Print(err)
+			return result
+		}
+		result = append(result, r)
+	}
+	return result
+}
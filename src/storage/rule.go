@@ -0,0 +1,387 @@
+package storage
+
+import (
+	"database/sql"
+	"database/sql/driver"
+	"encoding/json"
+	"fmt"
+	"log"
+	"regexp"
+	"strings"
+
+	"github.com/nkanaev/yarr/src/content/htmlutil"
+)
+
+// Rule applied to the new items of the feeds as they arrive, before they are stored.
+// The enabled rules are applied in the order of their creation:
+// the later ones override the status & the priority set by the earlier ones,
+// the tags are accumulated, and the dropped items aren't processed any further.
+type Rule struct {
+	Id      int64       `json:"id"`
+	Title   string      `json:"title"`
+	Enabled bool        `json:"enabled"`
+	Match   RuleMatch   `json:"match"`
+	Actions RuleActions `json:"actions"`
+}
+
+type RuleMatch struct {
+	// the feeds the rule applies to, either directly or via the folders (along with their subfolders).
+	// all the feeds if none is given.
+	FeedIDs   []int64 `json:"feed_ids,omitempty"`
+	FolderIDs []int64 `json:"folder_ids,omitempty"`
+	// all of the conditions have to hold
+	Conditions []RuleCondition `json:"conditions,omitempty"`
+}
+
+type RuleField string
+
+const (
+	RuleFieldTitle    RuleField = "title"
+	RuleFieldContent  RuleField = "content"
+	RuleFieldAuthor   RuleField = "author"
+	RuleFieldCategory RuleField = "category"
+	RuleFieldLink     RuleField = "link"
+)
+
+type RuleCondition struct {
+	Field RuleField `json:"field"`
+	// comma-separated keywords, any of which has to be found in the field (case-insensitive),
+	// or the regular expression if `Regex` is set
+	Value string `json:"value"`
+	Regex bool   `json:"regex,omitempty"`
+	// the condition holds if the field doesn't match
+	Negate bool `json:"negate,omitempty"`
+}
+
+type RuleActions struct {
+	// read or starred
+	Status   *ItemStatus `json:"status,omitempty"`
+	Tags     []int64     `json:"tags,omitempty"`
+	Priority *int        `json:"priority,omitempty"`
+	// don't store the item at all
+	Drop bool `json:"drop,omitempty"`
+}
+
+func (m *RuleMatch) Scan(src any) error {
+	switch data := src.(type) {
+	case []byte:
+		return json.Unmarshal(data, m)
+	case string:
+		return json.Unmarshal([]byte(data), m)
+	default:
+		return nil
+	}
+}
+
+func (m RuleMatch) Value() (driver.Value, error) {
+	return json.Marshal(m)
+}
+
+func (a *RuleActions) Scan(src any) error {
+	switch data := src.(type) {
+	case []byte:
+		return json.Unmarshal(data, a)
+	case string:
+		return json.Unmarshal([]byte(data), a)
+	default:
+		return nil
+	}
+}
+
+func (a RuleActions) Value() (driver.Value, error) {
+	return json.Marshal(a)
+}
+
+func (r Rule) Validate() error {
+	if r.Title == "" {
+		return fmt.Errorf("title missing")
+	}
+	for _, cond := range r.Match.Conditions {
+		switch cond.Field {
+		case RuleFieldTitle, RuleFieldContent, RuleFieldAuthor, RuleFieldCategory, RuleFieldLink:
+		default:
+			return fmt.Errorf("unknown field %q", cond.Field)
+		}
+		if strings.TrimSpace(cond.Value) == "" {
+			return fmt.Errorf("value of the %s condition missing", cond.Field)
+		}
+		if cond.Regex {
+			if _, err := regexp.Compile(cond.Value); err != nil {
+				return err
+			}
+		}
+	}
+	if status := r.Actions.Status; status != nil && *status != READ && *status != STARRED {
+		return fmt.Errorf("invalid status")
+	}
+	a := r.Actions
+	if a.Status == nil && len(a.Tags) == 0 && a.Priority == nil && !a.Drop {
+		return fmt.Errorf("actions missing")
+	}
+	return nil
+}
+
+func (s *Storage) CreateRule(rule Rule) *Rule {
+	row := s.db.QueryRow(`
+		insert into rules (title, enabled, match, actions) values (?, ?, ?, ?)
+		returning id`,
+		rule.Title, rule.Enabled, rule.Match, rule.Actions,
+	)
+	if err := row.Scan(&rule.Id); err != nil {
+		log.Print(err)
+		return nil
+	}
+	return &rule
+}
+
+func (s *Storage) UpdateRule(rule Rule) bool {
+	_, err := s.db.Exec(`
+		update rules set title = ?, enabled = ?, match = ?, actions = ? where id = ?`,
+		rule.Title, rule.Enabled, rule.Match, rule.Actions, rule.Id,
+	)
+	if err != nil {
+		log.Print(err)
+	}
+	return err == nil
+}
+
+func (s *Storage) DeleteRule(id int64) bool {
+	_, err := s.db.Exec(`delete from rules where id = ?`, id)
+	if err != nil {
+		log.Print(err)
+	}
+	return err == nil
+}
+
+func (s *Storage) GetRule(id int64) *Rule {
+	var r Rule
+	err := s.db.QueryRow(`
+		select id, title, enabled, match, actions from rules where id = ?
+	`, id).Scan(&r.Id, &r.Title, &r.Enabled, &r.Match, &r.Actions)
+	if err != nil {
+		if err != sql.ErrNoRows {
+			log.Print(err)
+		}
+		return nil
+	}
+	return &r
+}
+
+func (s *Storage) ListRules() []Rule {
+	result := make([]Rule, 0)
+	rows, err := s.db.Query(`select id, title, enabled, match, actions from rules order by id`)
+	if err != nil {
+		log.Print(err)
+		return result
+	}
+	for rows.Next() {
+		var r Rule
+		if err = rows.Scan(&r.Id, &r.Title, &r.Enabled, &r.Match, &r.Actions); err != nil {
+			log.Print(err)
+			return result
+		}
+		result = append(result, r)
+	}
+	return result
+}
+
+// Rules prepared for matching the items.
+type RuleSet struct {
+	rules []compiledRule
+}
+
+type compiledRule struct {
+	Rule
+	// nil if the rule applies to all the feeds
+	feeds      map[int64]bool
+	conditions []func(*ruleItem) bool
+}
+
+// Item along with the text of its content, extracted once needed.
+type ruleItem struct {
+	*Item
+	text *string
+}
+
+func (i *ruleItem) field(field RuleField) []string {
+	switch field {
+	case RuleFieldTitle:
+		return []string{i.Title}
+	case RuleFieldContent:
+		if i.text == nil {
+			text := htmlutil.ExtractText(i.Content)
+			i.text = &text
+		}
+		return []string{*i.text}
+	case RuleFieldAuthor:
+		return []string{i.Author}
+	case RuleFieldCategory:
+		return i.Categories
+	case RuleFieldLink:
+		return []string{i.Link}
+	}
+	return nil
+}
+
+// Prepare the given rules, along with the feeds of the folders they're limited to.
+// Invalid & disabled rules are skipped.
+func (s *Storage) NewRuleSet(rules []Rule) *RuleSet {
+	set := &RuleSet{}
+	var folderFeeds map[int64][]int64
+	for _, rule := range rules {
+		if !rule.Enabled {
+			continue
+		}
+		if err := rule.Validate(); err != nil {
+			log.Printf("Skipping rule %d: %s", rule.Id, err)
+			continue
+		}
+		compiled := compiledRule{Rule: rule}
+		if len(rule.Match.FeedIDs) > 0 || len(rule.Match.FolderIDs) > 0 {
+			compiled.feeds = make(map[int64]bool)
+			for _, id := range rule.Match.FeedIDs {
+				compiled.feeds[id] = true
+			}
+			if len(rule.Match.FolderIDs) > 0 && folderFeeds == nil {
+				folderFeeds = s.ListFolderFeedIDs()
+			}
+			for _, folderId := range rule.Match.FolderIDs {
+				for _, id := range folderFeeds[folderId] {
+					compiled.feeds[id] = true
+				}
+			}
+		}
+		for _, cond := range rule.Match.Conditions {
+			compiled.conditions = append(compiled.conditions, compileRuleCondition(cond))
+		}
+		set.rules = append(set.rules, compiled)
+	}
+	return set
+}
+
+// The enabled rules, ready to be applied.
+func (s *Storage) LoadRules() *RuleSet {
+	return s.NewRuleSet(s.ListRules())
+}
+
+func compileRuleCondition(cond RuleCondition) func(*ruleItem) bool {
+	var match func(string) bool
+	if cond.Regex {
+		re := regexp.MustCompile(cond.Value)
+		match = re.MatchString
+	} else {
+		keywords := make([]string, 0)
+		for _, keyword := range strings.Split(cond.Value, ",") {
+			if keyword = strings.ToLower(strings.TrimSpace(keyword)); keyword != "" {
+				keywords = append(keywords, keyword)
+			}
+		}
+		match = func(value string) bool {
+			value = strings.ToLower(value)
+			for _, keyword := range keywords {
+				if strings.Contains(value, keyword) {
+					return true
+				}
+			}
+			return false
+		}
+	}
+	return func(item *ruleItem) bool {
+		matched := false
+		for _, value := range item.field(cond.Field) {
+			if match(value) {
+				matched = true
+				break
+			}
+		}
+		return matched != cond.Negate
+	}
+}
+
+// Ids of the rules matching the item.
+func (set *RuleSet) Matching(item Item) []int64 {
+	result := make([]int64, 0)
+	ri := &ruleItem{Item: &item}
+	for _, rule := range set.rules {
+		if rule.matches(ri) {
+			result = append(result, rule.Id)
+		}
+	}
+	return result
+}
+
+func (r compiledRule) matches(item *ruleItem) bool {
+	if r.feeds != nil && !r.feeds[item.FeedId] {
+		return false
+	}
+	for _, cond := range r.conditions {
+		if !cond(item) {
+			return false
+		}
+	}
+	return true
+}
+
+// Apply the actions of the matching rules to the items. Returns the items to be stored.
+func (set *RuleSet) Apply(items []Item) []Item {
+	if len(set.rules) == 0 {
+		return items
+	}
+	result := make([]Item, 0, len(items))
+	for _, item := range items {
+		if set.apply(&item) {
+			result = append(result, item)
+		}
+	}
+	return result
+}
+
+// Apply the rules to the items of the feed that aren't stored yet.
+// The existing items are returned as is, the rules aren't run again on every refresh.
+func (s *Storage) ApplyRules(feedID int64, items []Item) []Item {
+	set := s.LoadRules()
+	if len(set.rules) == 0 {
+		return items
+	}
+	guids := make([]string, len(items))
+	for i, item := range items {
+		guids[i] = item.GUID
+	}
+	existing := s.ListExistingItemGUIDs(feedID, guids)
+	result := make([]Item, 0, len(items))
+	for _, item := range items {
+		if existing[item.GUID] || set.apply(&item) {
+			result = append(result, item)
+		}
+	}
+	return result
+}
+
+func (set *RuleSet) apply(item *Item) bool {
+	ri := &ruleItem{Item: item}
+	for _, rule := range set.rules {
+		if !rule.matches(ri) {
+			continue
+		}
+		actions := rule.Actions
+		if actions.Drop {
+			return false
+		}
+		if actions.Status != nil {
+			item.Status = *actions.Status
+		}
+		if actions.Priority != nil {
+			item.Priority = *actions.Priority
+		}
+		for _, tag := range actions.Tags {
+			found := false
+			for _, existing := range item.Tags {
+				found = found || existing == tag
+			}
+			if !found {
+				item.Tags = append(item.Tags, tag)
+			}
+		}
+	}
+	return true
+}
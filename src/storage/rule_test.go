@@ -0,0 +1,125 @@
+package storage
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestRules(t *testing.T) {
+	db := testDB()
+	folder := db.CreateFolder("folder", nil)
+	feed1 := db.CreateFeed("feed1", "", "", "http://example.com/feed1.xml", &folder.Id)
+	feed2 := db.CreateFeed("feed2", "", "", "http://example.com/feed2.xml", nil)
+	tag := db.CreateTag("go")
+
+	read, starred, priority := READ, STARRED, 5
+	rules := []Rule{
+		{
+			Title:   "drop ads",
+			Enabled: true,
+			Match:   RuleMatch{Conditions: []RuleCondition{{Field: RuleFieldTitle, Value: "sponsored, [ad]"}}},
+			Actions: RuleActions{Drop: true},
+		},
+		{
+			Title:   "golang",
+			Enabled: true,
+			Match: RuleMatch{
+				FolderIDs:  []int64{folder.Id},
+				Conditions: []RuleCondition{{Field: RuleFieldContent, Value: `(?i)\bgo(lang)?\b`, Regex: true}},
+			},
+			Actions: RuleActions{Status: &read, Tags: []int64{tag.Id}},
+		},
+		{
+			Title:   "important",
+			Enabled: true,
+			Match: RuleMatch{Conditions: []RuleCondition{
+				{Field: RuleFieldCategory, Value: "release"},
+				{Field: RuleFieldAuthor, Value: "bot", Negate: true},
+			}},
+			Actions: RuleActions{Status: &starred, Priority: &priority},
+		},
+		{
+			Title:   "disabled",
+			Enabled: false,
+			Actions: RuleActions{Drop: true},
+		},
+	}
+	for _, rule := range rules {
+		if err := rule.Validate(); err != nil {
+			t.Fatal(err)
+		}
+		if db.CreateRule(rule) == nil {
+			t.Fatal("expected a rule")
+		}
+	}
+	if have := db.ListRules(); len(have) != 4 || !reflect.DeepEqual(have[1].Match, rules[1].Match) {
+		t.Fatalf("invalid rules: %#v", have)
+	}
+
+	items := db.LoadRules().Apply([]Item{
+		{GUID: "ad", FeedId: feed1.Id, Title: "Sponsored: buy now"},
+		{GUID: "go", FeedId: feed1.Id, Title: "News", Content: "<p>Go 1.23 is out</p>", Categories: Categories{"release"}},
+		{GUID: "go-elsewhere", FeedId: feed2.Id, Title: "News", Content: "<p>Go 1.23 is out</p>"},
+		{GUID: "bot", FeedId: feed2.Id, Title: "v1.0", Author: "release-bot", Categories: Categories{"Release"}},
+		{GUID: "plain", FeedId: feed2.Id, Title: "Hello"},
+	})
+	db.CreateItems(items)
+
+	wantGuids := []string{"bot", "go", "go-elsewhere", "plain"}
+	if have := getItemGuids(db.ListItems(ItemFilter{}, 10, false, false)); !reflect.DeepEqual(have, wantGuids) {
+		t.Errorf("expected the item to be dropped, have: %#v", have)
+	}
+	have := db.GetItem(getItem(db, "go").Id)
+	if have.Status != STARRED || have.Priority != 5 || !reflect.DeepEqual(have.Tags, TagIDs{tag.Id}) {
+		t.Errorf("invalid item: %#v", have)
+	}
+	for _, guid := range []string{"go-elsewhere", "bot", "plain"} {
+		have := db.GetItem(getItem(db, guid).Id)
+		if have.Status != UNREAD || have.Priority != 0 || len(have.Tags) != 0 {
+			t.Errorf("expected %s to be untouched: %#v", guid, have)
+		}
+	}
+
+	minPriority := 1
+	if have := getItemGuids(db.ListItems(ItemFilter{MinPriority: &minPriority}, 10, false, false)); !reflect.DeepEqual(have, []string{"go"}) {
+		t.Errorf("expected the prioritized items only, have: %#v", have)
+	}
+	if count := db.CountItems(ItemFilter{MinPriority: &minPriority}); count != 1 {
+		t.Errorf("expected 1 prioritized item, have %d", count)
+	}
+
+	// the rules aren't run again for the stored items
+	items = db.ApplyRules(feed1.Id, []Item{
+		{GUID: "go", FeedId: feed1.Id, Title: "Sponsored", Content: "<p>Go 1.23 is out</p>"},
+		{GUID: "go-new", FeedId: feed1.Id, Title: "News", Content: "<p>Go 1.24 is out</p>"},
+		{GUID: "ad-new", FeedId: feed1.Id, Title: "Sponsored"},
+	})
+	if have := getItemGuids(items); !reflect.DeepEqual(have, []string{"go", "go-new"}) {
+		t.Fatalf("invalid items: %#v", have)
+	}
+	if items[0].Status != UNREAD || len(items[0].Tags) != 0 || items[1].Status != READ || len(items[1].Tags) != 1 {
+		t.Errorf("expected the rules to be applied to the new items only: %#v", items)
+	}
+
+	db.DeleteRule(db.ListRules()[0].Id)
+	if have := db.LoadRules().Matching(Item{FeedId: feed2.Id, Title: "[AD] sale"}); len(have) != 0 {
+		t.Errorf("expected no matching rules, have: %#v", have)
+	}
+}
+
+func TestRuleValidate(t *testing.T) {
+	unread := UNREAD
+	invalid := []Rule{
+		{Actions: RuleActions{Drop: true}},
+		{Title: "no actions"},
+		{Title: "unread", Actions: RuleActions{Status: &unread}},
+		{Title: "field", Match: RuleMatch{Conditions: []RuleCondition{{Field: "date", Value: "x"}}}, Actions: RuleActions{Drop: true}},
+		{Title: "value", Match: RuleMatch{Conditions: []RuleCondition{{Field: RuleFieldTitle, Value: " "}}}, Actions: RuleActions{Drop: true}},
+		{Title: "regex", Match: RuleMatch{Conditions: []RuleCondition{{Field: RuleFieldTitle, Value: "(", Regex: true}}}, Actions: RuleActions{Drop: true}},
+	}
+	for _, rule := range invalid {
+		if rule.Validate() == nil {
+			t.Errorf("expected an error: %#v", rule)
+		}
+	}
+}
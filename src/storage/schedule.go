@@ -0,0 +1,198 @@
+package storage
+
+import (
+	"database/sql"
+	"log"
+	"time"
+)
+
+// Number of the most recent items used to estimate the posting frequency.
+var postIntervalSampleSize = 10
+
+type FeedSchedule struct {
+	FeedID    int64
+	LastCheck time.Time
+	// average interval between the recent posts, nil if unknown
+	PostInterval *time.Duration
+	// publisher hints: the feed should not be checked before this time,
+	// nor during the hours & days set in the bitmasks
+	NextCheck *time.Time
+	skipHours int64
+	skipDays  int64
+	// time taken by the last fetch of the feed
+	FetchDuration *time.Duration
+	// number of the consecutive failed fetches & the time of the first of them
+	Failures     int
+	FailingSince *time.Time
+}
+
+const (
+	allHours = 1<<24 - 1
+	allDays  = 1<<7 - 1
+)
+
+// Whether the publisher asked not to check the feed at the given time.
+// The hints which would stop the checks altogether are ignored.
+func (s FeedSchedule) Skips(t time.Time) bool {
+	t = t.UTC()
+	skipHour := s.skipHours != allHours && s.skipHours&(1<<t.Hour()) != 0
+	skipDay := s.skipDays != allDays && s.skipDays&(1<<t.Weekday()) != 0
+	return skipHour || skipDay
+}
+
+const feedScheduleColumns = `
+	feed_id, last_check, post_interval, next_check, skip_hours, skip_days, fetch_duration,
+	failures, failing_since
+`
+
+func scanFeedSchedule(row interface{ Scan(...any) error }) (*FeedSchedule, error) {
+	var schedule FeedSchedule
+	var postInterval, fetchDuration *int64
+	err := row.Scan(
+		&schedule.FeedID, &schedule.LastCheck, &postInterval,
+		&schedule.NextCheck, &schedule.skipHours, &schedule.skipDays, &fetchDuration,
+		&schedule.Failures, &schedule.FailingSince,
+	)
+	if err != nil {
+		return nil, err
+	}
+	if postInterval != nil {
+		interval := time.Duration(*postInterval) * time.Second
+		schedule.PostInterval = &interval
+	}
+	if fetchDuration != nil {
+		duration := time.Duration(*fetchDuration) * time.Millisecond
+		schedule.FetchDuration = &duration
+	}
+	return &schedule, nil
+}
+
+func (s *Storage) ListFeedSchedules() map[int64]FeedSchedule {
+	result := make(map[int64]FeedSchedule)
+	rows, err := s.db.Query(`select ` + feedScheduleColumns + ` from feed_schedules`)
+	if err != nil {
+		log.Print(err)
+		return result
+	}
+	for rows.Next() {
+		schedule, err := scanFeedSchedule(rows)
+		if err != nil {
+			log.Print(err)
+			return result
+		}
+		result[schedule.FeedID] = *schedule
+	}
+	return result
+}
+
+func (s *Storage) GetFeedSchedule(feedID int64) *FeedSchedule {
+	row := s.db.QueryRow(`select `+feedScheduleColumns+` from feed_schedules where feed_id = ?`, feedID)
+	schedule, err := scanFeedSchedule(row)
+	if err != nil {
+		if err != sql.ErrNoRows {
+			log.Print(err)
+		}
+		return nil
+	}
+	return schedule
+}
+
+// Record the check of the feed along with its current posting frequency.
+func (s *Storage) SetFeedChecked(feedID int64) {
+	now := time.Now().UTC()
+
+	var postInterval *int64
+	if interval := s.feedPostInterval(feedID, now); interval != nil {
+		seconds := int64(interval.Seconds())
+		postInterval = &seconds
+	}
+	_, err := s.db.Exec(`
+		insert into feed_schedules (feed_id, last_check, post_interval)
+		values (?, ?, ?)
+		on conflict (feed_id) do update set
+			last_check = excluded.last_check,
+			post_interval = excluded.post_interval`,
+		feedID, now, postInterval,
+	)
+	if err != nil {
+		log.Print(err)
+	}
+}
+
+func (s *Storage) SetFeedFetchDuration(feedID int64, duration time.Duration) {
+	_, err := s.db.Exec(`
+		update feed_schedules set fetch_duration = ? where feed_id = ?`,
+		duration.Milliseconds(), feedID,
+	)
+	if err != nil {
+		log.Print(err)
+	}
+}
+
+// Set the time before which the feed should not be checked, nil to lift the restriction.
+func (s *Storage) SetFeedNextCheck(feedID int64, nextCheck *time.Time) {
+	if nextCheck != nil {
+		utc := nextCheck.UTC()
+		nextCheck = &utc
+	}
+	_, err := s.db.Exec(`
+		insert into feed_schedules (feed_id, last_check, next_check)
+		values (?, ?, ?)
+		on conflict (feed_id) do update set next_check = excluded.next_check`,
+		feedID, time.Now().UTC(), nextCheck,
+	)
+	if err != nil {
+		log.Print(err)
+	}
+}
+
+// Set the hours (in UTC) & days during which the feed should not be checked.
+func (s *Storage) SetFeedSkipTimes(feedID int64, hours []int, days []time.Weekday) {
+	var skipHours, skipDays int64
+	for _, hour := range hours {
+		skipHours |= 1 << hour
+	}
+	for _, day := range days {
+		skipDays |= 1 << day
+	}
+	_, err := s.db.Exec(`
+		insert into feed_schedules (feed_id, last_check, skip_hours, skip_days)
+		values (?, ?, ?, ?)
+		on conflict (feed_id) do update set
+			skip_hours = excluded.skip_hours,
+			skip_days = excluded.skip_days`,
+		feedID, time.Now().UTC(), skipHours, skipDays,
+	)
+	if err != nil {
+		log.Print(err)
+	}
+}
+
+// Estimate the interval between the posts of the feed from the dates of its recent items.
+// The time since the last post counts too, so that the feeds which went quiet slow down.
+func (s *Storage) feedPostInterval(feedID int64, now time.Time) *time.Duration {
+	rows, err := s.db.Query(`
+		select date from items
+		where feed_id = ? and date <= ? and date > '1970'
+		order by date desc
+		limit ?
+	`, feedID, now, postIntervalSampleSize)
+	if err != nil {
+		log.Print(err)
+		return nil
+	}
+	dates := make([]time.Time, 0)
+	for rows.Next() {
+		var date time.Time
+		if err = rows.Scan(&date); err != nil {
+			log.Print(err)
+			return nil
+		}
+		dates = append(dates, date)
+	}
+	if len(dates) < 2 {
+		return nil
+	}
+	interval := now.Sub(dates[len(dates)-1]) / time.Duration(len(dates))
+	return &interval
+}
@@ -0,0 +1,150 @@
+package storage
+
+import (
+	"html"
+	"strings"
+	"unicode"
+)
+
+// Markers wrapping the matched terms in snippets & highlights.
+// Replaced by <mark> tags once the text is html-escaped.
+const (
+	searchMarkOpen  = "\x02"
+	searchMarkClose = "\x03"
+)
+
+var searchColumns = map[string]string{
+	"title":   "title",
+	"content": "content",
+	"text":    "content",
+}
+
+type searchQuery struct {
+	// full-text query matching the items
+	match string
+	// full-text query matching the items to be excluded
+	exclude string
+	// feed titles the items must belong to
+	feeds []string
+}
+
+// Convert the user input into a full-text query.
+//
+// Supported syntax:
+//   - `word` matches words starting with `word`
+//   - `"some phrase"` matches the exact phrase
+//   - `-word`, `-"some phrase"` excludes the matching items
+//   - `word1 OR word2` matches either of the words
+//   - `title:word`, `content:word` match the word in the given field only
+//   - `feed:name` matches items of the feeds with `name` in the title
+//
+// The output is compatible with both FTS4 (enhanced query syntax) & FTS5.
+func parseSearchQuery(input string) searchQuery {
+	query := searchQuery{}
+	match := make([]string, 0)
+	exclude := make([]string, 0)
+
+	for _, token := range searchTokens(input) {
+		if token == "OR" {
+			if len(match) > 0 && match[len(match)-1] != "OR" {
+				match = append(match, token)
+			}
+			continue
+		}
+
+		negate := false
+		if strings.HasPrefix(token, "-") {
+			negate = true
+			token = token[1:]
+		}
+
+		column := ""
+		if pos := strings.IndexRune(token, ':'); pos != -1 {
+			prefix := strings.ToLower(token[:pos])
+			if prefix == "feed" {
+				if feed := strings.Trim(token[pos+1:], `"`); feed != "" && !negate {
+					query.feeds = append(query.feeds, feed)
+				}
+				continue
+			}
+			if col, ok := searchColumns[prefix]; ok {
+				column = col + ":"
+				token = token[pos+1:]
+			}
+		}
+
+		var terms []string
+		if len(token) > 1 && strings.HasPrefix(token, `"`) && strings.HasSuffix(token, `"`) {
+			if words := searchWords(token); len(words) > 0 {
+				terms = []string{column + `"` + strings.Join(words, " ") + `"`}
+			}
+		} else {
+			for _, word := range searchWords(token) {
+				terms = append(terms, column+word+"*")
+			}
+		}
+		if len(terms) == 0 {
+			continue
+		}
+
+		if negate {
+			exclude = append(exclude, terms...)
+		} else {
+			match = append(match, terms...)
+		}
+	}
+	if len(match) > 0 && match[len(match)-1] == "OR" {
+		match = match[:len(match)-1]
+	}
+
+	query.match = strings.Join(match, " ")
+	query.exclude = strings.Join(exclude, " OR ")
+	return query
+}
+
+// Split the input by whitespace, keeping the quoted phrases intact.
+func searchTokens(input string) []string {
+	tokens := make([]string, 0)
+	var token strings.Builder
+	quoted := false
+	for _, r := range input {
+		switch {
+		case r == '"':
+			quoted = !quoted
+			token.WriteRune(r)
+		case unicode.IsSpace(r) && !quoted:
+			if token.Len() > 0 {
+				tokens = append(tokens, token.String())
+				token.Reset()
+			}
+		default:
+			token.WriteRune(r)
+		}
+	}
+	if token.Len() > 0 {
+		tokens = append(tokens, token.String())
+	}
+	return tokens
+}
+
+// Split the text into words recognized as barewords by the full-text engine.
+// Operator keywords are lowercased to be matched as regular words.
+func searchWords(text string) []string {
+	words := strings.FieldsFunc(text, func(r rune) bool {
+		return r < 128 && !unicode.IsLetter(r) && !unicode.IsDigit(r) && r != '_'
+	})
+	for i, word := range words {
+		switch word {
+		case "AND", "OR", "NOT", "NEAR":
+			words[i] = strings.ToLower(word)
+		}
+	}
+	return words
+}
+
+func searchHighlightHTML(text string) string {
+	text = html.EscapeString(text)
+	text = strings.ReplaceAll(text, searchMarkOpen, "<mark>")
+	text = strings.ReplaceAll(text, searchMarkClose, "</mark>")
+	return text
+}
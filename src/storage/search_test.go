@@ -0,0 +1,110 @@
+package storage
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseSearchQuery(t *testing.T) {
+	tests := []struct {
+		input string
+		want  searchQuery
+	}{
+		{"foo bar", searchQuery{match: "foo* bar*"}},
+		{`"foo bar" baz`, searchQuery{match: `"foo bar" baz*`}},
+		{"foo OR bar", searchQuery{match: "foo* OR bar*"}},
+		{"OR foo OR OR bar OR", searchQuery{match: "foo* OR bar*"}},
+		{"foo -bar -\"baz qux\"", searchQuery{match: "foo*", exclude: `bar* OR "baz qux"`}},
+		{"title:foo content:\"bar baz\"", searchQuery{match: `title:foo* content:"bar baz"`}},
+		{"feed:news feed:\"hacker news\" foo", searchQuery{match: "foo*", feeds: []string{"news", "hacker news"}}},
+		{"unknown:foo", searchQuery{match: "unknown* foo*"}},
+		{"c++ AND node.js", searchQuery{match: "c* and* node* js*"}},
+		{"-foo", searchQuery{exclude: "foo*"}},
+		{`"" * -`, searchQuery{}},
+	}
+	for _, test := range tests {
+		have := parseSearchQuery(test.input)
+		if !reflect.DeepEqual(have, test.want) {
+			t.Errorf("parseSearchQuery(%q)\nwant: %#v\nhave: %#v", test.input, test.want, have)
+		}
+	}
+}
+
+func TestListItemsSearch(t *testing.T) {
+	db := testDB()
+	scope := testItemsSetup(db)
+	db.db.Exec(`update items set title = 'linux kernel' where guid = 'item111'`)
+	db.db.Exec(`update items set title = 'kernel panic', content = 'the linux kernel' where guid = 'item121'`)
+	db.db.Exec(`update items set title = 'windows kernel' where guid = 'item211'`)
+	db.SyncSearch()
+
+	search := func(query string) []string {
+		items := db.ListItems(ItemFilter{Search: &query}, 10, false, false)
+		guids := getItemGuids(items)
+		if db.fts5 {
+			// relevance order is not checked, only the match
+			guids = getItemGuids(db.ListItems(ItemFilter{Search: &query, IDs: itemIds(items)}, 10, false, false))
+		}
+		return guids
+	}
+
+	tests := []struct {
+		query string
+		want  []string
+	}{
+		{"kern", []string{"item111", "item121", "item211"}},
+		{"kernel -windows", []string{"item111", "item121"}},
+		{"title:linux", []string{"item111"}},
+		{"linux OR windows", []string{"item111", "item121", "item211"}},
+		{`"linux kernel"`, []string{"item111", "item121"}},
+		{"kernel feed:feed1", []string{"item111", "item121"}},
+	}
+	for _, test := range tests {
+		if have := search(test.query); !reflect.DeepEqual(have, test.want) {
+			t.Errorf("search %q\nwant: %#v\nhave: %#v", test.query, test.want, have)
+		}
+	}
+
+	if count := db.CountItems(ItemFilter{Search: &tests[1].query, FolderID: &scope.folder1.Id}); count != 2 {
+		t.Errorf("invalid search count: %d", count)
+	}
+}
+
+func TestListItemsSearchRanked(t *testing.T) {
+	db := testDB()
+	if !db.fts5 {
+		t.Skip("fts5 is not available")
+	}
+	testItemsSetup(db)
+	db.db.Exec(`update items set content = 'linux' where guid = 'item111'`)
+	db.db.Exec(`update items set title = 'linux & linux' where guid = 'item121'`)
+	db.db.Exec(`update items set content = 'linux linux linux' where guid = 'item211'`)
+	db.SyncSearch()
+
+	query := "linux"
+	items := db.ListItems(ItemFilter{Search: &query}, 10, false, true)
+	want := []string{"item121", "item211", "item111"}
+	if have := getItemGuids(items); !reflect.DeepEqual(have, want) {
+		t.Fatalf("invalid order\nwant: %#v\nhave: %#v", want, have)
+	}
+	if items[0].Highlight == nil || *items[0].Highlight != "<mark>linux</mark> &amp; <mark>linux</mark>" {
+		t.Errorf("invalid highlight: %#v", items[0].Highlight)
+	}
+	if items[2].Snippet == nil || *items[2].Snippet != "<mark>linux</mark>" {
+		t.Errorf("invalid snippet: %#v", items[2].Snippet)
+	}
+
+	// paginated
+	have := getItemGuids(db.ListItems(ItemFilter{Search: &query, After: &items[0].Id}, 1, false, false))
+	if !reflect.DeepEqual(have, want[1:2]) {
+		t.Errorf("invalid page\nwant: %#v\nhave: %#v", want[1:2], have)
+	}
+}
+
+func itemIds(items []Item) *[]int64 {
+	ids := make([]int64, len(items))
+	for i, item := range items {
+		ids[i] = item.Id
+	}
+	return &ids
+}
@@ -0,0 +1,63 @@
+package storage
+
+import (
+	"database/sql"
+	"database/sql/driver"
+	"encoding/json"
+	"log"
+)
+
+// Css selectors of the items on the page of the scraped feed,
+// which is fetched like the regular ones and turned into the items (see `parser.ParseHTML`).
+type FeedSelectors struct {
+	Item    string `json:"item"`
+	Title   string `json:"title,omitempty"`
+	Link    string `json:"link,omitempty"`
+	Date    string `json:"date,omitempty"`
+	Content string `json:"content,omitempty"`
+}
+
+func (f *FeedSelectors) Scan(src any) error {
+	switch data := src.(type) {
+	case []byte:
+		return json.Unmarshal(data, f)
+	case string:
+		return json.Unmarshal([]byte(data), f)
+	default:
+		return nil
+	}
+}
+
+func (f FeedSelectors) Value() (driver.Value, error) {
+	return json.Marshal(f)
+}
+
+func (s *Storage) GetFeedSelectors(feedID int64) *FeedSelectors {
+	var selectors FeedSelectors
+	err := s.db.QueryRow(`select selectors from feed_selectors where feed_id = ?`, feedID).Scan(&selectors)
+	if err != nil {
+		if err != sql.ErrNoRows {
+			log.Print(err)
+		}
+		return nil
+	}
+	return &selectors
+}
+
+// Set the selectors of the scraped feed, nil to turn it into a regular feed.
+func (s *Storage) UpdateFeedSelectors(feedID int64, selectors *FeedSelectors) bool {
+	var err error
+	if selectors == nil {
+		_, err = s.db.Exec(`delete from feed_selectors where feed_id = ?`, feedID)
+	} else {
+		_, err = s.db.Exec(`
+			insert into feed_selectors (feed_id, selectors) values (?, ?)
+			on conflict (feed_id) do update set selectors = excluded.selectors`,
+			feedID, *selectors,
+		)
+	}
+	if err != nil {
+		log.Print(err)
+	}
+	return err == nil
+}
@@ -16,6 +16,10 @@ func settingsDefaults() map[string]interface{} {
 		"theme_font":        "",
 		"theme_size":        1,
 		"refresh_rate":      0,
+		// mark read articles as unread when the feed publishes an updated version
+		"unread_on_update": false,
+		// pause the feeds failing to refresh for the number of days, 0 to disable
+		"auto_pause_days": 30,
 		// Legacy AI settings (kept for backward compatibility)
 		"ai_provider":    "disabled",
 		"gemini_api_key": "",
@@ -0,0 +1,197 @@
+package storage
+
+import (
+	"database/sql"
+	"database/sql/driver"
+	"encoding/json"
+	"fmt"
+	"log"
+	"time"
+)
+
+// Smart feed is a saved item filter displayed as a virtual feed.
+type SmartFeed struct {
+	Id     int64           `json:"id"`
+	Title  string          `json:"title"`
+	Filter SmartFeedFilter `json:"filter"`
+}
+
+type SmartFeedFilter struct {
+	Search    *string     `json:"search,omitempty"`
+	Status    *ItemStatus `json:"status,omitempty"`
+	FeedIDs   []int64     `json:"feed_ids,omitempty"`
+	FolderIDs []int64     `json:"folder_ids,omitempty"`
+	Tags      []int64     `json:"tags,omitempty"`
+	// only items published within the last N days
+	Days int `json:"days,omitempty"`
+}
+
+func (f *SmartFeedFilter) Scan(src any) error {
+	switch data := src.(type) {
+	case []byte:
+		return json.Unmarshal(data, f)
+	case string:
+		return json.Unmarshal([]byte(data), f)
+	default:
+		return nil
+	}
+}
+
+func (f SmartFeedFilter) Value() (driver.Value, error) {
+	return json.Marshal(f)
+}
+
+func (f SmartFeedFilter) ItemFilter() ItemFilter {
+	filter := ItemFilter{
+		Search: f.Search,
+		Status: f.Status,
+	}
+	if len(f.FeedIDs) > 0 {
+		filter.FeedIDs = &f.FeedIDs
+	}
+	if len(f.FolderIDs) > 0 {
+		filter.FolderIDs = &f.FolderIDs
+	}
+	if len(f.Tags) > 0 {
+		filter.Tags = &f.Tags
+	}
+	if f.Days > 0 {
+		since := time.Now().UTC().Add(-time.Hour * time.Duration(24*f.Days))
+		filter.Since = &since
+	}
+	return filter
+}
+
+func (s *Storage) CreateSmartFeed(title string, filter SmartFeedFilter) *SmartFeed {
+	row := s.db.QueryRow(`
+		insert into smart_feeds (title, filter) values (?, ?)
+		returning id`,
+		title, filter,
+	)
+	var id int64
+	if err := row.Scan(&id); err != nil {
+		log.Print(err)
+		return nil
+	}
+	return &SmartFeed{Id: id, Title: title, Filter: filter}
+}
+
+func (s *Storage) RenameSmartFeed(id int64, newTitle string) bool {
+	_, err := s.db.Exec(`update smart_feeds set title = ? where id = ?`, newTitle, id)
+	return err == nil
+}
+
+func (s *Storage) UpdateSmartFeedFilter(id int64, filter SmartFeedFilter) bool {
+	_, err := s.db.Exec(`update smart_feeds set filter = ? where id = ?`, filter, id)
+	return err == nil
+}
+
+func (s *Storage) DeleteSmartFeed(id int64) bool {
+	_, err := s.db.Exec(`delete from smart_feeds where id = ?`, id)
+	if err != nil {
+		log.Print(err)
+	}
+	return err == nil
+}
+
+func (s *Storage) GetSmartFeed(id int64) *SmartFeed {
+	var f SmartFeed
+	err := s.db.QueryRow(`
+		select id, title, filter from smart_feeds where id = ?
+	`, id).Scan(&f.Id, &f.Title, &f.Filter)
+	if err != nil {
+		if err != sql.ErrNoRows {
+			log.Print(err)
+		}
+		return nil
+	}
+	return &f
+}
+
+func (s *Storage) ListSmartFeeds() []SmartFeed {
+	result := make([]SmartFeed, 0)
+	rows, err := s.db.Query(`
+		select id, title, filter
+		from smart_feeds
+		order by title collate nocase
+	`)
+	if err != nil {
+		log.Print(err)
+		return result
+	}
+	for rows.Next() {
+		var f SmartFeed
+		if err = rows.Scan(&f.Id, &f.Title, &f.Filter); err != nil {
+			log.Print(err)
+			return result
+		}
+		result = append(result, f)
+	}
+	return result
+}
+
+func (s *Storage) MarkSmartFeedRead(id int64, before *time.Time) bool {
+	smartFeed := s.GetSmartFeed(id)
+	if smartFeed == nil {
+		return false
+	}
+	filter := smartFeed.Filter.ItemFilter()
+	filter.Before = before
+	return s.markItemsRead(filter)
+}
+
+// List ids of the feeds having items matching the smart feed.
+func (s *Storage) ListSmartFeedFeedIDs(id int64) []int64 {
+	result := make([]int64, 0)
+	smartFeed := s.GetSmartFeed(id)
+	if smartFeed == nil {
+		return result
+	}
+	predicate, args := listQueryPredicate(smartFeed.Filter.ItemFilter(), false)
+	rows, err := s.db.Query(fmt.Sprintf(`
+		select distinct i.feed_id
+		from items i
+		where %s
+		order by i.feed_id
+	`, predicate), args...)
+	if err != nil {
+		log.Print(err)
+		return result
+	}
+	for rows.Next() {
+		var feedId int64
+		if err = rows.Scan(&feedId); err != nil {
+			log.Print(err)
+			return result
+		}
+		result = append(result, feedId)
+	}
+	return result
+}
+
+type SmartFeedStat struct {
+	SmartFeedId  int64 `json:"smartfeed_id"`
+	UnreadCount  int64 `json:"unread"`
+	StarredCount int64 `json:"starred"`
+}
+
+func (s *Storage) SmartFeedStats() []SmartFeedStat {
+	result := make([]SmartFeedStat, 0)
+	for _, smartFeed := range s.ListSmartFeeds() {
+		predicate, args := listQueryPredicate(smartFeed.Filter.ItemFilter(), false)
+		stat := SmartFeedStat{SmartFeedId: smartFeed.Id}
+		err := s.db.QueryRow(fmt.Sprintf(`
+			select
+				coalesce(sum(case i.status when %d then 1 else 0 end), 0),
+				coalesce(sum(case i.status when %d then 1 else 0 end), 0)
+			from items i
+			where %s
+		`, UNREAD, STARRED, predicate), args...).Scan(&stat.UnreadCount, &stat.StarredCount)
+		if err != nil {
+			log.Print(err)
+			continue
+		}
+		result = append(result, stat)
+	}
+	return result
+}
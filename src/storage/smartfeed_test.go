@@ -0,0 +1,58 @@
+package storage
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestSmartFeeds(t *testing.T) {
+	db := testDB()
+	scope := testItemsSetup(db)
+
+	unread := UNREAD
+	smartFeed1 := db.CreateSmartFeed("unread", SmartFeedFilter{
+		Status:    &unread,
+		FeedIDs:   []int64{scope.feed01.Id},
+		FolderIDs: []int64{scope.folder1.Id},
+	})
+	smartFeed2 := db.CreateSmartFeed("recent", SmartFeedFilter{Days: 1})
+	if smartFeed1 == nil || smartFeed2 == nil {
+		t.Fatal("expected smart feeds")
+	}
+	if have := db.GetSmartFeed(smartFeed1.Id); !reflect.DeepEqual(have, smartFeed1) {
+		t.Fatalf("invalid smart feed\nwant: %#v\nhave: %#v", smartFeed1, have)
+	}
+
+	have := getItemGuids(db.ListItems(smartFeed1.Filter.ItemFilter(), 10, false, false))
+	want := []string{"item111", "item121", "item011"}
+	if !reflect.DeepEqual(have, want) {
+		t.Logf("want: %#v", want)
+		t.Logf("have: %#v", have)
+		t.Fail()
+	}
+
+	// all test items are dated in the future
+	db.db.Exec(`update items set date = date('now', '-2 days') where guid = 'item011'`)
+	wantStats := []SmartFeedStat{
+		{SmartFeedId: smartFeed2.Id, UnreadCount: 2, StarredCount: 3},
+		{SmartFeedId: smartFeed1.Id, UnreadCount: 3, StarredCount: 0},
+	}
+	if haveStats := db.SmartFeedStats(); !reflect.DeepEqual(haveStats, wantStats) {
+		t.Fatalf("invalid stats\nwant: %#v\nhave: %#v", wantStats, haveStats)
+	}
+
+	feedIds := db.ListSmartFeedFeedIDs(smartFeed1.Id)
+	if !reflect.DeepEqual(feedIds, []int64{scope.feed11.Id, scope.feed12.Id, scope.feed01.Id}) {
+		t.Errorf("invalid smart feed feeds: %#v", feedIds)
+	}
+
+	db.MarkSmartFeedRead(smartFeed1.Id, nil)
+	if count := db.CountItems(ItemFilter{Status: &unread}); count != 0 {
+		t.Errorf("expected no unread items, got %d", count)
+	}
+
+	db.DeleteSmartFeed(smartFeed1.Id)
+	if smartFeeds := db.ListSmartFeeds(); len(smartFeeds) != 1 || smartFeeds[0].Id != smartFeed2.Id {
+		t.Errorf("invalid smart feed list: %#v", smartFeeds)
+	}
+}
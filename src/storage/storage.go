@@ -2,14 +2,28 @@ package storage
 
 import (
 	"database/sql"
+	"errors"
 	"log"
 	"strings"
 
-	_ "github.com/mattn/go-sqlite3"
+	"github.com/mattn/go-sqlite3"
 )
 
+// Reasons of the failed updates, for the api to report.
+var (
+	ErrNotFound = errors.New("not found")
+	ErrConflict = errors.New("conflict")
+)
+
+// Check whether the statement failed because of a unique index.
+func isUniqueViolation(err error) bool {
+	var sqliteErr sqlite3.Error
+	return errors.As(err, &sqliteErr) && sqliteErr.ExtendedCode == sqlite3.ErrConstraintUnique
+}
+
 type Storage struct {
-	db *sql.DB
+	db   *sql.DB
+	fts5 bool
 }
 
 func New(path string) (*Storage, error) {
@@ -27,5 +41,9 @@ func New(path string) (*Storage, error) {
 	if err = migrate(db); err != nil {
 		return nil, err
 	}
-	return &Storage{db: db}, nil
+	fts5, err := migrateSearchFTS5(db)
+	if err != nil {
+		return nil, err
+	}
+	return &Storage{db: db, fts5: fts5}, nil
 }
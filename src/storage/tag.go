@@ -0,0 +1,133 @@
+package storage
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"log"
+)
+
+type Tag struct {
+	Id    int64  `json:"id"`
+	Title string `json:"title"`
+}
+
+type TagIDs []int64
+
+func (t *TagIDs) Scan(src any) error {
+	switch data := src.(type) {
+	case []byte:
+		return json.Unmarshal(data, t)
+	case string:
+		return json.Unmarshal([]byte(data), t)
+	default:
+		return nil
+	}
+}
+
+func (t TagIDs) Value() (driver.Value, error) {
+	return json.Marshal(t)
+}
+
+func (s *Storage) CreateTag(title string) *Tag {
+	row := s.db.QueryRow(`
+		insert into tags (title) values (?)
+		on conflict (title) do update set title = ?
+		returning id`,
+		title, title,
+	)
+	var id int64
+	if err := row.Scan(&id); err != nil {
+		log.Print(err)
+		return nil
+	}
+	return &Tag{Id: id, Title: title}
+}
+
+// Fails with ErrConflict if another tag has the title already.
+func (s *Storage) RenameTag(tagId int64, newTitle string) error {
+	result, err := s.db.Exec(`update tags set title = ? where id = ?`, newTitle, tagId)
+	if isUniqueViolation(err) {
+		return ErrConflict
+	}
+	if err != nil {
+		log.Print(err)
+		return err
+	}
+	if updated, _ := result.RowsAffected(); updated == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (s *Storage) DeleteTag(tagId int64) bool {
+	tx, err := s.db.Begin()
+	if err != nil {
+		log.Print(err)
+		return false
+	}
+	defer tx.Rollback()
+
+	if _, err = tx.Exec(`delete from item_tags where tag_id = ?`, tagId); err != nil {
+		log.Print(err)
+		return false
+	}
+	if _, err = tx.Exec(`delete from tags where id = ?`, tagId); err != nil {
+		log.Print(err)
+		return false
+	}
+	if err = tx.Commit(); err != nil {
+		log.Print(err)
+		return false
+	}
+	return true
+}
+
+func (s *Storage) ListTags() []Tag {
+	result := make([]Tag, 0)
+	rows, err := s.db.Query(`select id, title from tags order by title collate nocase`)
+	if err != nil {
+		log.Print(err)
+		return result
+	}
+	for rows.Next() {
+		var t Tag
+		if err = rows.Scan(&t.Id, &t.Title); err != nil {
+			log.Print(err)
+			return result
+		}
+		result = append(result, t)
+	}
+	return result
+}
+
+// Replace the tags of the item with the given ones.
+func (s *Storage) SetItemTags(itemId int64, tagIds []int64) bool {
+	tx, err := s.db.Begin()
+	if err != nil {
+		log.Print(err)
+		return false
+	}
+	defer tx.Rollback()
+
+	if _, err = tx.Exec(`delete from item_tags where item_id = ?`, itemId); err != nil {
+		log.Print(err)
+		return false
+	}
+	for _, tagId := range tagIds {
+		_, err = tx.Exec(`
+			insert into item_tags (item_id, tag_id)
+			select ?, id from tags where id = ?
+			on conflict do nothing`,
+			itemId, tagId,
+		)
+		if err != nil {
+			log.Print(err)
+			return false
+		}
+	}
+	if err = tx.Commit(); err != nil {
+		log.Print(err)
+		return false
+	}
+	return true
+}
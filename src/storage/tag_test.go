@@ -0,0 +1,63 @@
+package storage
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestItemTags(t *testing.T) {
+	db := testDB()
+	testItemsSetup(db)
+
+	tag1 := db.CreateTag("tag1")
+	tag2 := db.CreateTag("tag2")
+	if tag1 == nil || tag2 == nil {
+		t.Fatal("expected tags")
+	}
+	if tag := db.CreateTag("tag1"); tag == nil || tag.Id != tag1.Id {
+		t.Fatalf("expected the same tag.\nwant: %#v\nhave: %#v", tag1, tag)
+	}
+
+	item111 := getItem(db, "item111")
+	item121 := getItem(db, "item121")
+	item212 := getItem(db, "item212")
+	db.SetItemTags(item111.Id, []int64{tag1.Id, tag2.Id})
+	db.SetItemTags(item121.Id, []int64{tag1.Id})
+	db.SetItemTags(item212.Id, []int64{tag2.Id, 100500})
+
+	if have := db.GetItem(item111.Id).Tags; !reflect.DeepEqual(have, TagIDs{tag1.Id, tag2.Id}) {
+		t.Errorf("invalid item tags: %#v", have)
+	}
+	if have := db.GetItem(item212.Id).Tags; !reflect.DeepEqual(have, TagIDs{tag2.Id}) {
+		t.Errorf("invalid item tags: %#v", have)
+	}
+
+	have := getItemGuids(db.ListItems(ItemFilter{Tags: &[]int64{tag1.Id}}, 10, false, false))
+	want := []string{"item111", "item121"}
+	if !reflect.DeepEqual(have, want) {
+		t.Logf("want: %#v", want)
+		t.Logf("have: %#v", have)
+		t.Fail()
+	}
+	if count := db.CountItems(ItemFilter{Tags: &[]int64{tag2.Id}}); count != 2 {
+		t.Errorf("invalid tagged items count: %d", count)
+	}
+
+	var read ItemStatus = READ
+	db.MarkItemsRead(MarkFilter{Tags: &[]int64{tag2.Id}})
+	have = getItemGuids(db.ListItems(ItemFilter{Status: &read, Tags: &[]int64{tag1.Id, tag2.Id}}, 10, false, false))
+	want = []string{"item111"}
+	if !reflect.DeepEqual(have, want) {
+		t.Logf("want: %#v", want)
+		t.Logf("have: %#v", have)
+		t.Fail()
+	}
+
+	db.DeleteTag(tag2.Id)
+	if tags := db.ListTags(); !reflect.DeepEqual(tags, []Tag{*tag1}) {
+		t.Errorf("invalid tag list: %#v", tags)
+	}
+	if have := db.GetItem(item111.Id).Tags; !reflect.DeepEqual(have, TagIDs{tag1.Id}) {
+		t.Errorf("invalid item tags after deletion: %#v", have)
+	}
+}
@@ -0,0 +1,333 @@
+package storage
+
+import (
+	"database/sql"
+	"database/sql/driver"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/nkanaev/yarr/src/content/htmlutil"
+)
+
+// Events the webhooks are notified of.
+const (
+	EventItemNew     = "item.new"
+	EventItemStarred = "item.starred"
+	EventFeedFailed  = "feed.failed"
+	EventRefreshDone = "refresh.done"
+)
+
+var webhookEvents = map[string]bool{
+	EventItemNew:     true,
+	EventItemStarred: true,
+	EventFeedFailed:  true,
+	EventRefreshDone: true,
+}
+
+// Number of the most recent deliveries kept in the log of each webhook.
+var webhookDeliveryLogSize = 100
+
+// Url receiving the events as signed json payloads.
+type Webhook struct {
+	Id  int64  `json:"id"`
+	URL string `json:"url"`
+	// key of the payload signature, sent in the `X-Yarr-Signature` header: `sha256=hex(hmac(secret, body))`
+	Secret  string        `json:"secret"`
+	Events  WebhookEvents `json:"events"`
+	Filter  WebhookFilter `json:"filter"`
+	Enabled bool          `json:"enabled"`
+}
+
+type WebhookEvents []string
+
+// Limits the new items sent to the webhook. Empty fields match all the items.
+type WebhookFilter struct {
+	FeedIDs   []int64 `json:"feed_ids,omitempty"`
+	FolderIDs []int64 `json:"folder_ids,omitempty"`
+	// comma-separated keywords, any of which has to be found in the title or the content (case-insensitive)
+	Keywords string `json:"keywords,omitempty"`
+}
+
+// Payload sent to the webhook along with the outcome of sending it.
+type WebhookDelivery struct {
+	Id        int64           `json:"id"`
+	WebhookID int64           `json:"webhook_id"`
+	Event     string          `json:"event"`
+	Payload   json.RawMessage `json:"payload"`
+	// http status code of the last attempt, 0 if there was no response
+	Status      int        `json:"status"`
+	Attempts    int        `json:"attempts"`
+	Error       string     `json:"error"`
+	CreatedAt   time.Time  `json:"created_at"`
+	DeliveredAt *time.Time `json:"delivered_at"`
+	// time of the next attempt, nil once delivered or given up on
+	NextAttemptAt *time.Time `json:"next_attempt_at"`
+}
+
+func (e *WebhookEvents) Scan(src any) error {
+	switch data := src.(type) {
+	case []byte:
+		return json.Unmarshal(data, e)
+	case string:
+		return json.Unmarshal([]byte(data), e)
+	default:
+		return nil
+	}
+}
+
+func (e WebhookEvents) Value() (driver.Value, error) {
+	if e == nil {
+		e = WebhookEvents{}
+	}
+	data, err := json.Marshal(e)
+	return string(data), err
+}
+
+func (f *WebhookFilter) Scan(src any) error {
+	switch data := src.(type) {
+	case []byte:
+		return json.Unmarshal(data, f)
+	case string:
+		return json.Unmarshal([]byte(data), f)
+	default:
+		return nil
+	}
+}
+
+func (f WebhookFilter) Value() (driver.Value, error) {
+	return json.Marshal(f)
+}
+
+func (h Webhook) Validate() error {
+	u, err := url.Parse(h.URL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return fmt.Errorf("invalid url")
+	}
+	if len(h.Events) == 0 {
+		return fmt.Errorf("events missing")
+	}
+	for _, event := range h.Events {
+		if !webhookEvents[event] {
+			return fmt.Errorf("unknown event %q", event)
+		}
+	}
+	return nil
+}
+
+// Copy of the webhook with the secret replaced by the mask.
+func (h Webhook) Masked() Webhook {
+	if h.Secret != "" {
+		h.Secret = SecretMask
+	}
+	return h
+}
+
+// Whether the new item passes the filter. The feeds of the folders are passed along (see `ListFolderFeedIDs`).
+func (f WebhookFilter) Match(item Item, folderFeeds map[int64][]int64) bool {
+	if len(f.FeedIDs) > 0 || len(f.FolderIDs) > 0 {
+		found := false
+		for _, id := range f.FeedIDs {
+			found = found || id == item.FeedId
+		}
+		for _, folderId := range f.FolderIDs {
+			for _, id := range folderFeeds[folderId] {
+				found = found || id == item.FeedId
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	if strings.TrimSpace(f.Keywords) == "" {
+		return true
+	}
+	text := strings.ToLower(item.Title + "\n" + htmlutil.ExtractText(item.Content))
+	for _, keyword := range strings.Split(f.Keywords, ",") {
+		if keyword = strings.ToLower(strings.TrimSpace(keyword)); keyword != "" && strings.Contains(text, keyword) {
+			return true
+		}
+	}
+	return false
+}
+
+func (s *Storage) CreateWebhook(hook Webhook) *Webhook {
+	row := s.db.QueryRow(`
+		insert into webhooks (url, secret, events, filter, enabled) values (?, ?, ?, ?, ?)
+		returning id`,
+		hook.URL, hook.Secret, hook.Events, hook.Filter, hook.Enabled,
+	)
+	if err := row.Scan(&hook.Id); err != nil {
+		log.Print(err)
+		return nil
+	}
+	return &hook
+}
+
+func (s *Storage) UpdateWebhook(hook Webhook) bool {
+	_, err := s.db.Exec(`
+		update webhooks set url = ?, secret = ?, events = ?, filter = ?, enabled = ? where id = ?`,
+		hook.URL, hook.Secret, hook.Events, hook.Filter, hook.Enabled, hook.Id,
+	)
+	if err != nil {
+		log.Print(err)
+	}
+	return err == nil
+}
+
+func (s *Storage) DeleteWebhook(id int64) bool {
+	_, err := s.db.Exec(`delete from webhooks where id = ?`, id)
+	if err != nil {
+		log.Print(err)
+	}
+	return err == nil
+}
+
+func (s *Storage) GetWebhook(id int64) *Webhook {
+	var h Webhook
+	err := s.db.QueryRow(`
+		select id, url, secret, events, filter, enabled from webhooks where id = ?
+	`, id).Scan(&h.Id, &h.URL, &h.Secret, &h.Events, &h.Filter, &h.Enabled)
+	if err != nil {
+		if err != sql.ErrNoRows {
+			log.Print(err)
+		}
+		return nil
+	}
+	return &h
+}
+
+func (s *Storage) ListWebhooks() []Webhook {
+	return s.listWebhooks(`select id, url, secret, events, filter, enabled from webhooks order by id`)
+}
+
+// Enabled webhooks subscribed to the event.
+func (s *Storage) ListWebhooksFor(event string) []Webhook {
+	return s.listWebhooks(`
+		select id, url, secret, events, filter, enabled from webhooks
+		where enabled and exists (select 1 from json_each(events) where value = ?)
+		order by id`,
+		event,
+	)
+}
+
+func (s *Storage) listWebhooks(query string, args ...interface{}) []Webhook {
+	result := make([]Webhook, 0)
+	rows, err := s.db.Query(query, args...)
+	if err != nil {
+		log.Print(err)
+		return result
+	}
+	for rows.Next() {
+		var h Webhook
+		if err = rows.Scan(&h.Id, &h.URL, &h.Secret, &h.Events, &h.Filter, &h.Enabled); err != nil {
+			log.Print(err)
+			return result
+		}
+		result = append(result, h)
+	}
+	return result
+}
+
+// Record the delivery in the log of the webhook, dropping the oldest ones.
+func (s *Storage) CreateWebhookDelivery(delivery WebhookDelivery) *WebhookDelivery {
+	delivery.CreatedAt = delivery.CreatedAt.UTC()
+	row := s.db.QueryRow(`
+		insert into webhook_deliveries (webhook_id, event, payload, created_at, next_attempt_at)
+		values (?, ?, ?, ?, ?)
+		returning id`,
+		delivery.WebhookID, delivery.Event, string(delivery.Payload), delivery.CreatedAt, utcTime(delivery.NextAttemptAt),
+	)
+	if err := row.Scan(&delivery.Id); err != nil {
+		log.Print(err)
+		return nil
+	}
+	_, err := s.db.Exec(`
+		delete from webhook_deliveries
+		where webhook_id = ? and id not in (
+			select id from webhook_deliveries where webhook_id = ? order by id desc limit ?
+		)`,
+		delivery.WebhookID, delivery.WebhookID, webhookDeliveryLogSize,
+	)
+	if err != nil {
+		log.Print(err)
+	}
+	return &delivery
+}
+
+// Save the outcome of the latest attempt, along with the time of the next one.
+func (s *Storage) UpdateWebhookDelivery(delivery WebhookDelivery) bool {
+	_, err := s.db.Exec(`
+		update webhook_deliveries
+		set status = ?, attempts = ?, error = ?, delivered_at = ?, next_attempt_at = ?
+		where id = ?`,
+		delivery.Status, delivery.Attempts, delivery.Error,
+		utcTime(delivery.DeliveredAt), utcTime(delivery.NextAttemptAt), delivery.Id,
+	)
+	if err != nil {
+		log.Print(err)
+	}
+	return err == nil
+}
+
+// Deliveries of the webhook, newest first.
+func (s *Storage) ListWebhookDeliveries(webhookID int64) []WebhookDelivery {
+	return s.listWebhookDeliveries(`
+		select `+webhookDeliveryColumns+`
+		from webhook_deliveries d
+		where d.webhook_id = ?
+		order by d.id desc`,
+		webhookID,
+	)
+}
+
+// Deliveries of the enabled webhooks due for another attempt, oldest first.
+func (s *Storage) ListDueWebhookDeliveries(now time.Time) []WebhookDelivery {
+	return s.listWebhookDeliveries(`
+		select `+webhookDeliveryColumns+`
+		from webhook_deliveries d
+		join webhooks w on w.id = d.webhook_id
+		where w.enabled and d.next_attempt_at <= ?
+		order by d.id`,
+		now.UTC(),
+	)
+}
+
+const webhookDeliveryColumns = `
+	d.id, d.webhook_id, d.event, d.payload, d.status, d.attempts, d.error,
+	d.created_at, d.delivered_at, d.next_attempt_at`
+
+func (s *Storage) listWebhookDeliveries(query string, args ...interface{}) []WebhookDelivery {
+	result := make([]WebhookDelivery, 0)
+	rows, err := s.db.Query(query, args...)
+	if err != nil {
+		log.Print(err)
+		return result
+	}
+	for rows.Next() {
+		var d WebhookDelivery
+		var payload string
+		err = rows.Scan(
+			&d.Id, &d.WebhookID, &d.Event, &payload, &d.Status, &d.Attempts, &d.Error,
+			&d.CreatedAt, &d.DeliveredAt, &d.NextAttemptAt,
+		)
+		if err != nil {
+			log.Print(err)
+			return result
+		}
+		d.Payload = json.RawMessage(payload)
+		result = append(result, d)
+	}
+	return result
+}
+
+func utcTime(t *time.Time) *time.Time {
+	if t == nil {
+		return nil
+	}
+	utc := t.UTC()
+	return &utc
+}
@@ -0,0 +1,104 @@
+package storage
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+)
+
+func TestWebhooks(t *testing.T) {
+	db := testDB()
+	hook1 := db.CreateWebhook(Webhook{
+		URL:     "http://example.com/hook1",
+		Secret:  "secret",
+		Events:  WebhookEvents{EventItemNew, EventItemStarred},
+		Enabled: true,
+	})
+	hook2 := db.CreateWebhook(Webhook{
+		URL:     "http://example.com/hook2",
+		Events:  WebhookEvents{EventItemStarred},
+		Enabled: false,
+	})
+	if hook1 == nil || hook2 == nil {
+		t.Fatal("expected webhooks")
+	}
+	if have := db.GetWebhook(hook1.Id); have == nil || have.Secret != "secret" || len(have.Events) != 2 {
+		t.Fatalf("invalid webhook: %#v", have)
+	}
+	if have := db.ListWebhooksFor(EventItemStarred); len(have) != 1 || have[0].Id != hook1.Id {
+		t.Fatalf("invalid webhooks: %#v", have)
+	}
+	hook2.Enabled = true
+	db.UpdateWebhook(*hook2)
+	if have := db.ListWebhooksFor(EventItemStarred); len(have) != 2 {
+		t.Fatalf("invalid webhooks: %#v", have)
+	}
+	if have := db.ListWebhooksFor(EventFeedFailed); len(have) != 0 {
+		t.Fatalf("invalid webhooks: %#v", have)
+	}
+
+	defer func(size int) { webhookDeliveryLogSize = size }(webhookDeliveryLogSize)
+	webhookDeliveryLogSize = 3
+	for i := 0; i < 5; i++ {
+		db.CreateWebhookDelivery(WebhookDelivery{
+			WebhookID: hook1.Id,
+			Event:     EventItemStarred,
+			Payload:   json.RawMessage(`{"n":1}`),
+			CreatedAt: time.Now(),
+		})
+	}
+	deliveries := db.ListWebhookDeliveries(hook1.Id)
+	if len(deliveries) != 3 || deliveries[0].Id != 5 || string(deliveries[0].Payload) != `{"n":1}` {
+		t.Fatalf("invalid deliveries: %#v", deliveries)
+	}
+	now := time.Now().UTC()
+	delivery := deliveries[0]
+	delivery.Status, delivery.Attempts, delivery.DeliveredAt = 200, 2, &now
+	db.UpdateWebhookDelivery(delivery)
+	if have := db.ListWebhookDeliveries(hook1.Id)[0]; have.Status != 200 || have.Attempts != 2 || have.DeliveredAt == nil {
+		t.Fatalf("invalid delivery: %#v", have)
+	}
+
+	// the attempts due, of the enabled webhooks only
+	past, future := time.Now().Add(-time.Minute), time.Now().Add(time.Minute)
+	due := db.CreateWebhookDelivery(WebhookDelivery{WebhookID: hook1.Id, Event: EventItemNew, Payload: json.RawMessage(`{}`), CreatedAt: time.Now(), NextAttemptAt: &past})
+	db.CreateWebhookDelivery(WebhookDelivery{WebhookID: hook1.Id, Event: EventItemNew, Payload: json.RawMessage(`{}`), CreatedAt: time.Now(), NextAttemptAt: &future})
+	db.CreateWebhookDelivery(WebhookDelivery{WebhookID: hook2.Id, Event: EventItemNew, Payload: json.RawMessage(`{}`), CreatedAt: time.Now(), NextAttemptAt: &past})
+	hook2.Enabled = false
+	db.UpdateWebhook(*hook2)
+	if have := db.ListDueWebhookDeliveries(time.Now()); len(have) != 1 || have[0].Id != due.Id || have[0].NextAttemptAt == nil {
+		t.Fatalf("invalid due deliveries: %#v", have)
+	}
+	due.NextAttemptAt = nil
+	db.UpdateWebhookDelivery(*due)
+	if have := db.ListDueWebhookDeliveries(time.Now()); len(have) != 0 {
+		t.Fatalf("invalid due deliveries: %#v", have)
+	}
+
+	db.DeleteWebhook(hook2.Id)
+	if have := db.ListWebhooks(); len(have) != 1 || have[0].Id != hook1.Id {
+		t.Fatalf("invalid webhooks: %#v", have)
+	}
+}
+
+func TestWebhookFilter(t *testing.T) {
+	folderFeeds := map[int64][]int64{10: {2, 3}}
+	item := Item{FeedId: 3, Title: "Hello", Content: "<p>Released <b>v2.0</b></p>"}
+
+	testcases := []struct {
+		filter WebhookFilter
+		want   bool
+	}{
+		{WebhookFilter{}, true},
+		{WebhookFilter{FeedIDs: []int64{1}}, false},
+		{WebhookFilter{FeedIDs: []int64{1}, FolderIDs: []int64{10}}, true},
+		{WebhookFilter{Keywords: "world, RELEASED"}, true},
+		{WebhookFilter{Keywords: "world"}, false},
+		{WebhookFilter{FeedIDs: []int64{3}, Keywords: "hello"}, true},
+	}
+	for _, testcase := range testcases {
+		if have := testcase.filter.Match(item, folderFeeds); have != testcase.want {
+			t.Errorf("%#v: want %v, have %v", testcase.filter, testcase.want, have)
+		}
+	}
+}
@@ -0,0 +1,130 @@
+package storage
+
+import (
+	"database/sql"
+	"log"
+	"time"
+)
+
+type WebSubState string
+
+const (
+	WebSubNew     WebSubState = ""
+	WebSubPending WebSubState = "pending"
+	WebSubActive  WebSubState = "active"
+	WebSubDenied  WebSubState = "denied"
+)
+
+// WebSub (PubSubHubbub) subscription of the feed to the hub advertised by the publisher.
+type WebSub struct {
+	FeedID int64
+	Hub    string
+	Topic  string
+	Secret string
+	State  WebSubState
+
+	RequestedAt *time.Time
+	ExpiresAt   *time.Time
+}
+
+const webSubColumns = `feed_id, hub, topic, secret, state, requested_at, expires_at`
+
+func scanWebSub(row interface{ Scan(...any) error }) (*WebSub, error) {
+	var sub WebSub
+	err := row.Scan(
+		&sub.FeedID, &sub.Hub, &sub.Topic, &sub.Secret, &sub.State,
+		&sub.RequestedAt, &sub.ExpiresAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+	return &sub, nil
+}
+
+func (s *Storage) ListWebSubs() []WebSub {
+	result := make([]WebSub, 0)
+	rows, err := s.db.Query(`select ` + webSubColumns + ` from websub_subscriptions`)
+	if err != nil {
+		log.Print(err)
+		return result
+	}
+	for rows.Next() {
+		sub, err := scanWebSub(rows)
+		if err != nil {
+			log.Print(err)
+			return result
+		}
+		result = append(result, *sub)
+	}
+	return result
+}
+
+func (s *Storage) GetWebSub(feedID int64) *WebSub {
+	row := s.db.QueryRow(`select `+webSubColumns+` from websub_subscriptions where feed_id = ?`, feedID)
+	sub, err := scanWebSub(row)
+	if err != nil {
+		if err != sql.ErrNoRows {
+			log.Print(err)
+		}
+		return nil
+	}
+	return sub
+}
+
+// Record the hub advertised by the feed. The subscription starts over
+// if either the hub or the topic have changed, and is removed if there's no hub.
+func (s *Storage) SetWebSubHub(feedID int64, hub, topic string) {
+	var err error
+	if hub == "" {
+		_, err = s.db.Exec(`delete from websub_subscriptions where feed_id = ?`, feedID)
+	} else {
+		_, err = s.db.Exec(`
+			insert into websub_subscriptions (feed_id, hub, topic)
+			values (?, ?, ?)
+			on conflict (feed_id) do update set
+				hub = excluded.hub,
+				topic = excluded.topic,
+				state = iif(hub = excluded.hub and topic = excluded.topic, state, ''),
+				requested_at = iif(hub = excluded.hub and topic = excluded.topic, requested_at, null),
+				expires_at = iif(hub = excluded.hub and topic = excluded.topic, expires_at, null)`,
+			feedID, hub, topic,
+		)
+	}
+	if err != nil {
+		log.Print(err)
+	}
+}
+
+// Record the subscription request sent to the hub. Active subscriptions stay active while being renewed.
+func (s *Storage) SetWebSubRequested(feedID int64, secret string) {
+	_, err := s.db.Exec(`
+		update websub_subscriptions
+		set secret = ?, requested_at = ?, state = iif(state = ?, state, ?)
+		where feed_id = ?`,
+		secret, time.Now().UTC(), WebSubActive, WebSubPending, feedID,
+	)
+	if err != nil {
+		log.Print(err)
+	}
+}
+
+// Activate the subscription confirmed by the hub for the given lease.
+func (s *Storage) SetWebSubVerified(feedID int64, lease time.Duration) {
+	_, err := s.db.Exec(`
+		update websub_subscriptions set state = ?, expires_at = ? where feed_id = ?`,
+		WebSubActive, time.Now().UTC().Add(lease), feedID,
+	)
+	if err != nil {
+		log.Print(err)
+	}
+}
+
+func (s *Storage) SetWebSubDenied(feedID int64) {
+	_, err := s.db.Exec(`
+		update websub_subscriptions set state = ?, expires_at = null where feed_id = ?`,
+		WebSubDenied, feedID,
+	)
+	if err != nil {
+		log.Print(err)
+	}
+}
@@ -0,0 +1,34 @@
+package storage
+
+import (
+	"testing"
+	"time"
+)
+
+func TestWebSubHub(t *testing.T) {
+	db := testDB()
+	feed := db.CreateFeed("feed", "", "", "http://example.com/feed.xml", nil)
+
+	db.SetWebSubHub(feed.Id, "http://hub.example.com/", "http://example.com/feed.xml")
+	db.SetWebSubRequested(feed.Id, "secret")
+	if sub := db.GetWebSub(feed.Id); sub == nil || sub.State != WebSubPending || sub.Secret != "secret" {
+		t.Fatalf("invalid subscription: %#v", sub)
+	}
+
+	db.SetWebSubVerified(feed.Id, time.Hour)
+	db.SetWebSubRequested(feed.Id, "secret")
+	db.SetWebSubHub(feed.Id, "http://hub.example.com/", "http://example.com/feed.xml")
+	if sub := db.GetWebSub(feed.Id); sub.State != WebSubActive || sub.ExpiresAt == nil {
+		t.Fatalf("renewed subscription deactivated: %#v", sub)
+	}
+
+	db.SetWebSubHub(feed.Id, "http://otherhub.example.com/", "http://example.com/feed.xml")
+	if sub := db.GetWebSub(feed.Id); sub.State != WebSubNew || sub.ExpiresAt != nil || sub.RequestedAt != nil {
+		t.Fatalf("subscription to the new hub not reset: %#v", sub)
+	}
+
+	db.SetWebSubHub(feed.Id, "", "http://example.com/feed.xml")
+	if sub := db.GetWebSub(feed.Id); sub != nil || len(db.ListWebSubs()) != 0 {
+		t.Fatalf("subscription not removed: %#v", sub)
+	}
+}
@@ -0,0 +1,83 @@
+package worker
+
+import (
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	backupPrefix = "yarr-"
+	backupSuffix = ".db"
+)
+
+// Periodically back up the database into the directory,
+// keeping only the given number of the most recent backups.
+func (w *Worker) StartBackups(dir string, interval time.Duration, keep int) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		log.Printf("Failed to create backup dir %s: %s", dir, err)
+		return
+	}
+
+	backup := func() {
+		path := filepath.Join(dir, backupPrefix+time.Now().UTC().Format("20060102-150405")+backupSuffix)
+		if err := w.db.Backup(path); err != nil {
+			log.Printf("Failed to back up the database to %s: %s", path, err)
+			return
+		}
+		log.Printf("Backed up the database to %s", path)
+		rotateBackups(dir, keep)
+	}
+
+	go func() {
+		// skip the initial backup if the last one is recent enough
+		if backups := listBackups(dir); len(backups) > 0 {
+			if info, err := os.Stat(backups[len(backups)-1]); err == nil {
+				if wait := interval - time.Since(info.ModTime()); wait > 0 {
+					time.Sleep(wait)
+				}
+			}
+		}
+		backup()
+		ticker := time.NewTicker(interval)
+		for {
+			<-ticker.C
+			backup()
+		}
+	}()
+}
+
+// List the backup files in the directory, oldest first.
+func listBackups(dir string) []string {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		log.Print(err)
+		return nil
+	}
+	backups := make([]string, 0)
+	for _, entry := range entries {
+		name := entry.Name()
+		if !entry.IsDir() && strings.HasPrefix(name, backupPrefix) && strings.HasSuffix(name, backupSuffix) {
+			backups = append(backups, filepath.Join(dir, name))
+		}
+	}
+	// the names contain the timestamp
+	sort.Strings(backups)
+	return backups
+}
+
+func rotateBackups(dir string, keep int) {
+	if keep <= 0 {
+		return
+	}
+	backups := listBackups(dir)
+	for len(backups) > keep {
+		if err := os.Remove(backups[0]); err != nil {
+			log.Print(err)
+		}
+		backups = backups[1:]
+	}
+}
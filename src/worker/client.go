@@ -1,9 +1,18 @@
 package worker
 
 import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
 	"net"
 	"net/http"
+	"net/url"
+	"strings"
+	"syscall"
 	"time"
+
+	"github.com/nkanaev/yarr/src/storage"
 )
 
 type Client struct {
@@ -11,16 +20,47 @@ type Client struct {
 	userAgent  string
 }
 
-func (c *Client) get(url string) (*http.Response, error) {
-	return c.getConditional(url, "", "")
-}
+// Context key of the custom headers of the request, see `checkRedirect`.
+type customHeadersKey struct{}
 
-func (c *Client) getConditional(url, lastModified, etag string) (*http.Response, error) {
-	req, err := http.NewRequest("GET", url, nil)
+func (c *Client) newRequest(method, url string, body io.Reader, opts *storage.RequestOptions) (*http.Request, error) {
+	req, err := http.NewRequest(method, url, body)
 	if err != nil {
 		return nil, err
 	}
 	req.Header.Set("User-Agent", c.userAgent)
+	if opts == nil {
+		return req, nil
+	}
+	for name, value := range opts.Headers {
+		req.Header.Set(name, value)
+	}
+	if len(opts.Headers) > 0 {
+		req = req.WithContext(context.WithValue(req.Context(), customHeadersKey{}, opts.Headers))
+	}
+	if opts.UserAgent != "" {
+		req.Header.Set("User-Agent", opts.UserAgent)
+	}
+	if opts.Cookie != "" {
+		req.Header.Set("Cookie", opts.Cookie)
+	}
+	if opts.Username != "" || opts.Password != "" {
+		req.SetBasicAuth(opts.Username, opts.Password)
+	} else if opts.Token != "" {
+		req.Header.Set("Authorization", "Bearer "+opts.Token)
+	}
+	return req, nil
+}
+
+func (c *Client) get(url string, opts *storage.RequestOptions) (*http.Response, error) {
+	return c.getConditional(url, "", "", opts)
+}
+
+func (c *Client) getConditional(url, lastModified, etag string, opts *storage.RequestOptions) (*http.Response, error) {
+	req, err := c.newRequest("GET", url, nil, opts)
+	if err != nil {
+		return nil, err
+	}
 	if lastModified != "" {
 		req.Header.Set("If-Modified-Since", lastModified)
 	}
@@ -30,27 +70,106 @@ func (c *Client) getConditional(url, lastModified, etag string) (*http.Response,
 	return c.httpClient.Do(req)
 }
 
+func (c *Client) postForm(url string, data url.Values) (*http.Response, error) {
+	req, err := c.newRequest("POST", url, strings.NewReader(data.Encode()), nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	return c.httpClient.Do(req)
+}
+
+// Options of the feed to use for the request to the given url.
+// The credentials are only sent to the host of the feed.
+func scopedOptions(opts *storage.RequestOptions, feedLink, target string) *storage.RequestOptions {
+	if opts == nil || sameHost(feedLink, target) {
+		return opts
+	}
+	return &storage.RequestOptions{UserAgent: opts.UserAgent}
+}
+
+func sameHost(a, b string) bool {
+	urlA, errA := url.Parse(a)
+	urlB, errB := url.Parse(b)
+	if errA != nil || errB != nil {
+		return false
+	}
+	return urlA.Host != "" && strings.EqualFold(urlA.Host, urlB.Host)
+}
+
+// Drops the custom headers of the feed (e.g. API keys) when redirected to another host.
+// The standard ones (Authorization, Cookie) are already dropped by net/http.
+func checkRedirect(req *http.Request, via []*http.Request) error {
+	if len(via) >= 10 {
+		return errors.New("stopped after 10 redirects")
+	}
+	headers, ok := req.Context().Value(customHeadersKey{}).(map[string]string)
+	if ok && !strings.EqualFold(req.URL.Host, via[0].URL.Host) {
+		for name := range headers {
+			req.Header.Del(name)
+		}
+	}
+	return nil
+}
+
+// Whether the connections to the address (ip:port) are allowed, see `mediaTransport`.
+var publicAddress = func(address string) bool {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return false
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && !(ip.IsPrivate() || ip.IsLoopback() || ip.IsLinkLocalUnicast() ||
+		ip.IsLinkLocalMulticast() || ip.IsUnspecified())
+}
+
+// Rejects the connections to the internal addresses, once the hostname is resolved.
+func dialPublic(network, address string, conn syscall.RawConn) error {
+	if !publicAddress(address) {
+		return fmt.Errorf("internal address: %s", address)
+	}
+	return nil
+}
+
 var client *Client
 
+// Transport of the downloads of the urls given by the feeds, the enclosures are served back by the api.
+// The connections are made directly (not via the proxy), for the addresses to be checked, redirects included.
+var mediaTransport *http.Transport
+
 func SetVersion(num string) {
 	client.userAgent = "Yarr/" + num
 }
 
 func init() {
+	// connections are kept open for the feeds on the same host
 	transport := &http.Transport{
 		Proxy: http.ProxyFromEnvironment,
 		DialContext: (&net.Dialer{
-			Timeout: 10 * time.Second,
+			Timeout:   10 * time.Second,
+			KeepAlive: 30 * time.Second,
 		}).DialContext,
-		DisableKeepAlives:   true,
+		ForceAttemptHTTP2:   true,
+		MaxIdleConns:        100,
+		MaxIdleConnsPerHost: 4,
+		IdleConnTimeout:     90 * time.Second,
 		TLSHandshakeTimeout: time.Second * 10,
 	}
 	httpClient := &http.Client{
-		Timeout:   time.Second * 30,
-		Transport: transport,
+		Timeout:       time.Second * 30,
+		Transport:     transport,
+		CheckRedirect: checkRedirect,
 	}
 	client = &Client{
 		httpClient: httpClient,
 		userAgent:  "Yarr/1.0",
 	}
+
+	mediaTransport = transport.Clone()
+	mediaTransport.Proxy = nil
+	mediaTransport.DialContext = (&net.Dialer{
+		Timeout:   10 * time.Second,
+		KeepAlive: 30 * time.Second,
+		Control:   dialPublic,
+	}).DialContext
 }
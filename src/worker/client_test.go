@@ -0,0 +1,42 @@
+package worker
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/nkanaev/yarr/src/storage"
+)
+
+func TestRedirectHeaders(t *testing.T) {
+	received := make(map[string]string)
+	other := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		received[r.URL.Path] = r.Header.Get("X-Api-Key")
+	}))
+	defer other.Close()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		received[r.URL.Path] = r.Header.Get("X-Api-Key")
+		switch r.URL.Path {
+		case "/same":
+			http.Redirect(w, r, "/target", http.StatusFound)
+		case "/other":
+			http.Redirect(w, r, other.URL+"/external", http.StatusFound)
+		}
+	}))
+	defer server.Close()
+
+	opts := &storage.RequestOptions{Headers: map[string]string{"X-Api-Key": "secret"}}
+	for _, path := range []string{"/same", "/other"} {
+		res, err := client.get(server.URL+path, opts)
+		if err != nil {
+			t.Fatal(err)
+		}
+		res.Body.Close()
+	}
+	want := map[string]string{"/same": "secret", "/target": "secret", "/other": "secret", "/external": ""}
+	for path, value := range want {
+		if have, ok := received[path]; !ok || have != value {
+			t.Errorf("%s: want %q, have %q", path, value, have)
+		}
+	}
+}
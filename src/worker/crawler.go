@@ -10,8 +10,10 @@ import (
 	"net/http"
 	"net/url"
 	"strings"
+	"time"
 
 	"github.com/nkanaev/yarr/src/content/scraper"
+	"github.com/nkanaev/yarr/src/content/silo"
 	"github.com/nkanaev/yarr/src/parser"
 	"github.com/nkanaev/yarr/src/storage"
 	"golang.org/x/net/html/charset"
@@ -28,10 +30,44 @@ type DiscoverResult struct {
 	Sources  []FeedSource
 }
 
-func DiscoverFeed(candidateUrl string) (*DiscoverResult, error) {
+// Fetch the page of the scraped feed & extract its items with the selectors.
+func ScrapeFeed(pageUrl string, selectors storage.FeedSelectors, opts *storage.RequestOptions) (*parser.Feed, error) {
+	res, err := client.get(pageUrl, opts)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+	if res.StatusCode != 200 {
+		return nil, fmt.Errorf("status code %d", res.StatusCode)
+	}
+	return parser.ParseHTML(res.Body, pageUrl, getCharset(res), parser.Selectors(selectors))
+}
+
+// Common locations of the feeds on the sites not advertising them.
+var commonFeedPaths = []string{"/feed", "/rss.xml", "/atom.xml", "/index.xml"}
+
+func DiscoverFeed(candidateUrl string, opts *storage.RequestOptions) (*DiscoverResult, error) {
+	// the feeds of the known sites are derived from the url
+	links := silo.FeedLinks(candidateUrl)
+	if len(links) > 1 {
+		sources := make([]FeedSource, 0, len(links))
+		for url, title := range links {
+			sources = append(sources, FeedSource{Title: title, Url: url})
+		}
+		return &DiscoverResult{Sources: sources}, nil
+	}
+	for url := range links {
+		if url == candidateUrl {
+			continue
+		}
+		if result, err := DiscoverFeed(url, scopedOptions(opts, candidateUrl, url)); err == nil {
+			return result, nil
+		}
+	}
+
 	result := &DiscoverResult{}
 	// Query URL
-	res, err := client.get(candidateUrl)
+	res, err := client.get(candidateUrl, opts)
 	if err != nil {
 		return nil, err
 	}
@@ -69,18 +105,49 @@ func DiscoverFeed(candidateUrl string) (*DiscoverResult, error) {
 	}
 	switch {
 	case len(sources) == 0:
+		// the site may have a feed without advertising it
+		if result := probeFeeds(candidateUrl, opts); result != nil {
+			return result, nil
+		}
 		return nil, errors.New("No feeds found at the given url")
 	case len(sources) == 1:
 		if sources[0].Url == candidateUrl {
 			return nil, errors.New("Recursion!")
 		}
-		return DiscoverFeed(sources[0].Url)
+		return DiscoverFeed(sources[0].Url, scopedOptions(opts, candidateUrl, sources[0].Url))
 	}
 
 	result.Sources = sources
 	return result, nil
 }
 
+// Look for the feed at the common locations of the site.
+func probeFeeds(siteUrl string, opts *storage.RequestOptions) *DiscoverResult {
+	u, err := url.Parse(siteUrl)
+	if err != nil {
+		return nil
+	}
+	for _, path := range commonFeedPaths {
+		link := u.Scheme + "://" + u.Host + path
+		if link == siteUrl {
+			continue
+		}
+		res, err := client.get(link, scopedOptions(opts, siteUrl, link))
+		if err != nil {
+			continue
+		}
+		var feed *parser.Feed
+		if res.StatusCode == 200 {
+			feed, err = parser.ParseAndFix(res.Body, link, getCharset(res))
+		}
+		res.Body.Close()
+		if feed != nil && err == nil {
+			return &DiscoverResult{Feed: feed, FeedLink: link}
+		}
+	}
+	return nil
+}
+
 var emptyIcon = make([]byte, 0)
 var imageTypes = map[string]bool{
 	"image/x-icon": true,
@@ -89,7 +156,7 @@ var imageTypes = map[string]bool{
 	"image/gif":    true,
 }
 
-func findFavicon(siteUrl, feedUrl string) (*[]byte, error) {
+func findFavicon(siteUrl, feedUrl string, opts *storage.RequestOptions) (*[]byte, error) {
 	urls := make([]string, 0)
 
 	favicon := func(link string) string {
@@ -101,7 +168,7 @@ func findFavicon(siteUrl, feedUrl string) (*[]byte, error) {
 	}
 
 	if siteUrl != "" {
-		if res, err := client.get(siteUrl); err == nil {
+		if res, err := client.get(siteUrl, scopedOptions(opts, feedUrl, siteUrl)); err == nil {
 			defer res.Body.Close()
 			if body, err := ioutil.ReadAll(res.Body); err == nil {
 				urls = append(urls, scraper.FindIcons(string(body), siteUrl)...)
@@ -117,7 +184,7 @@ func findFavicon(siteUrl, feedUrl string) (*[]byte, error) {
 	}
 
 	for _, u := range urls {
-		res, err := client.get(u)
+		res, err := client.get(u, scopedOptions(opts, feedUrl, u))
 		if err != nil {
 			continue
 		}
@@ -147,21 +214,48 @@ func ConvertItems(items []parser.Item, feed storage.Feed) []storage.Item {
 		for _, link := range item.MediaLinks {
 			mediaLinks = append(mediaLinks, storage.MediaLink(link))
 		}
+		var dateUpdated *time.Time
+		if !item.DateUpdated.IsZero() {
+			dateUpdated = &item.DateUpdated
+		}
 		result[i] = storage.Item{
-			GUID:       item.GUID,
-			FeedId:     feed.Id,
-			Title:      item.Title,
-			Link:       item.URL,
-			Content:    item.Content,
-			Date:       item.Date,
-			Status:     storage.UNREAD,
-			MediaLinks: mediaLinks,
+			GUID:        item.GUID,
+			FeedId:      feed.Id,
+			Title:       item.Title,
+			Link:        item.URL,
+			Content:     item.Content,
+			Date:        item.Date,
+			DateUpdated: dateUpdated,
+			Status:      storage.UNREAD,
+			MediaLinks:  mediaLinks,
+
+			Author:       item.Author,
+			Categories:   item.Categories,
+			CommentsLink: item.CommentsURL,
 		}
 	}
 	return result
 }
 
-func listItems(f storage.Feed, db *storage.Storage) ([]storage.Item, error) {
+// Details of the http exchange, recorded in the fetch log of the feed.
+type fetchStats struct {
+	status int
+	bytes  int64
+}
+
+type countingReader struct {
+	reader io.Reader
+	count  *int64
+}
+
+func (r countingReader) Read(p []byte) (int, error) {
+	n, err := r.reader.Read(p)
+	*r.count += int64(n)
+	return n, err
+}
+
+// The hub advertised by the feed is recorded only if the websub subscriptions are enabled.
+func listItems(f storage.Feed, db *storage.Storage, stats *fetchStats, webSub bool) ([]storage.Item, error) {
 	lmod := ""
 	etag := ""
 	if state := db.GetHTTPState(f.Id); state != nil {
@@ -169,26 +263,45 @@ func listItems(f storage.Feed, db *storage.Storage) ([]storage.Item, error) {
 		etag = state.Etag
 	}
 
-	res, err := client.getConditional(f.FeedLink, lmod, etag)
+	res, err := client.getConditional(f.FeedLink, lmod, etag, db.GetFeedRequestOptions(f.Id))
 	if err != nil {
 		return nil, err
 	}
 	defer res.Body.Close()
+	stats.status = res.StatusCode
 
+	now := time.Now()
 	switch {
+	case res.StatusCode == http.StatusTooManyRequests || res.StatusCode == http.StatusServiceUnavailable:
+		db.SetFeedNextCheck(f.Id, nextCheckTime(now, retryAfter(res.Header, now)))
+		return nil, fmt.Errorf("status code %d", res.StatusCode)
 	case res.StatusCode < 200 || res.StatusCode > 399:
 		if res.StatusCode == 404 {
 			return nil, fmt.Errorf("feed not found")
 		}
 		return nil, fmt.Errorf("status code %d", res.StatusCode)
 	case res.StatusCode == http.StatusNotModified:
+		db.SetFeedNextCheck(f.Id, nextCheckTime(now, cacheMaxAge(res.Header, now)))
 		return nil, nil
 	}
 
-	feed, err := parser.ParseAndFix(res.Body, f.FeedLink, getCharset(res))
+	body := countingReader{reader: res.Body, count: &stats.bytes}
+	var feed *parser.Feed
+	if selectors := db.GetFeedSelectors(f.Id); selectors != nil {
+		feed, err = parser.ParseHTML(body, f.FeedLink, getCharset(res), parser.Selectors(*selectors))
+	} else {
+		feed, err = parser.ParseAndFix(body, f.FeedLink, getCharset(res))
+	}
 	if err != nil {
 		return nil, err
 	}
+	db.SetFeedNextCheck(f.Id, nextCheckTime(now, cacheMaxAge(res.Header, now), feed.TTL, feed.UpdateInterval))
+	db.SetFeedSkipTimes(f.Id, feed.SkipHours, feed.SkipDays)
+	if webSub {
+		hub, topic := webSubLinks(res, feed, f)
+		db.SetWebSubHub(f.Id, hub, topic)
+	}
+	trackFeedMove(res, feed, f, db)
 
 	lmod = res.Header.Get("Last-Modified")
 	etag = res.Header.Get("Etag")
@@ -199,7 +312,10 @@ func listItems(f storage.Feed, db *storage.Storage) ([]storage.Item, error) {
 }
 
 func getCharset(res *http.Response) string {
-	contentType := res.Header.Get("Content-Type")
+	return contentCharset(res.Header.Get("Content-Type"))
+}
+
+func contentCharset(contentType string) string {
 	if _, params, err := mime.ParseMediaType(contentType); err == nil {
 		if cs, ok := params["charset"]; ok {
 			if e, _ := charset.Lookup(cs); e != nil {
@@ -210,8 +326,8 @@ func getCharset(res *http.Response) string {
 	return ""
 }
 
-func GetBody(url string) (string, error) {
-	res, err := client.get(url)
+func GetBody(url string, opts *storage.RequestOptions) (string, error) {
+	res, err := client.get(url, opts)
 	if err != nil {
 		return "", err
 	}
@@ -0,0 +1,193 @@
+package worker
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"html/template"
+	"log"
+	"mime"
+	"net/smtp"
+	"strings"
+	"time"
+
+	"github.com/nkanaev/yarr/src/content/htmlutil"
+	"github.com/nkanaev/yarr/src/storage"
+)
+
+// Server sending the digests.
+type SMTPConfig struct {
+	// host:port
+	Addr     string
+	Username string
+	Password string
+	// sender address
+	From string
+}
+
+var ErrSMTPNotConfigured = errors.New("smtp server not configured")
+
+// Length of the excerpts of the items in the digest, in characters.
+const digestExcerptLength = 300
+
+var digestTemplate = template.Must(template.New("digest").Parse(`<!DOCTYPE html>
+<html>
+<head><meta charset="utf-8"><meta name="viewport" content="width=device-width, initial-scale=1"></head>
+<body style="font-family: -apple-system, sans-serif; max-width: 640px; margin: 0 auto; padding: 16px; color: #222;">
+<h1 style="font-size: 20px;">{{ .Title }}</h1>
+<p style="color: #777;">{{ .Count }} unread {{ if eq .Count 1 }}item{{ else }}items{{ end }}</p>
+{{ range .Feeds }}
+<h2 style="font-size: 16px; border-bottom: 1px solid #ddd; padding-bottom: 4px;">{{ .Title }}</h2>
+{{ range .Items }}
+<div style="margin-bottom: 16px;">
+<a href="{{ .Link }}" style="font-weight: bold; color: #0645ad; text-decoration: none;">{{ .Title }}</a>
+<div style="color: #777; font-size: 12px;">{{ .Date }}</div>
+{{ if .Excerpt }}<div style="font-size: 14px;">{{ .Excerpt }}</div>{{ end }}
+</div>
+{{ end }}
+{{ end }}
+</body>
+</html>
+`))
+
+type digestData struct {
+	Title string
+	Count int
+	Feeds []digestFeed
+}
+
+type digestFeed struct {
+	Title string
+	Items []digestItem
+}
+
+type digestItem struct {
+	Title   string
+	Link    string
+	Date    string
+	Excerpt string
+}
+
+func (w *Worker) SetSMTP(config SMTPConfig) {
+	w.smtp = &config
+}
+
+// Check the schedules of the digests every minute & send the ones due.
+// The failed ones are retried with a growing delay (see `Digest.RetryDelay`).
+func (w *Worker) StartDigests() {
+	go func() {
+		ticker := time.NewTicker(time.Minute)
+		for {
+			now := time.Now()
+			for _, digest := range w.db.ListDigests() {
+				if digest.Due(now) {
+					if _, err := w.SendDigest(digest); err != nil {
+						log.Printf("Failed to send digest %s to %s: %s", digest.Title, digest.Email, err)
+						w.db.MarkDigestFailed(digest.Id, now)
+					}
+				}
+			}
+			<-ticker.C
+		}
+	}()
+}
+
+// Render the digest of the unread items not sent yet. Returns the html & the items included.
+func (w *Worker) RenderDigest(digest storage.Digest) (string, []storage.Item, error) {
+	items := w.db.ListDigestItems(digest)
+
+	feedTitles := make(map[int64]string)
+	for _, feed := range w.db.ListFeeds() {
+		feedTitles[feed.Id] = feed.Title
+	}
+	data := digestData{Title: digest.Title, Count: len(items)}
+	feedIndex := make(map[int64]int)
+	for _, item := range items {
+		i, ok := feedIndex[item.FeedId]
+		if !ok {
+			i = len(data.Feeds)
+			feedIndex[item.FeedId] = i
+			data.Feeds = append(data.Feeds, digestFeed{Title: feedTitles[item.FeedId]})
+		}
+		title := item.Title
+		if title == "" {
+			title = item.Link
+		}
+		data.Feeds[i].Items = append(data.Feeds[i].Items, digestItem{
+			Title:   title,
+			Link:    item.Link,
+			Date:    item.Date.Local().Format("Jan 2, 15:04"),
+			Excerpt: excerpt(htmlutil.ExtractText(item.Content), digestExcerptLength),
+		})
+	}
+
+	var buf bytes.Buffer
+	if err := digestTemplate.Execute(&buf, data); err != nil {
+		return "", nil, err
+	}
+	return buf.String(), items, nil
+}
+
+// Send the digest & record its items as sent. Returns the number of the items sent.
+// Nothing is sent if there are no new items.
+func (w *Worker) SendDigest(digest storage.Digest) (int, error) {
+	if w.smtp == nil {
+		return 0, ErrSMTPNotConfigured
+	}
+	body, items, err := w.RenderDigest(digest)
+	if err != nil {
+		return 0, err
+	}
+	now := time.Now()
+	ids := make([]int64, len(items))
+	for i, item := range items {
+		ids[i] = item.Id
+	}
+	if len(items) > 0 {
+		subject := fmt.Sprintf("%s: %d unread", digest.Title, len(items))
+		if err := sendMail(*w.smtp, digest.Email, subject, body); err != nil {
+			return 0, err
+		}
+	}
+	w.db.MarkDigestSent(digest.Id, ids, now)
+	return len(items), nil
+}
+
+func sendMail(config SMTPConfig, to, subject, body string) error {
+	var msg bytes.Buffer
+	headers := [][2]string{
+		{"From", config.From},
+		{"To", to},
+		{"Subject", mime.QEncoding.Encode("utf-8", subject)},
+		{"Date", time.Now().Format(time.RFC1123Z)},
+		{"MIME-Version", "1.0"},
+		{"Content-Type", `text/html; charset="utf-8"`},
+		{"Content-Transfer-Encoding", "8bit"},
+	}
+	for _, header := range headers {
+		fmt.Fprintf(&msg, "%s: %s\r\n", header[0], header[1])
+	}
+	msg.WriteString("\r\n")
+	msg.WriteString(strings.ReplaceAll(body, "\n", "\r\n"))
+
+	var auth smtp.Auth
+	if config.Username != "" {
+		host, _, _ := strings.Cut(config.Addr, ":")
+		auth = smtp.PlainAuth("", config.Username, config.Password, host)
+	}
+	return smtp.SendMail(config.Addr, auth, config.From, []string{to}, msg.Bytes())
+}
+
+// Beginning of the text, cut at a word boundary.
+func excerpt(text string, length int) string {
+	text = strings.Join(strings.Fields(text), " ")
+	runes := []rune(text)
+	if len(runes) <= length {
+		return text
+	}
+	cut := string(runes[:length])
+	if i := strings.LastIndex(cut, " "); i > 0 {
+		cut = cut[:i]
+	}
+	return cut + "…"
+}
@@ -0,0 +1,321 @@
+package worker
+
+import (
+	"log"
+	"net/url"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/nkanaev/yarr/src/storage"
+)
+
+type fetchLimits struct {
+	// number of feeds fetched at the same time
+	concurrency int
+	// number of feeds fetched at the same time from a single host
+	hostConcurrency int
+	// minimum delay between the requests to the same host
+	hostDelay time.Duration
+}
+
+var defaultFetchLimits = fetchLimits{
+	concurrency:     8,
+	hostConcurrency: 2,
+	hostDelay:       time.Second,
+}
+
+// Set the limits of the feed fetching. Non-positive concurrency values keep the defaults.
+func (w *Worker) SetFetchLimits(concurrency, hostConcurrency int, hostDelay time.Duration) {
+	w.reflock.Lock()
+	defer w.reflock.Unlock()
+
+	if concurrency > 0 {
+		w.limits.concurrency = concurrency
+	}
+	if hostConcurrency > 0 {
+		w.limits.hostConcurrency = hostConcurrency
+	}
+	w.limits.hostDelay = max(hostDelay, 0)
+	log.Printf(
+		"fetcher: %d concurrent requests, %d per host, %s between requests to the same host",
+		w.limits.concurrency, w.limits.hostConcurrency, w.limits.hostDelay,
+	)
+}
+
+type feedResult struct {
+	feed  storage.Feed
+	host  string
+	items []storage.Item
+	err   error
+	// number of the items in the feed, the ones dropped by the rules included
+	size int
+
+	start    time.Time
+	duration time.Duration
+	stats    fetchStats
+	// the feed was being fetched by another refresh
+	skipped bool
+}
+
+// Fetch the feeds within the limits & save the results.
+func (w *Worker) refresher(feeds []storage.Feed, limits fetchLimits) {
+	start := time.Now()
+	var slowest feedResult
+	fetches := make([]storage.FeedFetch, 0, len(feeds))
+
+	w.dispatch(feeds, limits, func(result feedResult) {
+		if result.duration > slowest.duration {
+			slowest = result
+		}
+		if !result.skipped {
+			fetches = append(fetches, w.saveResult(result))
+		}
+		atomic.AddInt32(w.pending, -1)
+	})
+
+	log.Printf("Finished refreshing %d feeds in %s", len(feeds), time.Since(start).Round(time.Millisecond))
+	if slowest.duration > 0 {
+		log.Printf("Slowest feed: %s (%s)", slowest.feed.FeedLink, slowest.duration.Round(time.Millisecond))
+	}
+	w.pauseFailingFeeds()
+	w.notifyRefreshDone(fetches, time.Since(start))
+	w.SyncMedia()
+}
+
+// Requests in flight & the start of the latest one per host,
+// shared by the refreshes running at the same time.
+type hostLimiter struct {
+	lock      sync.Mutex
+	active    map[string]int
+	lastStart map[string]time.Time
+}
+
+func newHostLimiter() *hostLimiter {
+	return &hostLimiter{
+		active:    make(map[string]int),
+		lastStart: make(map[string]time.Time),
+	}
+}
+
+// Take a slot of the host if the limits allow it. Otherwise returns the time
+// until the delay allows the next request, or 0 if all the slots are taken.
+func (l *hostLimiter) acquire(host string, limits fetchLimits) (bool, time.Duration) {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	if l.active[host] >= limits.hostConcurrency {
+		return false, 0
+	}
+	if wait := time.Until(l.lastStart[host].Add(limits.hostDelay)); wait > 0 {
+		return false, max(wait, time.Millisecond)
+	}
+	l.active[host]++
+	l.lastStart[host] = time.Now()
+	return true, 0
+}
+
+func (l *hostLimiter) release(host string) {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	l.active[host]--
+	if l.active[host] <= 0 {
+		delete(l.active, host)
+	}
+}
+
+// How often to check for the host slots taken by another refresh.
+const hostPollInterval = time.Millisecond * 100
+
+// Wait for a slot of the host, for the requests made outside of the dispatch.
+func (w *Worker) waitHost(host string, limits fetchLimits) {
+	for {
+		ok, delay := w.hosts.acquire(host, limits)
+		if ok {
+			return
+		}
+		if delay == 0 {
+			delay = hostPollInterval
+		}
+		time.Sleep(delay)
+	}
+}
+
+// Fetch the feeds within the limits, taking the hosts in turns,
+// so that a host with many feeds doesn't hold up the rest.
+// The results are passed to the callback one by one, as the fetches complete.
+func (w *Worker) dispatch(feeds []storage.Feed, limits fetchLimits, done func(feedResult)) {
+	hosts := make([]string, 0)
+	queues := make(map[string][]storage.Feed)
+	for _, feed := range feeds {
+		host := feedHost(feed)
+		if _, ok := queues[host]; !ok {
+			hosts = append(hosts, host)
+		}
+		queues[host] = append(queues[host], feed)
+	}
+
+	results := make(chan feedResult)
+	running := 0
+
+	for remaining := len(feeds); remaining > 0; {
+		// time until the next request may be allowed, if any host is waiting for it
+		wait := time.Duration(0)
+		for _, host := range hosts {
+			if running >= limits.concurrency {
+				break
+			}
+			if len(queues[host]) == 0 {
+				continue
+			}
+			ok, delay := w.hosts.acquire(host, limits)
+			if !ok {
+				if delay == 0 {
+					// the slots of the host may be freed by another refresh
+					delay = hostPollInterval
+				}
+				if wait == 0 || delay < wait {
+					wait = delay
+				}
+				continue
+			}
+			feed := queues[host][0]
+			queues[host] = queues[host][1:]
+			running++
+			go func() {
+				result := w.fetch(feed, host)
+				w.hosts.release(host)
+				// the pages take the slots of their own hosts, possibly the one of the feed
+				w.prepareItems(&result, limits)
+				results <- result
+			}()
+			if len(queues[host]) > 0 {
+				if delay := max(limits.hostDelay, time.Millisecond); wait == 0 || delay < wait {
+					wait = delay
+				}
+			}
+		}
+
+		var timer <-chan time.Time
+		if wait > 0 {
+			timer = time.After(wait)
+		}
+		select {
+		case result := <-results:
+			running--
+			remaining--
+			done(result)
+		case <-timer:
+		}
+	}
+}
+
+// Fetch the feed, unless it's being fetched already by another refresh.
+func (w *Worker) fetch(feed storage.Feed, host string) feedResult {
+	result := feedResult{feed: feed, host: host, start: time.Now()}
+	if !w.claimFeed(feed.Id) {
+		result.skipped = true
+		return result
+	}
+	defer w.releaseFeed(feed.Id)
+
+	result.items, result.err = listItems(feed, w.db, &result.stats, w.webSubCallback != "")
+	result.duration = time.Since(result.start)
+	result.size = len(result.items)
+	return result
+}
+
+// Apply the rules to the items & fetch their full content if the feed asks for it,
+// whether the items are polled or pushed by the hub.
+func (w *Worker) prepareItems(result *feedResult, limits fetchLimits) {
+	if len(result.items) > 0 {
+		result.items = w.db.ApplyRules(result.feed.Id, result.items)
+	}
+	if result.feed.FetchFullContent && len(result.items) > 0 {
+		w.fetchFullContent(result.feed, result.items, limits)
+	}
+}
+
+func (w *Worker) claimFeed(feedID int64) bool {
+	w.fetchingLock.Lock()
+	defer w.fetchingLock.Unlock()
+
+	if w.fetching[feedID] {
+		return false
+	}
+	w.fetching[feedID] = true
+	return true
+}
+
+func (w *Worker) releaseFeed(feedID int64) {
+	w.fetchingLock.Lock()
+	defer w.fetchingLock.Unlock()
+
+	delete(w.fetching, feedID)
+}
+
+func (w *Worker) saveResult(result feedResult) storage.FeedFetch {
+	fetch := storage.FeedFetch{
+		FeedID:   result.feed.Id,
+		Date:     result.start,
+		Status:   result.stats.status,
+		Duration: result.duration.Milliseconds(),
+		Bytes:    result.stats.bytes,
+	}
+	if result.err != nil {
+		w.db.SetFeedError(result.feed.Id, result.err)
+		fetch.Error = result.err.Error()
+	} else {
+		w.db.ResetFeedError(result.feed.Id)
+	}
+	if len(result.items) > 0 {
+		newItems := w.listNewItems(result.feed, result.items)
+		var ok bool
+		if fetch.Items, ok = w.db.CreateItems(result.items); ok {
+			w.notifyNewItems(result.feed, newItems)
+		}
+	}
+	if result.size > 0 {
+		w.db.SetFeedSize(result.feed.Id, result.size)
+	}
+	w.db.SetFeedChecked(result.feed.Id)
+	w.db.SetFeedFetchDuration(result.feed.Id, result.duration)
+	w.db.AddFeedFetch(fetch)
+	w.db.SyncSearch()
+	if fetch.Error != "" {
+		w.notifyFeedFailed(result.feed, fetch)
+	}
+	return fetch
+}
+
+// Items not stored yet, if any webhook is interested in them.
+func (w *Worker) listNewItems(feed storage.Feed, items []storage.Item) []storage.Item {
+	if len(w.db.ListWebhooksFor(storage.EventItemNew)) == 0 {
+		return nil
+	}
+	guids := make([]string, len(items))
+	for i, item := range items {
+		guids[i] = item.GUID
+	}
+	existing := w.db.ListExistingItemGUIDs(feed.Id, guids)
+	result := make([]storage.Item, 0)
+	for _, item := range items {
+		if !existing[item.GUID] {
+			result = append(result, item)
+		}
+	}
+	return result
+}
+
+func feedHost(feed storage.Feed) string {
+	return linkHost(feed.FeedLink)
+}
+
+func linkHost(link string) string {
+	if u, err := url.Parse(link); err == nil && u.Host != "" {
+		return strings.ToLower(u.Hostname())
+	}
+	return link
+}
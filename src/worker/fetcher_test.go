@@ -0,0 +1,173 @@
+package worker
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/nkanaev/yarr/src/storage"
+)
+
+func TestDispatchHostLimits(t *testing.T) {
+	var lock sync.Mutex
+	inflight, maxInflight := 0, 0
+	starts := make([]time.Time, 0)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		lock.Lock()
+		inflight++
+		maxInflight = max(maxInflight, inflight)
+		starts = append(starts, time.Now())
+		lock.Unlock()
+
+		time.Sleep(time.Millisecond * 100)
+		w.Write([]byte(`<?xml version="1.0"?><rss version="2.0"><channel></channel></rss>`))
+
+		lock.Lock()
+		inflight--
+		lock.Unlock()
+	}))
+	defer server.Close()
+
+	log.SetOutput(io.Discard)
+	defer log.SetOutput(os.Stderr)
+	db, _ := storage.New(":memory:")
+	w := NewWorker(db)
+	limits := fetchLimits{concurrency: 8, hostConcurrency: 2, hostDelay: time.Millisecond * 50}
+
+	// the scheduled & the on-demand refresh running at the same time
+	refreshes := make([][]storage.Feed, 2)
+	for i := 0; i < 8; i++ {
+		feed := db.CreateFeed("", "", "", fmt.Sprintf("%s/feed%d.xml", server.URL, i), nil)
+		refreshes[i%2] = append(refreshes[i%2], *feed)
+	}
+	var wg sync.WaitGroup
+	fetched := 0
+	start := time.Now()
+	for _, feeds := range refreshes {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			w.dispatch(feeds, limits, func(result feedResult) {
+				lock.Lock()
+				defer lock.Unlock()
+				if result.err == nil && !result.skipped {
+					fetched++
+				}
+			})
+		}()
+	}
+	wg.Wait()
+
+	if fetched != 8 || len(starts) != 8 {
+		t.Fatalf("expected 8 fetches, have %d (%d requests)", fetched, len(starts))
+	}
+	if maxInflight > limits.hostConcurrency {
+		t.Errorf("expected at most %d requests in flight, have %d", limits.hostConcurrency, maxInflight)
+	}
+	// the requests may arrive with a lag, but none before the delay after the previous one allows it
+	sort.Slice(starts, func(i, j int) bool { return starts[i].Before(starts[j]) })
+	if want := limits.hostDelay * time.Duration(len(starts)-1); starts[len(starts)-1].Sub(start) < want {
+		t.Errorf("expected the last request after %s, have %s", want, starts[len(starts)-1].Sub(start))
+	}
+}
+
+func TestRefreshFeedsIgnoresHints(t *testing.T) {
+	var lock sync.Mutex
+	requested := make(map[string]bool)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		lock.Lock()
+		requested[r.URL.Path] = true
+		lock.Unlock()
+		w.Write([]byte(`<?xml version="1.0"?><rss version="2.0"><channel></channel></rss>`))
+	}))
+	defer server.Close()
+
+	log.SetOutput(io.Discard)
+	defer log.SetOutput(os.Stderr)
+	// the refresh saves the results in the background, outside the connection of an in-memory db
+	db, err := storage.New(filepath.Join(t.TempDir(), "storage.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	w := NewWorker(db)
+
+	nextCheck := time.Now().Add(time.Hour)
+	retried := db.CreateFeed("", "", "", server.URL+"/retried.xml", nil)
+	db.SetFeedNextCheck(retried.Id, &nextCheck)
+	skipped := db.CreateFeed("", "", "", server.URL+"/skipped.xml", nil)
+	db.SetFeedSkipTimes(skipped.Id, nil, []time.Weekday{time.Now().UTC().Weekday()})
+	paused := db.CreateFeed("", "", "", server.URL+"/paused.xml", nil)
+	db.UpdateFeedPaused(paused.Id, true)
+
+	w.RefreshFeeds()
+	for deadline := time.Now().Add(time.Second * 5); w.FeedsPending() > 0; {
+		if time.Now().After(deadline) {
+			t.Fatal("the refresh takes too long")
+		}
+		time.Sleep(time.Millisecond * 10)
+	}
+
+	lock.Lock()
+	defer lock.Unlock()
+	for _, path := range []string{"/retried.xml", "/skipped.xml"} {
+		if !requested[path] {
+			t.Errorf("expected %s to be refreshed", path)
+		}
+	}
+	if requested["/paused.xml"] {
+		t.Error("expected the paused feed to be left out")
+	}
+}
+
+func TestDispatchFullContentHostLimits(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`<?xml version="1.0"?><rss version="2.0"><channel>` +
+			`<item><guid>1</guid><link>http://127.0.0.1/1</link></item>` +
+			`<item><guid>2</guid><link>http://127.0.0.1/2</link></item>` +
+			`<item><guid>3</guid><link>http://127.0.0.1/3</link></item>` +
+			`</channel></rss>`))
+	}))
+	defer server.Close()
+
+	log.SetOutput(io.Discard)
+	defer log.SetOutput(os.Stderr)
+	db, err := storage.New(filepath.Join(t.TempDir(), "storage.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	w := NewWorker(db)
+	limits := fetchLimits{concurrency: 8, hostConcurrency: 1, hostDelay: time.Millisecond * 50}
+
+	// the pages share the host with the feed, their requests fail right away being internal
+	feed := db.CreateFeed("", "", "", server.URL+"/feed.xml", nil)
+	feed.FetchFullContent = true
+	start := time.Now()
+	var result feedResult
+	finished := make(chan bool)
+	go func() {
+		w.dispatch([]storage.Feed{*feed}, limits, func(r feedResult) { result = r })
+		close(finished)
+	}()
+	select {
+	case <-finished:
+	case <-time.After(time.Second * 5):
+		t.Fatal("the full content is waiting for the slot of the feed")
+	}
+
+	if result.err != nil || len(result.items) != 3 {
+		t.Fatalf("unexpected result: %v, %d items", result.err, len(result.items))
+	}
+	// the feed & the 3 pages, a delay apart
+	if want := limits.hostDelay * 3; time.Since(start) < want {
+		t.Errorf("expected the pages to be requested after %s, have %s", want, time.Since(start))
+	}
+}
@@ -0,0 +1,99 @@
+package worker
+
+import (
+	"fmt"
+	"log"
+	"net"
+	"net/url"
+	"strings"
+
+	"github.com/nkanaev/yarr/src/content/htmlutil"
+	"github.com/nkanaev/yarr/src/content/readability"
+	"github.com/nkanaev/yarr/src/content/silo"
+	"github.com/nkanaev/yarr/src/storage"
+)
+
+// Maximum number of the new items of the feed to fetch the full content for in a single refresh.
+// The rest of them keep the content provided by the feed only.
+var fullContentLimit = 20
+
+// Extract the articles from the pages of the items not stored yet.
+// The pages are requested within the limits of their hosts.
+func (w *Worker) fetchFullContent(feed storage.Feed, items []storage.Item, limits fetchLimits) {
+	guids := make([]string, len(items))
+	for i, item := range items {
+		guids[i] = item.GUID
+	}
+	existing := w.db.ListExistingItemGUIDs(feed.Id, guids)
+	opts := w.db.GetFeedRequestOptions(feed.Id)
+
+	fetched := 0
+	for i := range items {
+		item := &items[i]
+		if existing[item.GUID] || !htmlutil.IsAPossibleLink(item.Link) {
+			continue
+		}
+		if fetched >= fullContentLimit {
+			break
+		}
+		fetched++
+		content, err := w.extractContent(item.Link, scopedOptions(opts, feed.FeedLink, item.Link), limits)
+		if err != nil {
+			log.Printf("Failed to fetch full content of %s: %s", item.Link, err)
+			continue
+		}
+		item.FullContent = &content
+	}
+}
+
+// Extract the article within the limits of the host of the page, unless no request is needed.
+func (w *Worker) extractContent(link string, opts *storage.RequestOptions, limits fetchLimits) (string, error) {
+	page := link
+	if newLink := silo.RedirectURL(link); newLink != "" {
+		page = newLink
+	}
+	if silo.VideoIFrame(page) == "" {
+		host := linkHost(page)
+		w.waitHost(host, limits)
+		defer w.hosts.release(host)
+	}
+	return ExtractContent(link, opts)
+}
+
+// Download the page & extract the article from it.
+func ExtractContent(link string, opts *storage.RequestOptions) (string, error) {
+	if newLink := silo.RedirectURL(link); newLink != "" {
+		link = newLink
+	}
+	if content := silo.VideoIFrame(link); content != "" {
+		return content, nil
+	}
+	if IsInternalURL(link) {
+		return "", fmt.Errorf("internal address: %s", link)
+	}
+	body, err := GetBody(link, opts)
+	if err != nil {
+		return "", err
+	}
+	return readability.ExtractContent(strings.NewReader(body))
+}
+
+// Check whether the url points to the local machine or the private network.
+func IsInternalURL(link string) bool {
+	parsedURL, err := url.Parse(link)
+	if err != nil {
+		return false
+	}
+
+	host := parsedURL.Hostname()
+	if host == "localhost" {
+		return true
+	}
+
+	ip := net.ParseIP(host)
+	if ip == nil {
+		return false
+	}
+
+	return ip.IsPrivate() || ip.IsLoopback() || ip.IsLinkLocalUnicast()
+}
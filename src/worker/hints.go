@@ -0,0 +1,72 @@
+package worker
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Upper bound of the delays requested by the publishers,
+// so that a misconfigured server doesn't stop the updates for good.
+const maxCheckDelay = maxRefreshInterval
+
+// Freshness lifetime of the response, set with `Cache-Control: max-age`
+// or, in its absence, with `Expires`.
+func cacheMaxAge(header http.Header, now time.Time) time.Duration {
+	for _, directive := range strings.Split(header.Get("Cache-Control"), ",") {
+		name, value, _ := strings.Cut(strings.TrimSpace(directive), "=")
+		switch strings.ToLower(name) {
+		case "no-cache", "no-store":
+			return 0
+		case "max-age":
+			seconds, err := strconv.ParseInt(strings.Trim(value, `"`), 10, 64)
+			if err != nil {
+				return 0
+			}
+			age, _ := strconv.ParseInt(header.Get("Age"), 10, 64)
+			return time.Duration(seconds-max(age, 0)) * time.Second
+		}
+	}
+	if expires := header.Get("Expires"); expires != "" {
+		expiresAt, err := http.ParseTime(expires)
+		if err != nil {
+			return 0
+		}
+		// relative to the server clock, if known
+		if date, err := http.ParseTime(header.Get("Date")); err == nil {
+			return expiresAt.Sub(date)
+		}
+		return expiresAt.Sub(now)
+	}
+	return 0
+}
+
+// `Retry-After` is either the number of seconds or the date.
+func retryAfter(header http.Header, now time.Time) time.Duration {
+	value := strings.TrimSpace(header.Get("Retry-After"))
+	if value == "" {
+		return 0
+	}
+	if seconds, err := strconv.ParseInt(value, 10, 64); err == nil {
+		return time.Duration(seconds) * time.Second
+	}
+	if date, err := http.ParseTime(value); err == nil {
+		return date.Sub(now)
+	}
+	return 0
+}
+
+// The time before which the feed should not be checked: the longest of the delays,
+// capped by `maxCheckDelay`. Nil if there is no delay.
+func nextCheckTime(now time.Time, delays ...time.Duration) *time.Time {
+	delay := time.Duration(0)
+	for _, d := range delays {
+		delay = max(delay, d)
+	}
+	if delay <= 0 {
+		return nil
+	}
+	nextCheck := now.Add(min(delay, maxCheckDelay))
+	return &nextCheck
+}
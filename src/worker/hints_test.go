@@ -0,0 +1,120 @@
+package worker
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/nkanaev/yarr/src/storage"
+)
+
+func TestCacheMaxAge(t *testing.T) {
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	date := now.Add(-time.Hour).Format(http.TimeFormat)
+
+	testcases := []struct {
+		header map[string]string
+		want   time.Duration
+	}{
+		{nil, 0},
+		{map[string]string{"Cache-Control": "max-age=600"}, time.Minute * 10},
+		{map[string]string{"Cache-Control": `public, max-age="600"`}, time.Minute * 10},
+		{map[string]string{"Cache-Control": "max-age=600", "Age": "100"}, time.Second * 500},
+		{map[string]string{"Cache-Control": "max-age=600", "Age": "-100"}, time.Minute * 10},
+		{map[string]string{"Cache-Control": "max-age=abc"}, 0},
+		{map[string]string{"Cache-Control": "no-cache, max-age=600"}, 0},
+		{map[string]string{"Cache-Control": "no-store"}, 0},
+		// max-age takes precedence over expires
+		{map[string]string{"Cache-Control": "max-age=60", "Expires": now.Add(time.Hour).Format(http.TimeFormat)}, time.Minute},
+		{map[string]string{"Expires": now.Add(time.Hour).Format(http.TimeFormat)}, time.Hour},
+		// relative to the server clock
+		{map[string]string{"Expires": now.Format(http.TimeFormat), "Date": date}, time.Hour},
+		{map[string]string{"Expires": "0"}, 0},
+	}
+	for i, tc := range testcases {
+		header := http.Header{}
+		for name, value := range tc.header {
+			header.Set(name, value)
+		}
+		if have := cacheMaxAge(header, now); have != tc.want {
+			t.Errorf("#%d %v: want %s, have %s", i, tc.header, tc.want, have)
+		}
+	}
+}
+
+func TestRetryAfter(t *testing.T) {
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+
+	testcases := []struct {
+		value string
+		want  time.Duration
+	}{
+		{"", 0},
+		{"120", time.Minute * 2},
+		{" 120 ", time.Minute * 2},
+		{now.Add(time.Hour).Format(http.TimeFormat), time.Hour},
+		{now.Add(-time.Hour).Format(http.TimeFormat), -time.Hour},
+		{"soon", 0},
+	}
+	for _, tc := range testcases {
+		header := http.Header{}
+		header.Set("Retry-After", tc.value)
+		if have := retryAfter(header, now); have != tc.want {
+			t.Errorf("%q: want %s, have %s", tc.value, tc.want, have)
+		}
+	}
+}
+
+func TestNextCheckTime(t *testing.T) {
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+
+	testcases := []struct {
+		delays []time.Duration
+		want   time.Duration
+	}{
+		{nil, 0},
+		{[]time.Duration{0, -time.Hour}, 0},
+		{[]time.Duration{time.Minute, time.Hour, 0}, time.Hour},
+		{[]time.Duration{maxCheckDelay * 2}, maxCheckDelay},
+	}
+	for _, tc := range testcases {
+		have := nextCheckTime(now, tc.delays...)
+		if tc.want == 0 {
+			if have != nil {
+				t.Errorf("%v: want nil, have %s", tc.delays, have)
+			}
+			continue
+		}
+		if have == nil || !have.Equal(now.Add(tc.want)) {
+			t.Errorf("%v: want %s, have %v", tc.delays, now.Add(tc.want), have)
+		}
+	}
+}
+
+func TestRefreshInterval(t *testing.T) {
+	duration := func(d time.Duration) *time.Duration { return &d }
+	custom := int64(90)
+	base := time.Hour
+
+	testcases := []struct {
+		feed     storage.Feed
+		schedule storage.FeedSchedule
+		base     time.Duration
+		want     time.Duration
+	}{
+		{storage.Feed{}, storage.FeedSchedule{}, base, base},
+		{storage.Feed{}, storage.FeedSchedule{}, 0, 0},
+		{storage.Feed{RefreshInterval: &custom}, storage.FeedSchedule{}, 0, time.Minute * 90},
+		{storage.Feed{}, storage.FeedSchedule{PostInterval: duration(time.Hour * 4)}, base, time.Hour * 2},
+		// clamped to a quarter of the default interval, not shorter than the minimum
+		{storage.Feed{}, storage.FeedSchedule{PostInterval: duration(time.Minute)}, base, time.Minute * 15},
+		{storage.Feed{}, storage.FeedSchedule{PostInterval: duration(time.Minute)}, time.Minute * 10, minRefreshInterval},
+		// clamped to the maximum
+		{storage.Feed{}, storage.FeedSchedule{PostInterval: duration(time.Hour * 24 * 30)}, base, maxRefreshInterval},
+	}
+	for i, tc := range testcases {
+		if have := refreshInterval(tc.feed, tc.schedule, tc.base); have != tc.want {
+			t.Errorf("#%d: want %s, have %s", i, tc.want, have)
+		}
+	}
+}
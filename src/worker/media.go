@@ -0,0 +1,213 @@
+package worker
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"mime"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/nkanaev/yarr/src/storage"
+)
+
+// Time limit of a single download, the episodes may take a while.
+var mediaDownloadTimeout = time.Hour
+
+var mediaExtRegex = regexp.MustCompile(`^\.[a-zA-Z0-9]{1,5}$`)
+
+// Directory keeping the downloaded enclosures, empty if the downloads are disabled.
+func (w *Worker) SetMediaDir(dir string) {
+	w.mediaLock.Lock()
+	defer w.mediaLock.Unlock()
+	w.mediaDir = dir
+}
+
+// Download the pending enclosures now & after every refresh.
+func (w *Worker) StartMediaDownloads(dir string) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		log.Printf("Failed to create media dir %s: %s", dir, err)
+		return
+	}
+	w.SetMediaDir(dir)
+	go w.SyncMedia()
+}
+
+// Absolute path of the downloaded file, empty if the downloads are disabled.
+func (w *Worker) MediaFile(m storage.ItemMedia) string {
+	w.mediaLock.Lock()
+	dir := w.mediaDir
+	w.mediaLock.Unlock()
+	if dir == "" || m.Path == "" {
+		return ""
+	}
+	return filepath.Join(dir, filepath.FromSlash(m.Path))
+}
+
+// Queue the enclosures of the feeds with the downloads enabled, download them
+// & delete the files no longer needed. Only one sync runs at a time.
+func (w *Worker) SyncMedia() {
+	w.mediaLock.Lock()
+	dir := w.mediaDir
+	if dir == "" || w.mediaSyncing {
+		w.mediaLock.Unlock()
+		return
+	}
+	w.mediaSyncing = true
+	w.mediaLock.Unlock()
+	defer func() {
+		w.mediaLock.Lock()
+		w.mediaSyncing = false
+		w.mediaLock.Unlock()
+	}()
+
+	feeds := make(map[int64]storage.Feed)
+	for _, feed := range w.db.ListFeeds() {
+		if feed.MediaDownload != nil {
+			feeds[feed.Id] = feed
+			w.db.QueueFeedMedia(feed.Id, *feed.MediaDownload)
+		}
+	}
+	for _, m := range w.db.ListPendingMedia() {
+		feed, ok := feeds[m.FeedID]
+		if !ok {
+			continue
+		}
+		w.downloadMedia(dir, feed, m)
+	}
+	for _, feed := range feeds {
+		if feed.MediaDownload.MaxCount > 0 {
+			for _, m := range w.db.ListExpiredMedia(feed.Id, feed.MediaDownload.MaxCount) {
+				removeMediaFile(dir, m)
+				m.Status = storage.MediaRemoved
+				m.Path = ""
+				w.db.UpdateItemMedia(m)
+			}
+		}
+	}
+	w.cleanupMedia(dir)
+}
+
+// Delete the files of the items deleted since.
+func (w *Worker) cleanupMedia(dir string) {
+	for _, m := range w.db.ListOrphanedMedia() {
+		removeMediaFile(dir, m)
+		w.db.DeleteItemMedia(m.Id)
+	}
+}
+
+func removeMediaFile(dir string, m storage.ItemMedia) {
+	if m.Path == "" {
+		return
+	}
+	if err := os.Remove(filepath.Join(dir, filepath.FromSlash(m.Path))); err != nil && !os.IsNotExist(err) {
+		log.Print(err)
+	}
+}
+
+func (w *Worker) downloadMedia(dir string, feed storage.Feed, m storage.ItemMedia) {
+	var maxSize int64
+	if feed.MediaDownload.MaxSize > 0 {
+		maxSize = feed.MediaDownload.MaxSize * 1024 * 1024
+	}
+	opts := w.FeedRequestOptions(feed, m.URL)
+	name, contentType, size, err := fetchMedia(dir, feed, m, maxSize, opts)
+	m.Error = ""
+	switch {
+	case err == errMediaTooLarge:
+		m.Status = storage.MediaSkipped
+		m.Error = err.Error()
+	case err != nil:
+		m.Status = storage.MediaFailed
+		m.Error = err.Error()
+		log.Printf("Failed to download %s: %s", m.URL, err)
+	default:
+		now := time.Now().UTC()
+		m.Status = storage.MediaDone
+		m.Path = name
+		m.ContentType = contentType
+		m.Size = size
+		m.DownloadedAt = &now
+	}
+	w.db.UpdateItemMedia(m)
+}
+
+var errMediaTooLarge = errors.New("larger than the size limit")
+
+// Download the enclosure into the directory of the feed.
+// Returns the path of the file relative to the media directory, its content type & size.
+func fetchMedia(dir string, feed storage.Feed, m storage.ItemMedia, maxSize int64, opts *storage.RequestOptions) (string, string, int64, error) {
+	req, err := client.newRequest("GET", m.URL, nil, opts)
+	if err != nil {
+		return "", "", 0, err
+	}
+	httpClient := &http.Client{
+		Transport:     mediaTransport,
+		CheckRedirect: client.httpClient.CheckRedirect,
+		Timeout:       mediaDownloadTimeout,
+	}
+	res, err := httpClient.Do(req)
+	if err != nil {
+		return "", "", 0, err
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		return "", "", 0, fmt.Errorf("status code %d", res.StatusCode)
+	}
+	if maxSize > 0 && res.ContentLength > maxSize {
+		return "", "", 0, errMediaTooLarge
+	}
+
+	feedDir := filepath.Join(dir, strconv.FormatInt(feed.Id, 10))
+	if err := os.MkdirAll(feedDir, 0755); err != nil {
+		return "", "", 0, err
+	}
+	tmp, err := os.CreateTemp(feedDir, ".download-*")
+	if err != nil {
+		return "", "", 0, err
+	}
+	defer os.Remove(tmp.Name())
+
+	var body io.Reader = res.Body
+	if maxSize > 0 {
+		body = io.LimitReader(res.Body, maxSize+1)
+	}
+	size, err := io.Copy(tmp, body)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return "", "", 0, err
+	}
+	if maxSize > 0 && size > maxSize {
+		return "", "", 0, errMediaTooLarge
+	}
+
+	contentType := res.Header.Get("Content-Type")
+	name := fmt.Sprintf("%d-%d%s", m.ItemID, m.Id, mediaExt(m.URL, contentType))
+	if err := os.Rename(tmp.Name(), filepath.Join(feedDir, name)); err != nil {
+		return "", "", 0, err
+	}
+	return path.Join(strconv.FormatInt(feed.Id, 10), name), contentType, size, nil
+}
+
+// Extension of the file, taken from the url or the content type.
+func mediaExt(link, contentType string) string {
+	if u, err := url.Parse(link); err == nil {
+		if ext := path.Ext(u.Path); mediaExtRegex.MatchString(ext) {
+			return strings.ToLower(ext)
+		}
+	}
+	if exts, err := mime.ExtensionsByType(contentType); err == nil && len(exts) > 0 {
+		return exts[0]
+	}
+	return ""
+}
@@ -0,0 +1,49 @@
+package worker
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/nkanaev/yarr/src/storage"
+)
+
+func TestFetchMediaInternal(t *testing.T) {
+	feed := storage.Feed{Id: 1, FeedLink: "http://example.com/feed.xml"}
+	links := []string{
+		"http://localhost/episode.mp3",
+		"http://127.0.0.1:8080/episode.mp3",
+		"http://192.168.1.1/episode.mp3",
+		"http://[::1]/episode.mp3",
+	}
+	for _, link := range links {
+		m := storage.ItemMedia{Id: 1, ItemID: 1, URL: link}
+		_, _, _, err := fetchMedia(t.TempDir(), feed, m, 0, nil)
+		if err == nil || !strings.Contains(err.Error(), "internal address") {
+			t.Errorf("%s: expected internal address error, have %v", link, err)
+		}
+	}
+}
+
+func TestFetchMediaRedirectInternal(t *testing.T) {
+	internal := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("secret"))
+	}))
+	defer internal.Close()
+	public := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, internal.URL+"/admin", http.StatusFound)
+	}))
+	defer public.Close()
+
+	// the test servers are local, only the one redirecting is taken for a public one
+	defer func(allowed func(string) bool) { publicAddress = allowed }(publicAddress)
+	publicAddress = func(address string) bool { return address == public.Listener.Addr().String() }
+
+	feed := storage.Feed{Id: 1, FeedLink: "http://example.com/feed.xml"}
+	m := storage.ItemMedia{Id: 1, ItemID: 1, URL: public.URL + "/episode.mp3"}
+	_, _, _, err := fetchMedia(t.TempDir(), feed, m, 0, nil)
+	if err == nil || !strings.Contains(err.Error(), "internal address") {
+		t.Fatalf("expected internal address error, have %v", err)
+	}
+}
@@ -0,0 +1,65 @@
+package worker
+
+import (
+	"log"
+	"net/http"
+
+	"github.com/nkanaev/yarr/src/parser"
+	"github.com/nkanaev/yarr/src/storage"
+)
+
+// Number of the consecutive fetches the feed has to point to the same new location
+// before its url is updated, so that a misconfigured server doesn't move it for good.
+const feedMoveConfirmations = 3
+
+// Track the signs of the feed having moved to another url, and update the url once confirmed.
+func trackFeedMove(res *http.Response, feed *parser.Feed, f storage.Feed, db *storage.Storage) {
+	prevSelf := ""
+	if feed.SelfURL != "" {
+		prevSelf = db.SetFeedSelfLink(f.Id, feed.SelfURL)
+	}
+
+	url, reason := "", ""
+	switch redirect := permanentRedirect(res); {
+	case redirect != "" && redirect != f.FeedLink:
+		url, reason = redirect, "permanent redirect"
+	case feed.NewFeedURL != "" && feed.NewFeedURL != f.FeedLink:
+		url, reason = feed.NewFeedURL, "itunes:new-feed-url"
+	// self links are often out of date, so only a change of them starts the move,
+	// which then holds for as long as the self link stays the same
+	case feed.SelfURL != "" && feed.SelfURL != f.FeedLink &&
+		(prevSelf != "" && feed.SelfURL != prevSelf || feed.SelfURL == db.FeedMoveURL(f.Id)):
+		url, reason = feed.SelfURL, "self link"
+	}
+
+	if hits := db.TrackFeedMove(f.Id, url, reason); hits >= feedMoveConfirmations {
+		if db.MoveFeed(f.Id, url) {
+			log.Printf("Feed %s moved to %s (%s)", f.FeedLink, url, reason)
+		}
+	}
+}
+
+// Target of the permanent redirects the request went through, empty if there were none.
+// The redirects following a temporary one don't count.
+func permanentRedirect(res *http.Response) string {
+	// requests from the last to the original one
+	chain := make([]*http.Request, 0)
+	for req := res.Request; req != nil; {
+		chain = append(chain, req)
+		if req.Response == nil {
+			break
+		}
+		req = req.Response.Request
+	}
+
+	target := ""
+	for i := len(chain) - 2; i >= 0; i-- {
+		// response to the previous request, redirecting to this one
+		status := chain[i].Response.StatusCode
+		if status != http.StatusMovedPermanently && status != http.StatusPermanentRedirect {
+			break
+		}
+		target = chain[i].URL.String()
+	}
+	return target
+}
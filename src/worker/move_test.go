@@ -0,0 +1,145 @@
+package worker
+
+import (
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/nkanaev/yarr/src/parser"
+	"github.com/nkanaev/yarr/src/storage"
+)
+
+func redirectServer() *httptest.Server {
+	redirects := map[string]struct {
+		status int
+		to     string
+	}{
+		"/old":   {http.StatusMovedPermanently, "/new"},
+		"/chain": {http.StatusPermanentRedirect, "/old"},
+		"/temp":  {http.StatusFound, "/old"},
+		"/mixed": {http.StatusMovedPermanently, "/temp"},
+	}
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if redirect, ok := redirects[r.URL.Path]; ok {
+			http.Redirect(w, r, redirect.to, redirect.status)
+			return
+		}
+		w.Write([]byte("ok"))
+	}))
+}
+
+func TestPermanentRedirect(t *testing.T) {
+	server := redirectServer()
+	defer server.Close()
+
+	testcases := map[string]string{
+		"/new":   "",
+		"/old":   "/new",
+		"/chain": "/new",
+		// the redirects following a temporary one don't count
+		"/temp":  "",
+		"/mixed": "/temp",
+	}
+	for path, want := range testcases {
+		res, err := http.Get(server.URL + path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		res.Body.Close()
+		if want != "" {
+			want = server.URL + want
+		}
+		if have := permanentRedirect(res); have != want {
+			t.Errorf("%s: want %q, have %q", path, want, have)
+		}
+	}
+}
+
+func TestTrackFeedMove(t *testing.T) {
+	server := redirectServer()
+	defer server.Close()
+
+	log.SetOutput(io.Discard)
+	defer log.SetOutput(os.Stderr)
+	db, _ := storage.New(":memory:")
+	feed := db.CreateFeed("feed", "", "", server.URL+"/old", nil)
+
+	for i := 1; i <= feedMoveConfirmations; i++ {
+		res, err := http.Get(feed.FeedLink)
+		if err != nil {
+			t.Fatal(err)
+		}
+		res.Body.Close()
+		trackFeedMove(res, &parser.Feed{}, *feed, db)
+
+		have := db.GetFeed(feed.Id).FeedLink
+		if i < feedMoveConfirmations && have != server.URL+"/old" {
+			t.Fatalf("feed moved after %d redirects: %s", i, have)
+		}
+		if i == feedMoveConfirmations && have != server.URL+"/new" {
+			t.Fatalf("feed not moved after %d redirects: %s", i, have)
+		}
+	}
+
+	// the url of another feed, the conflict is reported once
+	other := db.CreateFeed("other", "", "", server.URL+"/mixed", nil)
+	db.CreateFeed("temp", "", "", server.URL+"/temp", nil)
+	var logs strings.Builder
+	log.SetOutput(&logs)
+	for i := 0; i < feedMoveConfirmations*2; i++ {
+		res, err := http.Get(other.FeedLink)
+		if err != nil {
+			t.Fatal(err)
+		}
+		res.Body.Close()
+		trackFeedMove(res, &parser.Feed{}, *other, db)
+	}
+	if have := db.GetFeed(other.Id).FeedLink; have != server.URL+"/mixed" {
+		t.Fatalf("feed moved to the url of another feed: %s", have)
+	}
+	if count := strings.Count(logs.String(), "not moved"); count != 1 {
+		t.Fatalf("expected the conflict to be reported once, have:\n%s", logs.String())
+	}
+}
+
+func TestTrackFeedMoveSelfLink(t *testing.T) {
+	server := redirectServer()
+	defer server.Close()
+
+	log.SetOutput(io.Discard)
+	defer log.SetOutput(os.Stderr)
+	db, _ := storage.New(":memory:")
+	feed := db.CreateFeed("feed", "", "", server.URL+"/new", nil)
+	fetch := func(self string) {
+		res, err := http.Get(feed.FeedLink)
+		if err != nil {
+			t.Fatal(err)
+		}
+		res.Body.Close()
+		trackFeedMove(res, &parser.Feed{SelfURL: self}, *db.GetFeed(feed.Id), db)
+	}
+
+	// an outdated self link doesn't move the feed
+	for i := 0; i < feedMoveConfirmations; i++ {
+		fetch("http://example.com/outdated.xml")
+	}
+	if have := db.GetFeed(feed.Id).FeedLink; have != server.URL+"/new" {
+		t.Fatalf("feed moved to the outdated self link: %s", have)
+	}
+
+	// the changed one does once repeated
+	for i := 1; i <= feedMoveConfirmations; i++ {
+		fetch("http://example.com/moved.xml")
+		have := db.GetFeed(feed.Id).FeedLink
+		if i < feedMoveConfirmations && have != server.URL+"/new" {
+			t.Fatalf("feed moved after %d fetches: %s", i, have)
+		}
+		if i == feedMoveConfirmations && have != "http://example.com/moved.xml" {
+			t.Fatalf("feed not moved after %d fetches: %s", i, have)
+		}
+	}
+}
@@ -0,0 +1,122 @@
+package worker
+
+import (
+	"log"
+	"sync/atomic"
+	"time"
+
+	"github.com/nkanaev/yarr/src/storage"
+)
+
+const (
+	schedulerTick = time.Minute
+
+	// bounds of the adaptive refresh interval
+	minRefreshInterval = time.Minute * 5
+	maxRefreshInterval = time.Hour * 24
+
+	// the refresh interval of the failing feeds doubles with each failure up to this one
+	maxBackoffInterval = time.Hour * 48
+	// failing feeds are paused after this number of failures at least, however long they fail
+	minFailuresToPause = 3
+)
+
+// Set the default refresh interval and start the scheduler, if not running yet.
+func (w *Worker) SetRefreshRate(minute int64) {
+	atomic.StoreInt64(w.refreshRate, minute)
+	log.Printf("auto-refresh: default interval %dm", minute)
+
+	w.scheduler.Do(func() {
+		go func() {
+			ticker := time.NewTicker(schedulerTick)
+			for {
+				w.refreshDueFeeds()
+				<-ticker.C
+			}
+		}()
+	})
+}
+
+// Refresh the feeds whose refresh interval has elapsed since the last check.
+func (w *Worker) refreshDueFeeds() {
+	if *w.pending > 0 {
+		return
+	}
+	base := time.Duration(atomic.LoadInt64(w.refreshRate)) * time.Minute
+	schedules := w.db.ListFeedSchedules()
+	now := time.Now()
+
+	pushed := make(map[int64]bool)
+	for _, sub := range w.db.ListWebSubs() {
+		pushed[sub.FeedID] = webSubActive(sub, now)
+	}
+
+	due := make([]storage.Feed, 0)
+	for _, feed := range w.db.ListFeeds() {
+		if feed.PausedAt != nil {
+			continue
+		}
+		schedule := schedules[feed.Id]
+		interval := refreshInterval(feed, schedule, base)
+		if interval > 0 && pushed[feed.Id] {
+			interval = max(interval, webSubRefreshInterval)
+		}
+		interval = backoffInterval(interval, schedule.Failures)
+		if interval > 0 && !now.Before(schedule.LastCheck.Add(interval)) && checkAllowed(schedule, now) {
+			due = append(due, feed)
+		}
+	}
+	if len(due) > 0 {
+		w.refreshFeeds(due)
+	}
+}
+
+// Whether the publisher hints (caching headers, rate limits, ttl, skip hours)
+// allow to check the feed at the given time.
+func checkAllowed(schedule storage.FeedSchedule, now time.Time) bool {
+	if schedule.NextCheck != nil && now.Before(*schedule.NextCheck) {
+		return false
+	}
+	return !schedule.Skips(now)
+}
+
+// The refresh interval doubled with each consecutive failure, up to `maxBackoffInterval`.
+func backoffInterval(interval time.Duration, failures int) time.Duration {
+	if interval <= 0 || interval >= maxBackoffInterval {
+		return interval
+	}
+	for i := 0; i < failures && interval < maxBackoffInterval; i++ {
+		interval *= 2
+	}
+	return min(interval, maxBackoffInterval)
+}
+
+// Pause the feeds failing for longer than set in the settings.
+func (w *Worker) pauseFailingFeeds() {
+	days := w.db.GetSettingsValueInt64("auto_pause_days")
+	if days <= 0 {
+		return
+	}
+	failingBefore := time.Now().Add(-time.Hour * 24 * time.Duration(days))
+	for _, feed := range w.db.PauseFailingFeeds(minFailuresToPause, failingBefore) {
+		log.Printf("Paused feed %s: failing for more than %d days", feed.FeedLink, days)
+	}
+}
+
+// The refresh interval of the feed: either the one set for the feed, or the one
+// adapted to the posting frequency (checking about twice per post), which stays
+// within a range around the default interval. Zero disables the refresh.
+func refreshInterval(feed storage.Feed, schedule storage.FeedSchedule, base time.Duration) time.Duration {
+	if feed.RefreshInterval != nil && *feed.RefreshInterval > 0 {
+		return time.Duration(*feed.RefreshInterval) * time.Minute
+	}
+	if base <= 0 {
+		return 0
+	}
+	if schedule.PostInterval == nil {
+		return base
+	}
+	lower := min(base, max(base/4, minRefreshInterval))
+	upper := max(base, maxRefreshInterval)
+	return min(max(*schedule.PostInterval/2, lower), upper)
+}
@@ -0,0 +1,242 @@
+package worker
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"strconv"
+	"time"
+
+	"github.com/nkanaev/yarr/src/storage"
+)
+
+// Delays before the repeated attempts to deliver the payload to the webhook.
+// The attempts are scheduled in the delivery log, so they survive restarts.
+var webhookRetryDelays = []time.Duration{time.Minute, 10 * time.Minute, time.Hour}
+
+// How often to check the delivery log for the attempts due.
+const webhookRetryTick = time.Minute
+
+type webhookPayload struct {
+	Event string      `json:"event"`
+	Date  time.Time   `json:"date"`
+	Data  interface{} `json:"data"`
+}
+
+type webhookFeed struct {
+	ID       int64  `json:"id"`
+	Title    string `json:"title"`
+	Link     string `json:"link"`
+	FeedLink string `json:"feed_link"`
+}
+
+type webhookItem struct {
+	ID         int64    `json:"id,omitempty"`
+	FeedID     int64    `json:"feed_id"`
+	GUID       string   `json:"guid"`
+	Title      string   `json:"title"`
+	Link       string   `json:"link"`
+	Date       string   `json:"date"`
+	Author     string   `json:"author,omitempty"`
+	Categories []string `json:"categories,omitempty"`
+}
+
+func newWebhookFeed(feed storage.Feed) webhookFeed {
+	return webhookFeed{ID: feed.Id, Title: feed.Title, Link: feed.Link, FeedLink: feed.FeedLink}
+}
+
+func newWebhookItem(item storage.Item) webhookItem {
+	return webhookItem{
+		ID:         item.Id,
+		FeedID:     item.FeedId,
+		GUID:       item.GUID,
+		Title:      item.Title,
+		Link:       item.Link,
+		Date:       item.Date.UTC().Format(time.RFC3339),
+		Author:     item.Author,
+		Categories: item.Categories,
+	}
+}
+
+// Random secret for signing the payloads of the new webhook.
+func NewWebhookSecret() string {
+	buf := make([]byte, 24)
+	if _, err := rand.Read(buf); err != nil {
+		log.Print(err)
+	}
+	return hex.EncodeToString(buf)
+}
+
+// Signature of the payload: `sha256=hex(hmac(secret, body))`.
+func WebhookSignature(secret string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// Send the new items of the feed matching the filters of the webhooks.
+// The items are the ones returned by `listNewItems`, sent as stored once inserted.
+func (w *Worker) notifyNewItems(feed storage.Feed, items []storage.Item) {
+	hooks := w.db.ListWebhooksFor(storage.EventItemNew)
+	if len(hooks) == 0 || len(items) == 0 {
+		return
+	}
+	guids := make([]string, len(items))
+	for i, item := range items {
+		guids[i] = item.GUID
+	}
+	ids := make([]int64, 0, len(items))
+	for _, id := range w.db.ListItemIDsByGUID(feed.Id, guids) {
+		ids = append(ids, id)
+	}
+	if len(ids) == 0 {
+		return
+	}
+	items = w.db.ListItems(storage.ItemFilter{IDs: &ids}, len(ids), false, true)
+	var folderFeeds map[int64][]int64
+	for _, hook := range hooks {
+		if len(hook.Filter.FolderIDs) > 0 && folderFeeds == nil {
+			folderFeeds = w.db.ListFolderFeedIDs()
+		}
+		matched := make([]webhookItem, 0)
+		for _, item := range items {
+			if hook.Filter.Match(item, folderFeeds) {
+				matched = append(matched, newWebhookItem(item))
+			}
+		}
+		if len(matched) > 0 {
+			w.sendWebhook(hook, storage.EventItemNew, map[string]interface{}{
+				"feed":  newWebhookFeed(feed),
+				"items": matched,
+			})
+		}
+	}
+}
+
+// Notify the webhooks of the item starred by the user.
+func (w *Worker) NotifyItemStarred(item storage.Item) {
+	for _, hook := range w.db.ListWebhooksFor(storage.EventItemStarred) {
+		w.sendWebhook(hook, storage.EventItemStarred, map[string]interface{}{
+			"item": newWebhookItem(item),
+		})
+	}
+}
+
+func (w *Worker) notifyFeedFailed(feed storage.Feed, fetch storage.FeedFetch) {
+	for _, hook := range w.db.ListWebhooksFor(storage.EventFeedFailed) {
+		w.sendWebhook(hook, storage.EventFeedFailed, map[string]interface{}{
+			"feed":   newWebhookFeed(feed),
+			"status": fetch.Status,
+			"error":  fetch.Error,
+		})
+	}
+}
+
+func (w *Worker) notifyRefreshDone(fetches []storage.FeedFetch, duration time.Duration) {
+	hooks := w.db.ListWebhooksFor(storage.EventRefreshDone)
+	if len(hooks) == 0 {
+		return
+	}
+	failed, newItems := 0, 0
+	for _, fetch := range fetches {
+		if fetch.Error != "" {
+			failed++
+		}
+		newItems += fetch.Items
+	}
+	for _, hook := range hooks {
+		w.sendWebhook(hook, storage.EventRefreshDone, map[string]interface{}{
+			"feeds":       len(fetches),
+			"failed":      failed,
+			"new_items":   newItems,
+			"duration_ms": duration.Milliseconds(),
+		})
+	}
+}
+
+// Record the delivery & send it in the background. The failed attempts are retried by `StartWebhooks`.
+func (w *Worker) sendWebhook(hook storage.Webhook, event string, data interface{}) {
+	now := time.Now()
+	body, err := json.Marshal(webhookPayload{Event: event, Date: now.UTC(), Data: data})
+	if err != nil {
+		log.Print(err)
+		return
+	}
+	// in case the first attempt doesn't complete
+	retryAt := now.Add(webhookRetryDelays[0])
+	delivery := w.db.CreateWebhookDelivery(storage.WebhookDelivery{
+		WebhookID:     hook.Id,
+		Event:         event,
+		Payload:       body,
+		CreatedAt:     now,
+		NextAttemptAt: &retryAt,
+	})
+	if delivery == nil {
+		return
+	}
+	go w.deliverWebhook(hook, *delivery)
+}
+
+// Retry the failed deliveries once due, including the ones scheduled before a restart.
+func (w *Worker) StartWebhooks() {
+	go func() {
+		ticker := time.NewTicker(webhookRetryTick)
+		for {
+			<-ticker.C
+			w.retryWebhooks()
+		}
+	}()
+}
+
+func (w *Worker) retryWebhooks() {
+	for _, delivery := range w.db.ListDueWebhookDeliveries(time.Now()) {
+		if hook := w.db.GetWebhook(delivery.WebhookID); hook != nil {
+			w.deliverWebhook(*hook, delivery)
+		}
+	}
+}
+
+// Make an attempt to deliver the payload & schedule the next one if it fails.
+func (w *Worker) deliverWebhook(hook storage.Webhook, delivery storage.WebhookDelivery) {
+	delivery.Attempts++
+	delivery.Status, delivery.Error = postWebhook(hook, delivery)
+	now := time.Now()
+	delivery.NextAttemptAt = nil
+	if delivery.Error == "" {
+		delivery.DeliveredAt = &now
+	} else if delivery.Attempts <= len(webhookRetryDelays) {
+		retryAt := now.Add(webhookRetryDelays[delivery.Attempts-1])
+		delivery.NextAttemptAt = &retryAt
+	} else {
+		log.Printf("Failed to deliver %s to %s: %s", delivery.Event, hook.URL, delivery.Error)
+	}
+	w.db.UpdateWebhookDelivery(delivery)
+}
+
+// Post the payload. Returns the status code & the error, if any.
+func postWebhook(hook storage.Webhook, delivery storage.WebhookDelivery) (int, string) {
+	req, err := client.newRequest("POST", hook.URL, bytes.NewReader(delivery.Payload), nil)
+	if err != nil {
+		return 0, err.Error()
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Yarr-Event", delivery.Event)
+	req.Header.Set("X-Yarr-Delivery", strconv.FormatInt(delivery.Id, 10))
+	req.Header.Set("X-Yarr-Signature", WebhookSignature(hook.Secret, delivery.Payload))
+	res, err := client.httpClient.Do(req)
+	if err != nil {
+		return 0, err.Error()
+	}
+	defer res.Body.Close()
+	io.Copy(io.Discard, res.Body)
+	if res.StatusCode < 200 || res.StatusCode >= 300 {
+		return res.StatusCode, fmt.Sprintf("status code %d", res.StatusCode)
+	}
+	return res.StatusCode, ""
+}
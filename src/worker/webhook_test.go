@@ -0,0 +1,120 @@
+package worker
+
+import (
+	"encoding/json"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/nkanaev/yarr/src/storage"
+)
+
+func TestNotifyNewItems(t *testing.T) {
+	bodies := make(chan []byte, 10)
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		bodies <- body
+	}))
+	defer receiver.Close()
+
+	log.SetOutput(io.Discard)
+	defer log.SetOutput(os.Stderr)
+	// a file db, the :memory: one isn't shared by the connections
+	db, _ := storage.New(filepath.Join(t.TempDir(), "storage.db"))
+	w := NewWorker(db)
+	feed := db.CreateFeed("feed", "", "", "http://example.com/feed.xml", nil)
+	db.CreateItems([]storage.Item{{GUID: "old", FeedId: feed.Id, Title: "Old", Date: time.Now()}})
+	db.CreateWebhook(storage.Webhook{URL: receiver.URL, Events: storage.WebhookEvents{storage.EventItemNew}, Enabled: true})
+
+	w.saveResult(feedResult{feed: *feed, start: time.Now(), items: []storage.Item{
+		{GUID: "old", FeedId: feed.Id, Title: "Old", Date: time.Now()},
+		{GUID: "new", FeedId: feed.Id, Title: "New", Date: time.Now()},
+	}})
+
+	var payload struct {
+		Data struct {
+			Items []webhookItem `json:"items"`
+		} `json:"data"`
+	}
+	select {
+	case body := <-bodies:
+		if err := json.Unmarshal(body, &payload); err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("webhook not delivered")
+	}
+	items := payload.Data.Items
+	if len(items) != 1 || items[0].GUID != "new" {
+		t.Fatalf("invalid items: %#v", items)
+	}
+	stored := db.ListItemIDsByGUID(feed.Id, []string{"new"})
+	if items[0].ID == 0 || items[0].ID != stored["new"] {
+		t.Fatalf("invalid item id: %d, stored as %d", items[0].ID, stored["new"])
+	}
+}
+
+func TestWebhookRetry(t *testing.T) {
+	var lock sync.Mutex
+	status := http.StatusInternalServerError
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		lock.Lock()
+		defer lock.Unlock()
+		w.WriteHeader(status)
+	}))
+	defer receiver.Close()
+
+	log.SetOutput(io.Discard)
+	defer log.SetOutput(os.Stderr)
+	db, _ := storage.New(filepath.Join(t.TempDir(), "storage.db"))
+	w := NewWorker(db)
+	hook := db.CreateWebhook(storage.Webhook{URL: receiver.URL, Events: storage.WebhookEvents{storage.EventRefreshDone}, Enabled: true})
+
+	w.sendWebhook(*hook, storage.EventRefreshDone, map[string]interface{}{})
+	var delivery storage.WebhookDelivery
+	for start := time.Now(); time.Since(start) < 5*time.Second; time.Sleep(10 * time.Millisecond) {
+		if delivery = db.ListWebhookDeliveries(hook.Id)[0]; delivery.Attempts == 1 {
+			break
+		}
+	}
+	if delivery.Attempts != 1 || delivery.Status != 500 || delivery.NextAttemptAt == nil || delivery.DeliveredAt != nil {
+		t.Fatalf("expected the retry to be scheduled: %#v", delivery)
+	}
+	if wait := time.Until(*delivery.NextAttemptAt); wait < webhookRetryDelays[0]-time.Second*5 || wait > webhookRetryDelays[0] {
+		t.Fatalf("invalid retry time: in %s", wait)
+	}
+	if have := db.ListDueWebhookDeliveries(time.Now()); len(have) != 0 {
+		t.Fatalf("retried too early: %#v", have)
+	}
+
+	// the time of the retry has come, possibly after a restart
+	lock.Lock()
+	status = http.StatusOK
+	lock.Unlock()
+	past := time.Now().Add(-time.Second)
+	delivery.NextAttemptAt = &past
+	db.UpdateWebhookDelivery(delivery)
+	NewWorker(db).retryWebhooks()
+
+	delivery = db.ListWebhookDeliveries(hook.Id)[0]
+	if delivery.Attempts != 2 || delivery.Status != 200 || delivery.DeliveredAt == nil || delivery.NextAttemptAt != nil {
+		t.Fatalf("expected the delivery to succeed: %#v", delivery)
+	}
+
+	// given up on after the last retry
+	lock.Lock()
+	status = http.StatusInternalServerError
+	lock.Unlock()
+	delivery.Attempts = len(webhookRetryDelays)
+	delivery.DeliveredAt = nil
+	w.deliverWebhook(*hook, delivery)
+	if delivery = db.ListWebhookDeliveries(hook.Id)[0]; delivery.NextAttemptAt != nil || delivery.Error == "" {
+		t.Fatalf("expected no more attempts: %#v", delivery)
+	}
+}
@@ -0,0 +1,197 @@
+package worker
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/nkanaev/yarr/src/parser"
+	"github.com/nkanaev/yarr/src/storage"
+)
+
+const (
+	webSubTick = time.Minute * 10
+	// requested subscription lease, the hub may choose a different one
+	webSubLease = time.Hour * 24 * 10
+	// subscriptions are renewed ahead of expiration
+	webSubRenewBefore = time.Hour * 24
+	// minimum time between the requests for the same subscription
+	webSubRetry = time.Hour
+	// feeds receiving the updates from the hub are still polled, only rarely
+	webSubRefreshInterval = maxRefreshInterval
+)
+
+// Start subscribing to the hubs advertised by the feeds.
+// The callback url of the feed is the given base url followed by the feed id.
+func (w *Worker) StartWebSub(callbackURL string) {
+	w.webSubCallback = callbackURL
+	log.Printf("websub: callback url %s", callbackURL)
+	go func() {
+		ticker := time.NewTicker(webSubTick)
+		for {
+			w.renewWebSubs()
+			<-ticker.C
+		}
+	}()
+}
+
+func (w *Worker) renewWebSubs() {
+	now := time.Now()
+	for _, sub := range w.db.ListWebSubs() {
+		if !webSubDue(sub, now) {
+			continue
+		}
+		if err := w.subscribeWebSub(sub); err != nil {
+			log.Printf("websub: failed to subscribe to %s at %s: %s", sub.Topic, sub.Hub, err)
+		}
+	}
+}
+
+// Whether the subscription needs to be requested or renewed.
+func webSubDue(sub storage.WebSub, now time.Time) bool {
+	if sub.RequestedAt != nil && now.Sub(*sub.RequestedAt) < webSubRetry {
+		return false
+	}
+	if sub.State == storage.WebSubActive && sub.ExpiresAt != nil {
+		return sub.ExpiresAt.Sub(now) < webSubRenewBefore
+	}
+	return true
+}
+
+// Whether the feed receives the updates from the hub.
+func webSubActive(sub storage.WebSub, now time.Time) bool {
+	return sub.State == storage.WebSubActive && sub.ExpiresAt != nil && now.Before(*sub.ExpiresAt)
+}
+
+func (w *Worker) subscribeWebSub(sub storage.WebSub) error {
+	secret := sub.Secret
+	if secret == "" {
+		buf := make([]byte, 20)
+		if _, err := rand.Read(buf); err != nil {
+			return err
+		}
+		secret = hex.EncodeToString(buf)
+	}
+	// the hub may verify the intent before responding to the request
+	w.db.SetWebSubRequested(sub.FeedID, secret)
+
+	res, err := client.postForm(sub.Hub, url.Values{
+		"hub.mode":          {"subscribe"},
+		"hub.topic":         {sub.Topic},
+		"hub.callback":      {w.webSubCallback + strconv.FormatInt(sub.FeedID, 10)},
+		"hub.secret":        {secret},
+		"hub.lease_seconds": {strconv.Itoa(int(webSubLease.Seconds()))},
+	})
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	if res.StatusCode < 200 || res.StatusCode > 299 {
+		body, _ := io.ReadAll(io.LimitReader(res.Body, 512))
+		return fmt.Errorf("status code %d: %s", res.StatusCode, strings.TrimSpace(string(body)))
+	}
+	return nil
+}
+
+// Hub & topic urls of the feed, either from the `Link` http headers or from the feed itself.
+func webSubLinks(res *http.Response, feed *parser.Feed, f storage.Feed) (hub, topic string) {
+	hub = linkHeader(res, "hub")
+	if hub == "" {
+		hub = feed.HubURL
+	}
+	topic = linkHeader(res, "self")
+	if topic == "" {
+		topic = feed.SelfURL
+	}
+	if topic == "" {
+		topic = f.FeedLink
+	}
+	return hub, topic
+}
+
+// Target of the link with the given relation from the `Link` http headers:
+// `Link: <https://hub.example.com/>; rel="hub", </feed.xml>; rel="self"`
+func linkHeader(res *http.Response, rel string) string {
+	for _, value := range res.Header.Values("Link") {
+		for _, link := range strings.Split(value, ",") {
+			target, params, _ := strings.Cut(link, ";")
+			target = strings.Trim(strings.TrimSpace(target), "<>")
+			for _, param := range strings.Split(params, ";") {
+				name, val, _ := strings.Cut(strings.TrimSpace(param), "=")
+				if !strings.EqualFold(name, "rel") {
+					continue
+				}
+				for _, r := range strings.Fields(strings.Trim(val, `"`)) {
+					if !strings.EqualFold(r, rel) {
+						continue
+					}
+					if res.Request != nil {
+						if u, err := res.Request.URL.Parse(target); err == nil {
+							return u.String()
+						}
+					}
+					return target
+				}
+			}
+		}
+	}
+	return ""
+}
+
+var webSubHashes = map[string]func() hash.Hash{
+	"sha1":   sha1.New,
+	"sha256": sha256.New,
+	"sha384": sha512.New384,
+	"sha512": sha512.New,
+}
+
+// Check the `X-Hub-Signature` of the content distributed by the hub: `method=hex(hmac(secret, body))`.
+func VerifyWebSubSignature(secret, signature string, body []byte) bool {
+	method, digest, _ := strings.Cut(signature, "=")
+	newHash, ok := webSubHashes[strings.ToLower(method)]
+	if !ok {
+		return false
+	}
+	want, err := hex.DecodeString(digest)
+	if err != nil {
+		return false
+	}
+	mac := hmac.New(newHash, []byte(secret))
+	mac.Write(body)
+	return hmac.Equal(want, mac.Sum(nil))
+}
+
+// Store the items of the feed content distributed by the hub,
+// the same way as the ones of the fetched content.
+func (w *Worker) IngestWebSub(feed storage.Feed, body io.Reader, contentType string) error {
+	w.reflock.Lock()
+	limits := w.limits
+	w.reflock.Unlock()
+
+	result := feedResult{feed: feed, host: feedHost(feed), start: time.Now()}
+	result.stats.status = http.StatusOK
+	body = countingReader{reader: body, count: &result.stats.bytes}
+	parsed, err := parser.ParseAndFix(body, feed.FeedLink, contentCharset(contentType))
+	if err == nil {
+		result.items = ConvertItems(parsed.Items, feed)
+		result.size = len(result.items)
+	}
+	result.err = err
+	result.duration = time.Since(result.start)
+
+	w.prepareItems(&result, limits)
+	w.saveResult(result)
+	return err
+}
@@ -9,19 +9,44 @@ import (
 	"github.com/nkanaev/yarr/src/storage"
 )
 
-const NUM_WORKERS = 4
-
 type Worker struct {
 	db      *storage.Storage
 	pending *int32
-	refresh *time.Ticker
 	reflock sync.Mutex
-	stopper chan bool
+	limits  fetchLimits
+	// per host limits of the requests, shared by all the refreshes
+	hosts *hostLimiter
+
+	// feeds being fetched at the moment, either by the scheduled or the on-demand refresh
+	fetching     map[int64]bool
+	fetchingLock sync.Mutex
+
+	// default refresh interval in minutes, 0 to disable auto-refresh
+	refreshRate *int64
+	scheduler   sync.Once
+
+	// base of the websub callback urls, empty if push subscriptions are disabled
+	webSubCallback string
+	// server sending the digests, nil if not configured
+	smtp *SMTPConfig
+
+	// directory of the downloaded enclosures, empty if the downloads are disabled
+	mediaDir     string
+	mediaSyncing bool
+	mediaLock    sync.Mutex
 }
 
 func NewWorker(db *storage.Storage) *Worker {
 	pending := int32(0)
-	return &Worker{db: db, pending: &pending}
+	refreshRate := int64(0)
+	return &Worker{
+		db:          db,
+		pending:     &pending,
+		refreshRate: &refreshRate,
+		limits:      defaultFetchLimits,
+		hosts:       newHostLimiter(),
+		fetching:    make(map[int64]bool),
+	}
 }
 
 func (w *Worker) FeedsPending() int32 {
@@ -29,16 +54,22 @@ func (w *Worker) FeedsPending() int32 {
 }
 
 func (w *Worker) StartFeedCleaner() {
-	go w.db.DeleteOldItems()
+	go w.deleteOldItems()
 	ticker := time.NewTicker(time.Hour * 24)
 	go func() {
 		for {
 			<-ticker.C
-			w.db.DeleteOldItems()
+			w.deleteOldItems()
 		}
 	}()
 }
 
+// Delete the old items along with their downloaded enclosures.
+func (w *Worker) deleteOldItems() {
+	w.db.DeleteOldItems()
+	w.SyncMedia()
+}
+
 func (w *Worker) FindFavicons() {
 	go func() {
 		for _, feed := range w.db.ListFeedsMissingIcons() {
@@ -48,7 +79,7 @@ func (w *Worker) FindFavicons() {
 }
 
 func (w *Worker) FindFeedFavicon(feed storage.Feed) {
-	icon, err := findFavicon(feed.Link, feed.FeedLink)
+	icon, err := findFavicon(feed.Link, feed.FeedLink, w.db.GetFeedRequestOptions(feed.Id))
 	if err != nil {
 		log.Printf("Failed to find favicon for %s (%s): %s", feed.FeedLink, feed.Link, err)
 	}
@@ -57,90 +88,63 @@ func (w *Worker) FindFeedFavicon(feed storage.Feed) {
 	}
 }
 
-func (w *Worker) SetRefreshRate(minute int64) {
-	if w.stopper != nil {
-		w.refresh.Stop()
-		w.refresh = nil
-		w.stopper <- true
-		w.stopper = nil
-	}
-
-	if minute == 0 {
-		return
-	}
-
-	w.stopper = make(chan bool)
-	w.refresh = time.NewTicker(time.Minute * time.Duration(minute))
-
-	go func(fire <-chan time.Time, stop <-chan bool, m int64) {
-		log.Printf("auto-refresh %dm: starting", m)
-		for {
-			select {
-			case <-fire:
-				log.Printf("auto-refresh %dm: firing", m)
-				w.RefreshFeeds()
-			case <-stop:
-				log.Printf("auto-refresh %dm: stopping", m)
-				return
-			}
-		}
-	}(w.refresh.C, w.stopper, minute)
+// Request options of the feed to use for fetching the given url, e.g. the page of its item.
+func (w *Worker) FeedRequestOptions(feed storage.Feed, url string) *storage.RequestOptions {
+	return scopedOptions(w.db.GetFeedRequestOptions(feed.Id), feed.FeedLink, url)
 }
 
+// Refresh all the feeds but the paused ones. The publisher hints (skipHours, Retry-After)
+// govern only the scheduled checks, not the ones requested by the user.
 func (w *Worker) RefreshFeeds() {
-	w.reflock.Lock()
-	defer w.reflock.Unlock()
-
-	if *w.pending > 0 {
-		log.Print("Refreshing already in progress")
-		return
+	feeds := make([]storage.Feed, 0)
+	for _, feed := range w.db.ListFeeds() {
+		if feed.PausedAt == nil {
+			feeds = append(feeds, feed)
+		}
 	}
-
-	feeds := w.db.ListFeeds()
 	if len(feeds) == 0 {
 		log.Print("Nothing to refresh")
 		return
 	}
-
-	log.Print("Refreshing feeds")
-	atomic.StoreInt32(w.pending, int32(len(feeds)))
-	go w.refresher(feeds)
+	w.refreshFeeds(feeds)
 }
 
-func (w *Worker) refresher(feeds []storage.Feed) {
-	w.db.ResetFeedErrors()
-
-	srcqueue := make(chan storage.Feed, len(feeds))
-	dstqueue := make(chan []storage.Item)
-
-	for i := 0; i < NUM_WORKERS; i++ {
-		go w.worker(srcqueue, dstqueue)
-	}
+func (w *Worker) refreshFeeds(feeds []storage.Feed) bool {
+	w.reflock.Lock()
+	defer w.reflock.Unlock()
 
-	for _, feed := range feeds {
-		srcqueue <- feed
-	}
-	for i := 0; i < len(feeds); i++ {
-		items := <-dstqueue
-		if len(items) > 0 {
-			w.db.CreateItems(items)
-			w.db.SetFeedSize(items[0].FeedId, len(items))
-		}
-		atomic.AddInt32(w.pending, -1)
-		w.db.SyncSearch()
+	if *w.pending > 0 {
+		log.Print("Refreshing already in progress")
+		return false
 	}
-	close(srcqueue)
-	close(dstqueue)
 
-	log.Printf("Finished refreshing %d feeds", len(feeds))
+	log.Printf("Refreshing %d feeds", len(feeds))
+	atomic.StoreInt32(w.pending, int32(len(feeds)))
+	go w.refresher(feeds, w.limits)
+	return true
 }
 
-func (w *Worker) worker(srcqueue <-chan storage.Feed, dstqueue chan<- []storage.Item) {
-	for feed := range srcqueue {
-		items, err := listItems(feed, w.db)
-		if err != nil {
-			w.db.SetFeedError(feed.Id, err)
+// Refresh the feeds right away, alongside the scheduled refresh if one is in progress.
+// Returns the outcome of each fetch. The feeds being fetched already are reported as failed.
+func (w *Worker) RefreshFeedsNow(feeds []storage.Feed) []storage.FeedFetch {
+	w.reflock.Lock()
+	limits := w.limits
+	w.reflock.Unlock()
+
+	start := time.Now()
+	result := make([]storage.FeedFetch, 0, len(feeds))
+	w.dispatch(feeds, limits, func(r feedResult) {
+		if r.skipped {
+			result = append(result, storage.FeedFetch{
+				FeedID: r.feed.Id,
+				Date:   r.start,
+				Error:  "the feed is being refreshed already",
+			})
+			return
 		}
-		dstqueue <- items
-	}
+		result = append(result, w.saveResult(r))
+	})
+	w.notifyRefreshDone(result, time.Since(start))
+	go w.SyncMedia()
+	return result
 }